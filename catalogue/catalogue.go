@@ -0,0 +1,166 @@
+// Package catalogue moves the meal catalogue in and out of spreadsheets. Meals
+// are read from CSV or JSON one row at a time, validated like POST /meals and
+// upserted by their natural key, name plus category. Export writes the same
+// formats, so a catalogue can be exported, edited and imported back.
+package catalogue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"figorate/helpers"
+	"figorate/models"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Formats the catalogue can be read and written in
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// FormatFromFilename guesses the format from a file's extension
+func FormatFromFilename(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return FormatJSON
+	case ".csv":
+		return FormatCSV
+	}
+	return ""
+}
+
+// NewReader opens r in the given format
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVReader(r)
+	case FormatJSON:
+		return NewJSONReader(r), nil
+	}
+	return nil, fmt.Errorf("format must be csv or json")
+}
+
+// Write writes meals to w in the given format
+func Write(w io.Writer, format string, meals []models.Meal) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, meals)
+	case FormatJSON:
+		return WriteJSON(w, meals)
+	}
+	return fmt.Errorf("format must be csv or json")
+}
+
+// Meals loads the active catalogue ordered by category and name, ready to export
+func Meals(ctx context.Context, collection *mongo.Collection) ([]models.Meal, error) {
+	cursor, err := collection.Find(ctx, bson.M{"deleted_at": nil},
+		options.Find().SetSort(bson.D{{Key: "category", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meals: %v", err)
+	}
+	meals := []models.Meal{}
+	if err := cursor.All(ctx, &meals); err != nil {
+		return nil, fmt.Errorf("failed to load meals: %v", err)
+	}
+	return meals, nil
+}
+
+// Row is one meal read from an import file
+type Row struct {
+	Line int
+	Meal models.MealRequest
+}
+
+// Reader yields rows until io.EOF. Rows that cannot be parsed are returned as
+// *RowError so the caller can report them and carry on.
+type Reader interface {
+	Next() (*Row, error)
+}
+
+// RowError describes a row that was rejected
+type RowError struct {
+	Line     int      `json:"line"`
+	Name     string   `json:"name,omitempty"`
+	Category string   `json:"category,omitempty"`
+	Errors   []string `json:"errors"`
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, strings.Join(e.Errors, "; "))
+}
+
+// mealValidator applies the same binding rules gin applies to MealRequest
+var mealValidator = func() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	return v
+}()
+
+// Validate checks a row against every rule a meal created through the API must meet
+func Validate(row Row) *RowError {
+	var problems []string
+	if err := mealValidator.Struct(row.Meal); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			for _, fieldError := range validationErrors {
+				problems = append(problems, fieldProblem(fieldError))
+			}
+		} else {
+			problems = append(problems, err.Error())
+		}
+	}
+	if err := helpers.ValidateMealTags(row.Meal.Tags); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := helpers.ValidateAllergens(row.Meal.Allergens); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &RowError{Line: row.Line, Name: row.Meal.Name, Category: row.Meal.Category, Errors: problems}
+}
+
+// fieldProblem phrases a validation failure using the column name
+func fieldProblem(fieldError validator.FieldError) string {
+	field := columnName(fieldError.StructField())
+	switch fieldError.Tag() {
+	case "required":
+		return field + " is required"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fieldError.Param(), " ", ", "))
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s", field, fieldError.Param())
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s", field, fieldError.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, fieldError.Param())
+	case "uri", "url":
+		return field + " must be a URL"
+	default:
+		return fmt.Sprintf("%s failed %s validation", field, fieldError.Tag())
+	}
+}
+
+// columnName maps a MealRequest or Nutrition field to its column
+func columnName(field string) string {
+	switch field {
+	case "Preptime":
+		return ColumnPrepTime
+	default:
+		return strings.ToLower(field)
+	}
+}
+
+// Key is the natural key meals are matched on. Names match exactly, as they
+// do for POST /meals.
+func Key(name, category string) string {
+	return category + "|" + name
+}
@@ -0,0 +1,240 @@
+package catalogue
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"figorate/models"
+)
+
+// CSV columns. Micronutrients each get a column named MicronutrientPrefix plus
+// their key, e.g. micronutrients.potassium_mg.
+const (
+	ColumnName          = "name"
+	ColumnCategory      = "category"
+	ColumnDescription   = "description"
+	ColumnImage         = "image"
+	ColumnCalories      = "calories"
+	ColumnPrepTime      = "prep_time"
+	ColumnTags          = "tags"
+	ColumnAllergens     = "allergens"
+	ColumnProtein       = "protein"
+	ColumnCarbohydrates = "carbohydrates"
+	ColumnFat           = "fat"
+	ColumnFiber         = "fiber"
+	ColumnSugar         = "sugar"
+	ColumnSodium        = "sodium"
+
+	MicronutrientPrefix = "micronutrients."
+)
+
+// Columns lists the fixed CSV columns in export order
+var Columns = []string{
+	ColumnName, ColumnCategory, ColumnDescription, ColumnImage, ColumnCalories, ColumnPrepTime,
+	ColumnTags, ColumnAllergens, ColumnProtein, ColumnCarbohydrates, ColumnFat, ColumnFiber,
+	ColumnSugar, ColumnSodium,
+}
+
+// ListSeparator separates tags and allergens within a cell
+const ListSeparator = "|"
+
+// CSVReader reads meals from a CSV file with a header row. Columns may come
+// in any order and all but name and category may be left out.
+type CSVReader struct {
+	csv     *csv.Reader
+	columns map[string]int
+	line    int // of the current record, which may span lines when quoted
+}
+
+func NewCSVReader(r io.Reader) (*CSVReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	known := make(map[string]bool, len(Columns))
+	for _, column := range Columns {
+		known[column] = true
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !known[column] && !strings.HasPrefix(column, MicronutrientPrefix) {
+			return nil, fmt.Errorf("unknown CSV column: %s", column)
+		}
+		if _, duplicate := columns[column]; duplicate {
+			return nil, fmt.Errorf("duplicate CSV column: %s", column)
+		}
+		columns[column] = i
+	}
+	for _, required := range []string{ColumnName, ColumnCategory} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV is missing the %s column", required)
+		}
+	}
+
+	return &CSVReader{csv: reader, columns: columns}, nil
+}
+
+func (r *CSVReader) Next() (*Row, error) {
+	record, err := r.csv.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return nil, &RowError{Line: parseErr.StartLine, Errors: []string{parseErr.Err.Error()}}
+		}
+		return nil, fmt.Errorf("failed to read CSV: %v", err)
+	}
+	r.line, _ = r.csv.FieldPos(0)
+
+	cell := func(column string) string {
+		if i, ok := r.columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var problems []string
+	number := func(column string) float64 {
+		value := cell(column)
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be a number", column))
+		}
+		return n
+	}
+	integer := func(column string) int {
+		value := cell(column)
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be a whole number", column))
+		}
+		return n
+	}
+
+	meal := models.MealRequest{
+		Name:        cell(ColumnName),
+		Category:    strings.ToLower(cell(ColumnCategory)),
+		Description: cell(ColumnDescription),
+		Image:       cell(ColumnImage),
+		Calories:    integer(ColumnCalories),
+		Preptime:    integer(ColumnPrepTime),
+		Tags:        splitList(cell(ColumnTags)),
+		Allergens:   splitList(cell(ColumnAllergens)),
+		Nutrition: models.Nutrition{
+			Protein:       number(ColumnProtein),
+			Carbohydrates: number(ColumnCarbohydrates),
+			Fat:           number(ColumnFat),
+			Fiber:         number(ColumnFiber),
+			Sugar:         number(ColumnSugar),
+			Sodium:        number(ColumnSodium),
+		},
+	}
+	for column := range r.columns {
+		if !strings.HasPrefix(column, MicronutrientPrefix) || cell(column) == "" {
+			continue
+		}
+		if meal.Nutrition.Micronutrients == nil {
+			meal.Nutrition.Micronutrients = make(map[string]float64)
+		}
+		meal.Nutrition.Micronutrients[strings.TrimPrefix(column, MicronutrientPrefix)] = number(column)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, &RowError{Line: r.line, Name: meal.Name, Category: meal.Category, Errors: problems}
+	}
+	return &Row{Line: r.line, Meal: meal}, nil
+}
+
+// WriteCSV writes meals with a header row, adding a column for every
+// micronutrient any of them carries
+func WriteCSV(w io.Writer, meals []models.Meal) error {
+	micronutrientSet := map[string]bool{}
+	for _, meal := range meals {
+		for key := range meal.Nutrition.Micronutrients {
+			micronutrientSet[key] = true
+		}
+	}
+	micronutrients := make([]string, 0, len(micronutrientSet))
+	for key := range micronutrientSet {
+		micronutrients = append(micronutrients, key)
+	}
+	sort.Strings(micronutrients)
+
+	writer := csv.NewWriter(w)
+	header := append([]string(nil), Columns...)
+	for _, key := range micronutrients {
+		header = append(header, MicronutrientPrefix+key)
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+
+	for _, meal := range meals {
+		record := []string{
+			meal.Name,
+			meal.Category,
+			meal.Description,
+			meal.Image,
+			strconv.Itoa(meal.Calories),
+			strconv.Itoa(meal.Preptime),
+			strings.Join(meal.Tags, ListSeparator),
+			strings.Join(meal.DeclaredAllergens, ListSeparator),
+			formatNumber(meal.Nutrition.Protein),
+			formatNumber(meal.Nutrition.Carbohydrates),
+			formatNumber(meal.Nutrition.Fat),
+			formatNumber(meal.Nutrition.Fiber),
+			formatNumber(meal.Nutrition.Sugar),
+			formatNumber(meal.Nutrition.Sodium),
+		}
+		for _, key := range micronutrients {
+			value, ok := meal.Nutrition.Micronutrients[key]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, formatNumber(value))
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+	return nil
+}
+
+func splitList(cell string) []string {
+	var values []string
+	for _, value := range strings.Split(cell, ListSeparator) {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// formatNumber writes the shortest representation that reads back to the same value
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,210 @@
+package catalogue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Summary counts what happened to each row of an import
+type Summary struct {
+	Read      int  `json:"read"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+	Invalid   int  `json:"invalid"`
+	DryRun    bool `json:"dry_run"`
+}
+
+// Changed reports whether the import wrote (or in a dry run would write) anything
+func (s Summary) Changed() bool {
+	return s.Created+s.Updated > 0
+}
+
+// Change describes a meal an import creates or updates
+type Change struct {
+	Line     int                           `json:"line"`
+	Name     string                        `json:"name"`
+	Category string                        `json:"category"`
+	Action   string                        `json:"action"` // create or update
+	Changes  map[string]models.FieldChange `json:"changes,omitempty"`
+}
+
+// Importer upserts meals into the catalogue by name and category, recording
+// an audit entry for every meal it creates or changes
+type Importer struct {
+	meals  *mongo.Collection
+	audit  *mongo.Collection
+	UserID primitive.ObjectID // recorded as the author of every change
+	DryRun bool
+	// OnInvalid is called for every row that was rejected
+	OnInvalid func(RowError)
+	// OnChange is called for every meal created or updated, including in a dry run
+	OnChange func(Change)
+}
+
+func NewImporter(meals, audit *mongo.Collection) *Importer {
+	return &Importer{meals: meals, audit: audit}
+}
+
+// Run drains reader into the catalogue. Invalid rows are reported and
+// skipped; the remaining rows are still applied.
+func (im *Importer) Run(ctx context.Context, reader Reader) (Summary, error) {
+	summary := Summary{DryRun: im.DryRun}
+
+	existing, err := im.activeMeals(ctx)
+	if err != nil {
+		return summary, err
+	}
+	seen := map[string]int{}
+
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if rowErr, ok := err.(*RowError); ok {
+			summary.Read++
+			im.invalid(&summary, *rowErr)
+			continue
+		}
+		if err != nil {
+			return summary, err
+		}
+		summary.Read++
+
+		if rowErr := Validate(*row); rowErr != nil {
+			im.invalid(&summary, *rowErr)
+			continue
+		}
+		key := Key(row.Meal.Name, row.Meal.Category)
+		if first, duplicate := seen[key]; duplicate {
+			im.invalid(&summary, RowError{Line: row.Line, Name: row.Meal.Name, Category: row.Meal.Category,
+				Errors: []string{fmt.Sprintf("duplicate of line %d", first)}})
+			continue
+		}
+		seen[key] = row.Line
+
+		now := time.Now()
+		before, found := existing[key]
+		after := apply(before, row.Meal)
+		change := Change{Line: row.Line, Name: after.Name, Category: after.Category, Action: "create"}
+		if found {
+			change.Action = "update"
+			change.Changes = models.DiffMeals(before, after)
+			if len(change.Changes) == 0 {
+				summary.Unchanged++
+				continue
+			}
+		} else {
+			after.ID = primitive.NewObjectID()
+			after.CreatedBy = im.UserID
+			after.CreatedAt = now
+			change.Changes = models.DiffMeals(models.Meal{}, after)
+		}
+		after.UpdatedBy = im.UserID
+		after.UpdatedAt = now
+
+		if !im.DryRun {
+			if found {
+				_, err = im.meals.ReplaceOne(ctx, bson.M{"_id": after.ID}, after)
+			} else {
+				_, err = im.meals.InsertOne(ctx, after)
+			}
+			if err != nil {
+				return summary, fmt.Errorf("failed to save meal on line %d: %v", row.Line, err)
+			}
+			im.recordAudit(ctx, after.ID, change.Changes)
+		}
+		existing[key] = after
+
+		if found {
+			summary.Updated++
+		} else {
+			summary.Created++
+		}
+		if im.OnChange != nil {
+			im.OnChange(change)
+		}
+	}
+
+	return summary, nil
+}
+
+// activeMeals loads the catalogue keyed by name and category
+func (im *Importer) activeMeals(ctx context.Context) (map[string]models.Meal, error) {
+	cursor, err := im.meals.Find(ctx, bson.M{"deleted_at": nil})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meals: %v", err)
+	}
+	var meals []models.Meal
+	if err := cursor.All(ctx, &meals); err != nil {
+		return nil, fmt.Errorf("failed to load meals: %v", err)
+	}
+
+	byKey := make(map[string]models.Meal, len(meals))
+	for _, meal := range meals {
+		byKey[Key(meal.Name, meal.Category)] = normalize(meal)
+	}
+	return byKey, nil
+}
+
+func (im *Importer) invalid(summary *Summary, rowErr RowError) {
+	summary.Invalid++
+	if im.OnInvalid != nil {
+		im.OnInvalid(rowErr)
+	}
+}
+
+func (im *Importer) recordAudit(ctx context.Context, mealID primitive.ObjectID, changes map[string]models.FieldChange) {
+	entry := models.MealAuditLog{
+		MealID:    mealID,
+		UserID:    im.UserID,
+		Action:    "import",
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	}
+	if _, err := im.audit.InsertOne(ctx, entry); err != nil {
+		log.Printf("Failed to record meal audit for %s: %v", mealID.Hex(), err)
+	}
+}
+
+// apply overwrites a meal's editable fields with an imported row, like PUT /meals/:id
+func apply(meal models.Meal, request models.MealRequest) models.Meal {
+	if meal.Image != request.Image {
+		meal.Images = nil
+	}
+	meal.Name = request.Name
+	meal.Description = request.Description
+	meal.Image = request.Image
+	meal.Calories = request.Calories
+	meal.Nutrition = request.Nutrition
+	meal.Preptime = request.Preptime
+	meal.Category = request.Category
+	meal.Tags = request.Tags
+	meal.SetAllergens(request.Allergens, meal.IngredientAllergens)
+	return normalize(meal)
+}
+
+// normalize treats empty and missing lists or maps as the same thing, so they
+// never read as a change
+func normalize(meal models.Meal) models.Meal {
+	if len(meal.Tags) == 0 {
+		meal.Tags = []string{}
+	}
+	if len(meal.Allergens) == 0 {
+		meal.Allergens = []string{}
+	}
+	if len(meal.Nutrition.Micronutrients) == 0 {
+		meal.Nutrition.Micronutrients = nil
+	}
+	return meal
+}
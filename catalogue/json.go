@@ -0,0 +1,101 @@
+package catalogue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"figorate/models"
+)
+
+// JSONReader streams meals from a JSON array of objects shaped like the
+// POST /meals request body. A row's line is its position in the array.
+type JSONReader struct {
+	decoder *json.Decoder
+	started bool
+	index   int
+}
+
+func NewJSONReader(r io.Reader) *JSONReader {
+	return &JSONReader{decoder: json.NewDecoder(r)}
+}
+
+func (r *JSONReader) Next() (*Row, error) {
+	if !r.started {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON: %v", err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, fmt.Errorf("JSON import must be an array of meals")
+		}
+		r.started = true
+	}
+
+	if !r.decoder.More() {
+		return nil, io.EOF
+	}
+	r.index++
+
+	var meal models.MealRequest
+	if err := r.decoder.Decode(&meal); err != nil {
+		// A value of the wrong type leaves the decoder at the next element,
+		// anything else means the document itself is broken
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return nil, &RowError{Line: r.index, Name: meal.Name, Category: meal.Category,
+				Errors: []string{fmt.Sprintf("%s must be %s", typeErr.Field, jsonTypeName(typeErr.Type))}}
+		}
+		return nil, fmt.Errorf("failed to read JSON meal %d: %v", r.index, err)
+	}
+
+	meal.Name = strings.TrimSpace(meal.Name)
+	meal.Category = strings.ToLower(strings.TrimSpace(meal.Category))
+	return &Row{Line: r.index, Meal: meal}, nil
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		return "a whole number"
+	case reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a " + t.String()
+	}
+}
+
+// WriteJSON writes meals as an indented JSON array that NewJSONReader reads back
+func WriteJSON(w io.Writer, meals []models.Meal) error {
+	requests := make([]models.MealRequest, 0, len(meals))
+	for _, meal := range meals {
+		requests = append(requests, Request(meal))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(requests); err != nil {
+		return fmt.Errorf("failed to write JSON: %v", err)
+	}
+	return nil
+}
+
+// Request returns the editable fields of a meal, the shape both formats carry
+func Request(meal models.Meal) models.MealRequest {
+	return models.MealRequest{
+		Name:        meal.Name,
+		Description: meal.Description,
+		Image:       meal.Image,
+		Calories:    meal.Calories,
+		Nutrition:   meal.Nutrition,
+		Preptime:    meal.Preptime,
+		Category:    meal.Category,
+		Tags:        meal.Tags,
+		Allergens:   meal.DeclaredAllergens,
+	}
+}
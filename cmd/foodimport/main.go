@@ -0,0 +1,136 @@
+// Command foodimport loads ingredient nutrition from food composition
+// datasets into MongoDB. Files are streamed, so full USDA downloads can be
+// imported directly.
+//
+//	go run ./cmd/foodimport -format usda_json -file FoodData_Central_foundation_food_json.json
+//	go run ./cmd/foodimport -format usda_csv -food food.csv -food-nutrient food_nutrient.csv
+//	go run ./cmd/foodimport -format csv -file foods.csv -mapping mapping.json -unmapped unmapped.csv
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"figorate/database"
+	"figorate/foodimport"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	format := flag.String("format", "usda_json", "input format: usda_json, usda_csv or csv")
+	file := flag.String("file", "", "input file for usda_json and csv")
+	foodFile := flag.String("food", "", "food.csv for usda_csv")
+	foodNutrientFile := flag.String("food-nutrient", "", "food_nutrient.csv for usda_csv")
+	mappingFile := flag.String("mapping", "", "column mapping JSON for csv")
+	unmappedFile := flag.String("unmapped", "", "write rows that could not be mapped to this CSV file")
+	batchSize := flag.Int("batch", 500, "ingredients inserted per batch")
+	dryRun := flag.Bool("dry-run", false, "report what would be imported without writing")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	reader, closeInputs, err := openReader(*format, *file, *foodFile, *foodNutrientFile, *mappingFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeInputs()
+
+	database.ConnectDatabase()
+	defer database.DisconnectDatabase()
+
+	importer := foodimport.NewImporter(database.GetDatabase().Collection("ingredients"))
+	importer.BatchSize = *batchSize
+	importer.DryRun = *dryRun
+	if err := importer.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("Ingredient indexes not created: %v", err)
+	}
+
+	if *unmappedFile != "" {
+		out, err := os.Create(*unmappedFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+
+		report := csv.NewWriter(out)
+		defer report.Flush()
+		report.Write([]string{"line", "source_id", "name", "reason"})
+		importer.OnUnmapped = func(row foodimport.UnmappedError) {
+			report.Write([]string{strconv.Itoa(row.Line), row.SourceID, row.Name, row.Reason})
+		}
+	}
+
+	summary, err := importer.Run(context.Background(), reader)
+	fmt.Printf("Read %d rows: %d imported, %d duplicates, %d unmapped\n",
+		summary.Read, summary.Imported, summary.Duplicates, summary.Unmapped)
+	if summary.DryRun {
+		fmt.Println("Dry run: nothing was written")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openReader opens the input files for a format and returns a function closing them
+func openReader(format, file, foodFile, foodNutrientFile, mappingFile string) (foodimport.Reader, func(), error) {
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	open := func(path, flagName string) (*os.File, error) {
+		if path == "" {
+			return nil, fmt.Errorf("-%s is required for format %s", flagName, format)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		return f, nil
+	}
+
+	var reader foodimport.Reader
+	var err error
+	switch format {
+	case "usda_json":
+		var f *os.File
+		if f, err = open(file, "file"); err == nil {
+			reader = foodimport.NewUSDAJSONReader(f)
+		}
+	case "usda_csv":
+		var foods, nutrients *os.File
+		if foods, err = open(foodFile, "food"); err == nil {
+			if nutrients, err = open(foodNutrientFile, "food-nutrient"); err == nil {
+				reader, err = foodimport.NewUSDACSVReader(foods, nutrients)
+			}
+		}
+	case "csv":
+		var mapping foodimport.CSVMapping
+		if mappingFile == "" {
+			err = fmt.Errorf("-mapping is required for format csv")
+		} else if mapping, err = foodimport.LoadCSVMapping(mappingFile); err == nil {
+			var f *os.File
+			if f, err = open(file, "file"); err == nil {
+				reader, err = foodimport.NewMappedCSVReader(f, mapping)
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	return reader, closeAll, nil
+}
@@ -0,0 +1,166 @@
+// Command mealcatalogue imports the meal catalogue from, and exports it to,
+// CSV or JSON files. Imports upsert by name and category, exactly like
+// POST /meals/import.
+//
+//	go run ./cmd/mealcatalogue export -o meals.csv
+//	go run ./cmd/mealcatalogue import -file meals.csv -dry-run
+//	go run ./cmd/mealcatalogue import -file meals.json -errors rejected.csv
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"figorate/catalogue"
+	"figorate/database"
+	"figorate/services"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "import" && os.Args[1] != "export") {
+		fmt.Fprintln(os.Stderr, "usage: mealcatalogue import|export [flags]")
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "import":
+		runImport(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	}
+}
+
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("file", "", "CSV or JSON file to import")
+	format := flags.String("format", "", "csv or json; defaults to the file extension")
+	errorsFile := flags.String("errors", "", "write rejected rows to this CSV file")
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing")
+	verbose := flags.Bool("v", false, "print every meal created or updated")
+	flags.Parse(args)
+
+	if *file == "" {
+		log.Fatal("-file is required")
+	}
+	if *format == "" {
+		*format = catalogue.FormatFromFilename(*file)
+	}
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer input.Close()
+
+	reader, err := catalogue.NewReader(*format, input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	database.ConnectDatabase()
+	defer database.DisconnectDatabase()
+
+	importer := catalogue.NewImporter(
+		database.GetDatabase().Collection("meals"),
+		database.GetDatabase().Collection("meal_audit_logs"),
+	)
+	importer.DryRun = *dryRun
+
+	var report *csv.Writer
+	if *errorsFile != "" {
+		out, err := os.Create(*errorsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+
+		report = csv.NewWriter(out)
+		defer report.Flush()
+		report.Write([]string{"line", "name", "category", "errors"})
+	}
+	importer.OnInvalid = func(row catalogue.RowError) {
+		if report != nil {
+			report.Write([]string{strconv.Itoa(row.Line), row.Name, row.Category, strings.Join(row.Errors, "; ")})
+			return
+		}
+		fmt.Fprintf(os.Stderr, "line %d (%s): %s\n", row.Line, row.Name, strings.Join(row.Errors, "; "))
+	}
+	if *verbose {
+		importer.OnChange = func(change catalogue.Change) {
+			fields := make([]string, 0, len(change.Changes))
+			for field := range change.Changes {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			fmt.Printf("line %d: %s %s (%s): %s\n", change.Line, change.Action, change.Name, change.Category, strings.Join(fields, ", "))
+		}
+	}
+
+	summary, err := importer.Run(context.Background(), reader)
+	fmt.Printf("Read %d rows: %d created, %d updated, %d unchanged, %d invalid\n",
+		summary.Read, summary.Created, summary.Updated, summary.Unchanged, summary.Invalid)
+	if summary.DryRun {
+		fmt.Println("Dry run: nothing was written")
+	} else if summary.Changed() {
+		cache := services.NewMealPlanCache(database.GetDatabase().Collection("meal_plan_cache"))
+		if err := cache.Invalidate(context.Background()); err != nil {
+			log.Printf("Failed to invalidate meal plan cache: %v", err)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "output file; defaults to stdout")
+	format := flags.String("format", "", "csv or json; defaults to the output extension, then csv")
+	flags.Parse(args)
+
+	if *format == "" {
+		*format = catalogue.FormatFromFilename(*output)
+	}
+	if *format == "" {
+		*format = catalogue.FormatCSV
+	}
+
+	database.ConnectDatabase()
+	defer database.DisconnectDatabase()
+
+	meals, err := catalogue.Meals(context.Background(), database.GetDatabase().Collection("meals"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		out, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+		w = out
+	}
+
+	if err := catalogue.Write(w, *format, meals); err != nil {
+		log.Fatal(err)
+	}
+	if *output != "" {
+		fmt.Printf("Exported %d meals to %s\n", len(meals), *output)
+	}
+}
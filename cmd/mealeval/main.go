@@ -0,0 +1,159 @@
+// Command mealeval replays fixture user profiles and catalogues through the
+// meal planners and scores the resulting plans, so prompt and model changes
+// can be compared offline. AI planners run once for every prompt version and
+// model listed, and the summary compares each combination.
+//
+//	go run ./cmd/mealeval -planners deterministic,fake,recorded
+//	go run ./cmd/mealeval -planners recorded -prompts v5,v6
+//	go run ./cmd/mealeval -planners live -prompts v5,v6 -models gpt-4o,gpt-4o-mini -record
+//
+// Recordings live at <recordings>/<prompt>/<model>/<fixture>.json. The
+// committed ones are hand-written stand-ins in the provider's response format,
+// not real responses: they answer as model "synthetic-fixture", which the
+// report shows, until -record refreshes them from the real API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"figorate/evaluation"
+	"figorate/models"
+	"figorate/services"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	fixturesDir := flag.String("fixtures", "evaluation/fixtures", "directory of fixture JSON files")
+	recordingsDir := flag.String("recordings", "evaluation/recordings", "directory of recorded provider responses")
+	promptsDir := flag.String("prompts-dir", os.Getenv("PROMPTS_DIR"), "prompt template directory (defaults to prompts)")
+	promptVersions := flag.String("prompts", "", "comma separated meal plan prompt versions to compare (defaults to the active one)")
+	modelNames := flag.String("models", "", "comma separated models to compare (defaults to the configured one)")
+	plannerNames := flag.String("planners", "deterministic,fake", "comma separated planners: deterministic, fake, recorded, live")
+	record := flag.Bool("record", false, "save live responses into the recordings directory")
+	seed := flag.Int64("seed", 1, "seed for the deterministic planner")
+	jsonOut := flag.String("json", "", "also write the report as JSON to this file")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	fixtures, err := evaluation.LoadFixtures(*fixturesDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prompts := services.NewPromptStore(*promptsDir, nil)
+	var templates []*models.PromptTemplate
+	for _, version := range splitList(*promptVersions) {
+		prompt, err := prompts.File(services.PromptMealPlan, version)
+		if err != nil {
+			log.Fatal(err)
+		}
+		templates = append(templates, prompt)
+	}
+	if len(templates) == 0 {
+		prompt, err := prompts.Active(context.Background(), services.PromptMealPlan)
+		if err != nil {
+			log.Fatal(err)
+		}
+		templates = append(templates, prompt)
+	}
+	aiModels := splitList(*modelNames)
+	if len(aiModels) == 0 {
+		aiModels = []string{services.NewAIServiceWithClient("", prompts, nil).Model()}
+	}
+
+	// aiPlanners runs an AI planner once for every prompt version and model,
+	// with the HTTP client transport picks for the fixture
+	var planners []evaluation.Planner
+	aiPlanners := func(name, apiKey string, transport func(fixture evaluation.Fixture, prompt *models.PromptTemplate, model string) http.RoundTripper) {
+		for _, prompt := range templates {
+			for _, model := range aiModels {
+				prompt, model := prompt, model
+				planners = append(planners, evaluation.Planner{
+					Name:   name,
+					Prompt: prompt.Version,
+					Model:  model,
+					New: func(fixture evaluation.Fixture) (services.MealPlanner, error) {
+						client := &http.Client{Transport: transport(fixture, prompt, model)}
+						service := services.NewAIServiceWithClient(apiKey, prompts, client).WithModel(model)
+						return evaluation.PromptPlanner{Service: service, Prompt: prompt}, nil
+					},
+				})
+			}
+		}
+	}
+	recordingPath := func(fixture evaluation.Fixture, prompt *models.PromptTemplate, model string) string {
+		return filepath.Join(*recordingsDir, prompt.Version, model, fixture.Name+".json")
+	}
+
+	for _, name := range splitList(*plannerNames) {
+		switch name {
+		case "deterministic":
+			planners = append(planners, evaluation.Planner{
+				Name: "deterministic",
+				New: func(evaluation.Fixture) (services.MealPlanner, error) {
+					return services.NewDeterministicPlanner(*seed), nil
+				},
+			})
+		case "fake":
+			aiPlanners("fake", "", func(fixture evaluation.Fixture, _ *models.PromptTemplate, _ string) http.RoundTripper {
+				return &evaluation.FakeTransport{Plan: evaluation.FakePlan(fixture.Request())}
+			})
+		case "recorded":
+			aiPlanners("recorded", "", func(fixture evaluation.Fixture, prompt *models.PromptTemplate, model string) http.RoundTripper {
+				return &evaluation.RecordedTransport{Path: recordingPath(fixture, prompt, model)}
+			})
+		case "live":
+			apiKey := os.Getenv("OPENAI_API_KEY")
+			if apiKey == "" {
+				log.Fatal("OPENAI_API_KEY is required for the live planner")
+			}
+			aiPlanners("live", apiKey, func(fixture evaluation.Fixture, prompt *models.PromptTemplate, model string) http.RoundTripper {
+				if *record {
+					return &evaluation.RecordingTransport{Path: recordingPath(fixture, prompt, model)}
+				}
+				return http.DefaultTransport
+			})
+		default:
+			log.Fatalf("Unknown planner %q", name)
+		}
+	}
+
+	report := evaluation.Run(context.Background(), fixtures, planners)
+	if err := report.WriteText(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+
+	if *jsonOut != "" {
+		body, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*jsonOut, body, 0o644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("\nReport written to %s\n", *jsonOut)
+	}
+}
+
+// splitList splits a comma separated flag, dropping blanks
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
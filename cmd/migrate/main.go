@@ -0,0 +1,60 @@
+// Command migrate applies pending data migrations to the database. Run it
+// before starting a version of the API that needs them.
+//
+//	go run ./cmd/migrate -list
+//	go run ./cmd/migrate
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"figorate/database"
+	"figorate/migrations"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	list := flag.Bool("list", false, "list migrations and whether they have been applied")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	database.ConnectDatabase()
+	defer database.DisconnectDatabase()
+
+	ctx := context.Background()
+	db := database.GetDatabase()
+
+	if *list {
+		applied, err := migrations.Applied(ctx, db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, migration := range migrations.All {
+			status := "pending"
+			if at, done := applied[migration.ID]; done {
+				status = "applied " + at.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%-32s %-24s %s\n", migration.ID, status, migration.Description)
+		}
+		return
+	}
+
+	ran, err := migrations.Run(ctx, db, func(migration migrations.Migration) {
+		fmt.Printf("Applying %s: %s\n", migration.ID, migration.Description)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(ran) == 0 {
+		fmt.Println("Nothing to migrate")
+		return
+	}
+	fmt.Printf("Applied %d migrations\n", len(ran))
+}
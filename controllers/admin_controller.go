@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"figorate/database"
+	"figorate/helpers"
+	"figorate/models"
+	"figorate/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AdminController struct {
+	usageService     *services.UsageService
+	promptStore      *services.PromptStore
+	promptCollection *mongo.Collection
+	conditionRules   *services.ConditionRuleService
+}
+
+func NewAdminController() *AdminController {
+	promptCollection := database.GetDatabase().Collection("prompt_templates")
+	return &AdminController{
+		usageService:     services.NewUsageService(database.GetDatabase().Collection("ai_usage"), database.GetDatabase().Collection("ai_quotas")),
+		promptStore:      services.NewPromptStore(os.Getenv("PROMPTS_DIR"), promptCollection),
+		promptCollection: promptCollection,
+		conditionRules:   services.NewConditionRuleService(database.GetDatabase().Collection("condition_rules")),
+	}
+}
+
+// GetAIUsageReport returns AI usage and estimated cost per model for a date range.
+// Defaults to the last 30 days.
+func (ac *AdminController) GetAIUsageReport(c *gin.Context) {
+	now := time.Now().UTC()
+	from := c.DefaultQuery("from", now.AddDate(0, 0, -30).Format("2006-01-02"))
+	to := c.DefaultQuery("to", now.Format("2006-01-02"))
+
+	if _, err := time.Parse("2006-01-02", from); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", to); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+		return
+	}
+
+	rows, err := ac.usageService.Report(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build usage report"})
+		return
+	}
+
+	var totalCost float64
+	var totalTokens int
+	for _, row := range rows {
+		totalCost += row.EstimatedCost
+		totalTokens += row.TotalTokens
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   from,
+		"to":     to,
+		"models": rows,
+		"totals": gin.H{
+			"total_tokens":   totalTokens,
+			"estimated_cost": totalCost,
+		},
+	})
+}
+
+// GetPromptTemplate shows the active version of a prompt and every version available
+func (ac *AdminController) GetPromptTemplate(c *gin.Context) {
+	name := c.Param("name")
+
+	active, err := ac.promptStore.Active(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileVersions, err := ac.promptStore.FileVersions(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list prompt files"})
+		return
+	}
+
+	cursor, err := ac.promptCollection.Find(context.Background(), bson.M{"name": name},
+		options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prompt versions"})
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	databaseVersions := []models.PromptTemplate{}
+	if err := cursor.All(context.Background(), &databaseVersions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode prompt versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"active":            active,
+		"file_versions":     fileVersions,
+		"database_versions": databaseVersions,
+	})
+}
+
+// CreatePromptTemplate stores a new database version of a prompt, optionally activating it
+func (ac *AdminController) CreatePromptTemplate(c *gin.Context) {
+	var request models.CreatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	if _, err := services.ParsePromptTemplate(request.Name, request.Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.promptStore.CheckOverrideVersion(request.Name, request.Version); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := ac.promptCollection.CountDocuments(context.Background(), bson.M{"name": request.Name, "version": request.Version})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check prompt versions"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Prompt version already exists"})
+		return
+	}
+
+	if request.Activate {
+		if err := ac.deactivatePrompts(request.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate previous prompt"})
+			return
+		}
+	}
+
+	now := time.Now()
+	prompt := models.PromptTemplate{
+		Name:      request.Name,
+		Version:   request.Version,
+		Body:      request.Body,
+		Active:    request.Activate,
+		Source:    "database",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	result, err := ac.promptCollection.InsertOne(context.Background(), prompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prompt template"})
+		return
+	}
+	prompt.ID = result.InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusCreated, prompt)
+}
+
+// ActivatePromptTemplate makes a stored database version the active override
+func (ac *AdminController) ActivatePromptTemplate(c *gin.Context) {
+	name := c.Param("name")
+
+	var request models.ActivatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	count, err := ac.promptCollection.CountDocuments(context.Background(), bson.M{"name": name, "version": request.Version})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check prompt versions"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt version not found"})
+		return
+	}
+
+	if err := ac.deactivatePrompts(name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate previous prompt"})
+		return
+	}
+
+	_, err = ac.promptCollection.UpdateOne(context.Background(),
+		bson.M{"name": name, "version": request.Version},
+		bson.M{"$set": bson.M{"active": true, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate prompt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Prompt version activated", "name": name, "version": request.Version})
+}
+
+// ClearPromptOverride deactivates all database versions so the file template is used again
+func (ac *AdminController) ClearPromptOverride(c *gin.Context) {
+	name := c.Param("name")
+	if err := ac.deactivatePrompts(name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear prompt override"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Prompt override cleared", "name": name})
+}
+
+func (ac *AdminController) deactivatePrompts(name string) error {
+	_, err := ac.promptCollection.UpdateMany(context.Background(),
+		bson.M{"name": name, "active": true},
+		bson.M{"$set": bson.M{"active": false, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// ListConditionRules returns the rule in effect for every medical condition
+func (ac *AdminController) ListConditionRules(c *gin.Context) {
+	rules, err := ac.conditionRules.Rules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch condition rules"})
+		return
+	}
+
+	conditions := make([]string, 0, len(rules))
+	for condition := range rules {
+		conditions = append(conditions, condition)
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": services.RulesFor(rules, conditions)})
+}
+
+// UpdateConditionRule replaces the rule for a condition, overriding the default
+func (ac *AdminController) UpdateConditionRule(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	condition := c.Param("condition")
+	if !helpers.KnownMedicalConditions[condition] || condition == "none" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown medical condition"})
+		return
+	}
+
+	var request models.ConditionRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if err := helpers.ValidateNutrientLimits(request.Limits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := helpers.ValidateMealTags(append(append([]string{}, request.PreferTags...), request.AvoidTags...)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.ConditionRule{
+		Condition:   condition,
+		Description: request.Description,
+		Limits:      request.Limits,
+		PreferTags:  request.PreferTags,
+		AvoidTags:   request.AvoidTags,
+		UpdatedBy:   userID,
+	}
+	if err := ac.conditionRules.Save(c.Request.Context(), rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save condition rule"})
+		return
+	}
+
+	rules, err := ac.conditionRules.ForConditions(c.Request.Context(), []string{condition})
+	if err != nil || len(rules) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch condition rule"})
+		return
+	}
+	c.JSON(http.StatusOK, rules[0])
+}
+
+// ResetConditionRule removes an override so the built-in rule applies again
+func (ac *AdminController) ResetConditionRule(c *gin.Context) {
+	condition := c.Param("condition")
+
+	removed, err := ac.conditionRules.Reset(c.Request.Context(), condition)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset condition rule"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No override for this condition"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Condition rule reset to default", "condition": condition})
+}
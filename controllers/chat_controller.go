@@ -0,0 +1,534 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"figorate/database"
+	"figorate/helpers"
+	"figorate/models"
+	"figorate/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ChatController struct {
+	conversationCollection *mongo.Collection
+	userCollection         *mongo.Collection
+	mealCollection         *mongo.Collection
+	mealPlans              *services.MealPlanStore
+	usageService           *services.UsageService
+	promptStore            *services.PromptStore
+	conditionRules         *services.ConditionRuleService
+}
+
+func NewChatController() *ChatController {
+	usageService := services.NewUsageService(database.GetDatabase().Collection("ai_usage"), database.GetDatabase().Collection("ai_quotas"))
+	if err := usageService.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("AI quota indexes not created: %v", err)
+	}
+
+	return &ChatController{
+		conversationCollection: database.GetDatabase().Collection("chat_conversations"),
+		userCollection:         database.GetDatabase().Collection("users"),
+		mealCollection:         database.GetDatabase().Collection("meals"),
+		mealPlans:              services.NewMealPlanStore(database.GetDatabase().Collection("meal_plans"), database.GetDatabase().Collection("meal_plan_versions")),
+		usageService:           usageService,
+		promptStore:            services.NewPromptStore(os.Getenv("PROMPTS_DIR"), database.GetDatabase().Collection("prompt_templates")),
+		conditionRules:         services.NewConditionRuleService(database.GetDatabase().Collection("condition_rules")),
+	}
+}
+
+// SendMessage adds a user message to a conversation (starting one if needed) and returns the assistant's reply
+func (cc *ChatController) SendMessage(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var request models.SendChatMessageRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	var user models.User
+	err := cc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	now := time.Now()
+	conversation := models.ChatConversation{
+		UserID:    userID,
+		Title:     truncate(request.Message, 60),
+		CreatedAt: now,
+	}
+	if request.ConversationID != "" {
+		conversationID, err := primitive.ObjectIDFromHex(request.ConversationID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+			return
+		}
+		err = cc.conversationCollection.FindOne(context.Background(), bson.M{"_id": conversationID, "user_id": userID}).Decode(&conversation)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+	}
+
+	plans, err := cc.planWindow(userID, user.Today(now))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+
+	meals, err := cc.catalogue(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+	rules, err := cc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+
+	conversation.Messages = append(conversation.Messages, models.ChatMessage{
+		Role:      "user",
+		Content:   request.Message,
+		CreatedAt: now,
+	})
+
+	quota, reserved, err := cc.usageService.Reserve(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check AI usage quota"})
+		return
+	}
+	if !reserved {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Daily AI usage quota exceeded", "quota": quota})
+		return
+	}
+
+	aiService := services.NewAIService(os.Getenv("OPENAI_API_KEY"), cc.promptStore)
+	reply, err := aiService.Chat(c.Request.Context(), services.ChatPromptData{
+		Today:    now.In(user.Location()).Format("Monday, 2006-01-02"),
+		User:     user,
+		PlanDays: chatPlanDays(plans, user.Slots()),
+		Meals:    meals,
+	}, conversation.Messages)
+	if err != nil {
+		if err := cc.usageService.Release(c.Request.Context(), userID, quota.Date); err != nil {
+			log.Printf("Failed to release AI quota for user %s: %v", userID.Hex(), err)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Assistant failed to respond: %v", err)})
+		return
+	}
+
+	if err := cc.usageService.Record(c.Request.Context(), userID, services.FeatureChat, reply.Model, reply.Usage); err != nil {
+		log.Printf("Failed to record AI usage for user %s: %v", userID.Hex(), err)
+	}
+
+	content := reply.Content
+	conversation.PendingAction = nil
+	if reply.Action != nil {
+		if meal, err := validateSwap(reply.Action, plans, meals, user.Slots()); err != nil {
+			content = fmt.Sprintf("I couldn't prepare that change: %v.", err)
+		} else {
+			reply.Action.Warnings = services.MealWarnings(*meal, rules)
+			conversation.PendingAction = reply.Action
+			if content == "" {
+				content = fmt.Sprintf("I can replace %s with %s for %s on %s. Would you like me to make this change?",
+					reply.Action.FromMeal, reply.Action.ToMeal, reply.Action.Slot, reply.Action.Date)
+			}
+			content += warningNote(reply.Action.Warnings)
+		}
+	}
+
+	conversation.Messages = append(conversation.Messages, models.ChatMessage{
+		Role:      "assistant",
+		Content:   content,
+		CreatedAt: time.Now(),
+	})
+	conversation.UpdatedAt = time.Now()
+
+	if conversation.ID.IsZero() {
+		result, err := cc.conversationCollection.InsertOne(context.Background(), conversation)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save conversation"})
+			return
+		}
+		conversation.ID = result.InsertedID.(primitive.ObjectID)
+	} else {
+		_, err = cc.conversationCollection.ReplaceOne(context.Background(), bson.M{"_id": conversation.ID}, conversation)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save conversation"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversation_id": conversation.ID,
+		"reply":           content,
+		"pending_action":  conversation.PendingAction,
+	})
+}
+
+// ListConversations returns the user's conversations without their messages, newest first
+func (cc *ChatController) ListConversations(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"updated_at": -1}).
+		SetProjection(bson.M{"messages": 0})
+
+	cursor, err := cc.conversationCollection.Find(context.Background(), bson.M{"user_id": userID}, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	conversations := []models.ChatConversation{}
+	if err := cursor.All(context.Background(), &conversations); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode conversations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversations": conversations})
+}
+
+// GetConversation returns a conversation with its full message history
+func (cc *ChatController) GetConversation(c *gin.Context) {
+	conversation, ok := cc.findConversation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, conversation)
+}
+
+// ConfirmAction applies the change the assistant proposed in a conversation
+func (cc *ChatController) ConfirmAction(c *gin.Context) {
+	conversation, ok := cc.findConversation(c)
+	if !ok {
+		return
+	}
+
+	action := conversation.PendingAction
+	if action == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending action to confirm"})
+		return
+	}
+
+	now := time.Now()
+	plan, err := cc.mealPlans.ForDate(context.Background(), conversation.UserID, action.Date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+	if plan == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		return
+	}
+
+	dailyMeals, exists := plan.Days[action.Date]
+	current, _ := dailyMeals.Get(action.Slot)
+	// Actions proposed before plans referenced meals by ID can only match by name
+	sameMeal := current.Name == action.FromMeal && (action.FromMealID.IsZero() || current.MealID == action.FromMealID)
+	if !exists || !sameMeal {
+		c.JSON(http.StatusConflict, gin.H{"error": "The meal plan changed since this action was proposed"})
+		return
+	}
+	if current.Locked {
+		c.JSON(http.StatusConflict, gin.H{"error": "This slot is locked, unlock it before changing it"})
+		return
+	}
+
+	if action.ToMealID.IsZero() {
+		c.JSON(http.StatusConflict, gin.H{"error": "This change was proposed before meals were referenced by ID, ask the assistant again"})
+		return
+	}
+	meal, err := cc.proposedMeal(action)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "The proposed meal is no longer available"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal"})
+		return
+	}
+
+	// The catalogue and the user's diet may have changed since the proposal
+	var user models.User
+	if err := cc.userCollection.FindOne(context.Background(), bson.M{"_id": conversation.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	recheck := *action
+	if _, err := validateSwap(&recheck, []models.MealPlan{*plan}, []models.Meal{*meal}, user.Slots()); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("This change can no longer be made: %v", err)})
+		return
+	}
+	if allowed, reason := services.UserDietaryProfile(user).Allows(*meal); !allowed {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s no longer fits your diet: %s", meal.Name, reason)})
+		return
+	}
+	rules, err := cc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+	warnings := services.MealWarnings(*meal, rules)
+
+	dailyMeals.Set(action.Slot, models.NewPlannedMeal(*meal))
+	reason := fmt.Sprintf("Swapped %s for %s at %s on %s in chat", action.FromMeal, action.ToMeal, action.Slot, action.Date)
+	if err := cc.mealPlans.SetDay(context.Background(), plan, action.Date, dailyMeals, now, reason, models.PlanSourceManual); err != nil {
+		respondPlanWriteError(c, err, "Failed to update meal plan")
+		return
+	}
+
+	content := fmt.Sprintf("Done! %s on %s is now %s.", action.Slot, action.Date, action.ToMeal)
+	if err := cc.resolveAction(conversation.ID, content); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": content, "date": action.Date, "meals": dailyMeals, "warnings": warnings})
+}
+
+// proposedMeal loads the meal an action swaps in by the ID it was proposed
+// with, so a meal renamed or replaced since is never swapped in by name
+func (cc *ChatController) proposedMeal(action *models.ChatAction) (*models.Meal, error) {
+	var meal models.Meal
+	if err := cc.mealCollection.FindOne(context.Background(), activeMealFilter(bson.M{"_id": action.ToMealID})).Decode(&meal); err != nil {
+		return nil, err
+	}
+	return &meal, nil
+}
+
+// CancelAction discards the change the assistant proposed in a conversation
+func (cc *ChatController) CancelAction(c *gin.Context) {
+	conversation, ok := cc.findConversation(c)
+	if !ok {
+		return
+	}
+
+	if conversation.PendingAction == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending action to cancel"})
+		return
+	}
+
+	content := "Okay, I've left your meal plan unchanged."
+	if err := cc.resolveAction(conversation.ID, content); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": content})
+}
+
+func (cc *ChatController) findConversation(c *gin.Context) (*models.ChatConversation, bool) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	conversationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return nil, false
+	}
+
+	var conversation models.ChatConversation
+	err = cc.conversationCollection.FindOne(context.Background(), bson.M{"_id": conversationID, "user_id": userID}).Decode(&conversation)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, false
+	}
+	return &conversation, true
+}
+
+// resolveAction clears the pending action and records the outcome as an assistant message
+func (cc *ChatController) resolveAction(conversationID primitive.ObjectID, content string) error {
+	now := time.Now()
+	_, err := cc.conversationCollection.UpdateOne(context.Background(),
+		bson.M{"_id": conversationID},
+		bson.M{
+			"$unset": bson.M{"pending_action": ""},
+			"$push":  bson.M{"messages": models.ChatMessage{Role: "assistant", Content: content, CreatedAt: now}},
+			"$set":   bson.M{"updated_at": now},
+		},
+	)
+	return err
+}
+
+// Plan days shown to the assistant, counted from the user's today
+const (
+	chatPlanDaysBefore = 7
+	chatPlanDaysAfter  = 21
+)
+
+// planWindow returns the user's plans around today, which the assistant can
+// discuss and change
+func (cc *ChatController) planWindow(userID primitive.ObjectID, today time.Time) ([]models.MealPlan, error) {
+	start := models.FormatDate(today.AddDate(0, 0, -chatPlanDaysBefore))
+	end := models.FormatDate(today.AddDate(0, 0, chatPlanDaysAfter))
+	plans, err := cc.mealPlans.Between(context.Background(), userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		for date := range plan.Days {
+			if date < start || date > end {
+				delete(plan.Days, date)
+			}
+		}
+	}
+	return plans, nil
+}
+
+// catalogue returns the meals the assistant may recommend to the user
+func (cc *ChatController) catalogue(user models.User) ([]models.Meal, error) {
+	filter := services.UserDietaryProfile(user).Apply(activeMealFilter(bson.M{}))
+
+	cursor, err := cc.mealCollection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var meals []models.Meal
+	if err := cursor.All(context.Background(), &meals); err != nil {
+		return nil, err
+	}
+	return meals, nil
+}
+
+func chatPlanDays(plans []models.MealPlan, slots []models.MealSlot) []services.ChatPlanDay {
+	days := map[string]models.DailyMeals{}
+	var dates []string
+	for _, plan := range plans {
+		for date, dailyMeals := range plan.Days {
+			days[date] = dailyMeals
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+
+	planDays := make([]services.ChatPlanDay, 0, len(dates))
+	for _, value := range dates {
+		date, err := models.ParseDate(value)
+		if err != nil {
+			continue
+		}
+		dailyMeals := days[value]
+		var planSlots []services.ChatPlanSlot
+		for _, slot := range dailyMeals.SlotNames(slots) {
+			planSlots = append(planSlots, services.ChatPlanSlot{Name: slot, Meal: dailyMeals[slot]})
+		}
+		planDays = append(planDays, services.ChatPlanDay{
+			Day:     date.Day(),
+			Date:    value,
+			Weekday: date.Weekday().String(),
+			Meals:   dailyMeals,
+			Slots:   planSlots,
+		})
+	}
+	return planDays
+}
+
+// validateSwap checks a proposed swap against the plan and catalogue, filling
+// in the meal being replaced. The proposed meal is the one with the action's
+// ID, or else its name within the category the slot is filled from, and it
+// must belong to that category. It returns the proposed meal.
+func validateSwap(action *models.ChatAction, plans []models.MealPlan, meals []models.Meal, slots []models.MealSlot) (*models.Meal, error) {
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("you don't have a meal plan for these dates yet")
+	}
+
+	var dailyMeals models.DailyMeals
+	exists := false
+	for _, plan := range plans {
+		if dailyMeals, exists = plan.Days[action.Date]; exists {
+			break
+		}
+	}
+	if !exists {
+		return nil, fmt.Errorf("there is no plan for %s", action.Date)
+	}
+
+	// A slot the user has since added can be filled on days planned without it
+	current, valid := dailyMeals.Get(action.Slot)
+	if _, configured := models.FindSlot(slots, action.Slot); !valid && !configured {
+		return nil, fmt.Errorf("%q is not a meal slot", action.Slot)
+	}
+	if current.Locked {
+		return nil, fmt.Errorf("%s on %s is locked", action.Slot, action.Date)
+	}
+
+	category := models.SlotCategory(slots, action.Slot)
+	var proposed, otherCategory *models.Meal
+	for i, meal := range meals {
+		switch {
+		case !action.ToMealID.IsZero():
+			if meal.ID == action.ToMealID {
+				proposed = &meals[i]
+			}
+		case meal.Name == action.ToMeal && meal.Category == category:
+			proposed = &meals[i]
+		case meal.Name == action.ToMeal && otherCategory == nil:
+			otherCategory = &meals[i]
+		}
+		if proposed != nil {
+			break
+		}
+	}
+	if proposed == nil && otherCategory != nil {
+		proposed = otherCategory
+	}
+	if proposed == nil {
+		return nil, fmt.Errorf("%q is not in the meal catalogue", action.ToMeal)
+	}
+	if proposed.Category != category {
+		return nil, fmt.Errorf("%s is a %s meal, but %s is filled from %s", proposed.Name, proposed.Category, action.Slot, category)
+	}
+
+	action.ToMealID = proposed.ID
+	action.FromMeal = current.Name
+	action.FromMealID = current.MealID
+	return proposed, nil
+}
+
+// warningNote appends condition warnings to the assistant's proposal
+func warningNote(warnings []models.NutritionWarning) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+	messages := make([]string, len(warnings))
+	for i, warning := range warnings {
+		messages[i] = warning.Message
+	}
+	return " Note: " + strings.Join(messages, "; ") + "."
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "..."
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"figorate/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authenticatedUserID reads the user ID set by the JWT middleware, writing an
+// error response and returning false when it is missing or malformed
+func authenticatedUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	userIDHex, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return primitive.NilObjectID, false
+	}
+
+	userIDStr, ok := userIDHex.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, false
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
+
+// respondPlanWriteError reports a failed meal plan write, as a conflict when
+// another request changed the plan since it was read
+func respondPlanWriteError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrPlanConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The meal plan was changed by another request, reload it and try again"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"figorate/database"
+	"figorate/helpers"
+	"figorate/models"
+	"figorate/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type DiaryController struct {
+	userCollection *mongo.Collection
+	mealCollection *mongo.Collection
+	mealPlans      *services.MealPlanStore
+	foodLog        *services.FoodLogStore
+	recipeService  *services.RecipeService
+	pantry         *services.PantryStore
+}
+
+func NewDiaryController() *DiaryController {
+	foodLog := services.NewFoodLogStore(database.GetDatabase().Collection("food_log"))
+	if err := foodLog.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("Food log indexes not created: %v", err)
+	}
+
+	return &DiaryController{
+		userCollection: database.GetDatabase().Collection("users"),
+		mealCollection: database.GetDatabase().Collection("meals"),
+		mealPlans:      services.NewMealPlanStore(database.GetDatabase().Collection("meal_plans"), database.GetDatabase().Collection("meal_plan_versions")),
+		foodLog:        foodLog,
+		recipeService:  services.NewRecipeService(database.GetDatabase().Collection("recipes"), database.GetDatabase().Collection("ingredients"), database.GetDatabase().Collection("meals")),
+		pantry:         services.NewPantryStore(database.GetDatabase().Collection("pantry_items")),
+	}
+}
+
+// diaryUser loads the authenticated user, answering 404 when they are gone
+func (dc *DiaryController) diaryUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return nil, false
+	}
+	var user models.User
+	if err := dc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// diaryDate reads the date in the URL like plan dates. Food can't be logged
+// for days that haven't happened yet.
+func diaryDate(c *gin.Context, user *models.User) (string, bool) {
+	today := user.Today(time.Now())
+	date, err := planDate(c.Param("date"), today)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if date > models.FormatDate(today) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Food can't be logged for future dates"})
+		return "", false
+	}
+	return date, true
+}
+
+// foodMeal resolves the catalogue meal a food request names, if it names one
+func (dc *DiaryController) foodMeal(c *gin.Context, request models.FoodRequest) (*models.Meal, bool) {
+	if request.MealID == "" {
+		if strings.TrimSpace(request.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Either meal_id or name is required"})
+			return nil, false
+		}
+		return nil, true
+	}
+	mealID, err := primitive.ObjectIDFromHex(request.MealID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
+		return nil, false
+	}
+	var meal models.Meal
+	if err := dc.mealCollection.FindOne(context.Background(), activeMealFilter(bson.M{"_id": mealID})).Decode(&meal); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal not found"})
+		return nil, false
+	}
+	return &meal, true
+}
+
+// cook takes the ingredients of the entry's meal out of the user's pantry and
+// records what was used. previous is what the slot had logged before: the same
+// meal logged again isn't taken from the pantry twice. It returns what was
+// newly taken, for settleCooking once the entry is saved. Clearing or deleting
+// an entry doesn't put anything back.
+func (dc *DiaryController) cook(ctx context.Context, entry *models.FoodLogEntry, previous *models.FoodLogEntry, today time.Time) ([]models.PantryUse, error) {
+	entry.Cooked = true
+	if entry.MealID.IsZero() {
+		return nil, nil
+	}
+	if previous != nil && previous.Cooked && previous.MealID == entry.MealID {
+		entry.PantryUsed = previous.PantryUsed
+		return nil, nil
+	}
+
+	recipes, err := dc.recipeService.RecipesForMeals(ctx, []primitive.ObjectID{entry.MealID})
+	if err != nil {
+		return nil, err
+	}
+	recipe, exists := recipes[entry.MealID]
+	if !exists {
+		return nil, nil
+	}
+	ingredients, err := dc.recipeService.LoadIngredients(ctx, recipe)
+	if err != nil {
+		return nil, err
+	}
+	entry.PantryUsed, err = dc.pantry.Cook(ctx, entry.UserID, recipe, ingredients, entry.Portion, today, entry.UpdatedAt)
+	return entry.PantryUsed, err
+}
+
+// settleCooking removes the pantry items cooking used up once its entry is
+// saved, or puts back what was taken when saving failed
+func (dc *DiaryController) settleCooking(ctx context.Context, userID primitive.ObjectID, taken []models.PantryUse, saved bool, now time.Time) {
+	if len(taken) == 0 {
+		return
+	}
+	var err error
+	if saved {
+		err = dc.pantry.RemoveEmpty(ctx, userID, taken)
+	} else {
+		err = dc.pantry.Restore(ctx, userID, taken, now)
+	}
+	if err != nil {
+		log.Printf("Failed to settle pantry after cooking: %v", err)
+	}
+}
+
+// GetDiaryDay returns a date's diary: each planned slot with what was logged
+// for it, off plan food, and the day's totals against the user's targets
+func (dc *DiaryController) GetDiaryDay(c *gin.Context) {
+	user, ok := dc.diaryUser(c)
+	if !ok {
+		return
+	}
+	date, ok := diaryDate(c, user)
+	if !ok {
+		return
+	}
+
+	mealPlan, err := dc.mealPlans.ForDate(context.Background(), user.ID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+	entries, err := dc.foodLog.Between(context.Background(), user.ID, date, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food log"})
+		return
+	}
+
+	days := map[string]models.DailyMeals{}
+	if mealPlan != nil {
+		days[date] = mealPlan.Days[date]
+	}
+	stats := services.Adherence(days, entries, date, date, user.NutritionTargets, services.TargetTolerance())
+
+	logged := map[string]models.FoodLogEntry{}
+	for _, entry := range entries {
+		if entry.Status != models.FoodOffPlan {
+			logged[entry.Slot] = entry
+		}
+	}
+	slots := []gin.H{}
+	for _, slot := range days[date].SlotNames(user.Slots()) {
+		response := gin.H{"slot": slot, "planned": days[date][slot]}
+		if entry, exists := logged[slot]; exists {
+			response["logged"] = entry
+		}
+		slots = append(slots, response)
+	}
+
+	day := stats.Days[0]
+	response := gin.H{
+		"date":      date,
+		"slots":     slots,
+		"entries":   entries,
+		"totals":    day.Totals,
+		"adherence": day,
+	}
+	if user.NutritionTargets != nil {
+		response["targets"] = user.NutritionTargets
+		response["calories_left"] = user.NutritionTargets.Calories - day.Totals.Calories
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// LogPlanSlot marks a planned slot as eaten, skipped or replaced. Meals
+// marked cooked are taken out of the user's pantry.
+func (dc *DiaryController) LogPlanSlot(c *gin.Context) {
+	user, ok := dc.diaryUser(c)
+	if !ok {
+		return
+	}
+	date, ok := diaryDate(c, user)
+	if !ok {
+		return
+	}
+
+	var request models.LogSlotRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	slot := c.Param("slot")
+	mealPlan, err := dc.mealPlans.ForDate(context.Background(), user.ID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+	var planned models.PlannedMeal
+	if mealPlan != nil {
+		planned, _ = mealPlan.Days[date].Get(slot)
+	}
+	if planned.IsEmpty() || planned.Status != "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No meal planned for %s on %s", slot, date)})
+		return
+	}
+
+	now := time.Now()
+	entry := models.FoodLogEntry{UserID: user.ID, Date: date, Slot: slot, Status: request.Status, Planned: &planned, UpdatedAt: now}
+	switch request.Status {
+	case models.FoodEaten:
+		// The planned meal as it is now, or as planned if it has since been deleted
+		var meal *models.Meal
+		var current models.Meal
+		if err := dc.mealCollection.FindOne(context.Background(), bson.M{"_id": planned.MealID}).Decode(&current); err == nil {
+			meal = &current
+		}
+		services.SetFood(&entry, meal, models.FoodRequest{Name: planned.Name, Calories: planned.Calories, Portion: request.Portion}, now)
+	case models.FoodReplaced:
+		meal, ok := dc.foodMeal(c, request.FoodRequest)
+		if !ok {
+			return
+		}
+		services.SetFood(&entry, meal, request.FoodRequest, now)
+	case models.FoodSkipped:
+		entry.Portion = 0
+	}
+
+	var taken []models.PantryUse
+	if request.Cooked && request.Status != models.FoodSkipped {
+		previous, err := dc.foodLog.SlotEntry(context.Background(), user.ID, date, slot)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch food log"})
+			return
+		}
+		if taken, err = dc.cook(context.Background(), &entry, previous, user.Today(now)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pantry"})
+			return
+		}
+	}
+
+	err = dc.foodLog.SetSlot(context.Background(), &entry)
+	dc.settleCooking(context.Background(), user.ID, taken, err == nil, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log meal"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// ClearPlanSlot removes what was logged for a planned slot
+func (dc *DiaryController) ClearPlanSlot(c *gin.Context) {
+	user, ok := dc.diaryUser(c)
+	if !ok {
+		return
+	}
+	date, ok := diaryDate(c, user)
+	if !ok {
+		return
+	}
+
+	cleared, err := dc.foodLog.ClearSlot(context.Background(), user.ID, date, c.Param("slot"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear slot"})
+		return
+	}
+	if !cleared {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nothing logged for this slot"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Slot cleared"})
+}
+
+// LogFood logs food eaten off plan, from the catalogue or described by name
+// and calories. Meals marked cooked are taken out of the user's pantry.
+func (dc *DiaryController) LogFood(c *gin.Context) {
+	user, ok := dc.diaryUser(c)
+	if !ok {
+		return
+	}
+	date, ok := diaryDate(c, user)
+	if !ok {
+		return
+	}
+
+	var request models.LogFoodRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if request.Slot != "" {
+		if _, ok := models.FindSlot(user.Slots(), request.Slot); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q is not one of your meal slots", request.Slot)})
+			return
+		}
+	}
+	meal, ok := dc.foodMeal(c, request.FoodRequest)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	entry := models.FoodLogEntry{UserID: user.ID, Date: date, Slot: request.Slot, Status: models.FoodOffPlan}
+	services.SetFood(&entry, meal, request.FoodRequest, now)
+	var taken []models.PantryUse
+	if request.Cooked {
+		var err error
+		if taken, err = dc.cook(context.Background(), &entry, nil, user.Today(now)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pantry"})
+			return
+		}
+	}
+	err := dc.foodLog.Add(context.Background(), &entry)
+	dc.settleCooking(context.Background(), user.ID, taken, err == nil, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log food"})
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// DeleteDiaryEntry removes one entry from the user's diary
+func (dc *DiaryController) DeleteDiaryEntry(c *gin.Context) {
+	user, ok := dc.diaryUser(c)
+	if !ok {
+		return
+	}
+	entryID, err := primitive.ObjectIDFromHex(c.Param("entryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+		return
+	}
+
+	deleted, err := dc.foodLog.Delete(context.Background(), user.ID, entryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete entry"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Entry deleted"})
+}
+
+// GetAdherence reports how closely the user followed their plan over the
+// week (Monday to Sunday) or month holding ?date=, today by default. Days
+// after today are left out.
+func (dc *DiaryController) GetAdherence(c *gin.Context) {
+	user, ok := dc.diaryUser(c)
+	if !ok {
+		return
+	}
+
+	today := user.Today(time.Now())
+	day := today
+	if value := c.Query("date"); value != "" {
+		date, err := planDate(value, today)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		day, _ = models.ParseDate(date)
+	}
+
+	period := c.DefaultQuery("period", "week")
+	var first, last time.Time
+	switch period {
+	case "week":
+		first, last = models.WeekRange(day)
+	case "month":
+		first, last = models.MonthRange(day)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be week or month"})
+		return
+	}
+	if last.After(today) {
+		last = today
+	}
+	if first.After(last) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The period hasn't started yet"})
+		return
+	}
+
+	stats, err := userAdherence(c.Request.Context(), dc.mealPlans, dc.foodLog, *user, models.FormatDate(first), models.FormatDate(last))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute adherence"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"period": period, "adherence": stats})
+}
+
+// userAdherence measures the user's diary from start to end against their plans
+func userAdherence(ctx context.Context, mealPlans *services.MealPlanStore, foodLog *services.FoodLogStore, user models.User, start, end string) (services.AdherenceStats, error) {
+	plans, err := mealPlans.Between(ctx, user.ID, start, end)
+	if err != nil {
+		return services.AdherenceStats{}, err
+	}
+	entries, err := foodLog.Between(ctx, user.ID, start, end)
+	if err != nil {
+		return services.AdherenceStats{}, err
+	}
+	return services.Adherence(models.DaysInRange(plans, start, end), entries, start, end, user.NutritionTargets, services.TargetTolerance()), nil
+}
@@ -0,0 +1,372 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"figorate/database"
+	"figorate/foodimport"
+	"figorate/helpers"
+	"figorate/models"
+	"figorate/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IngredientController struct {
+	ingredientCollection *mongo.Collection
+	recipeCollection     *mongo.Collection
+	mealAuditCollection  *mongo.Collection
+	recipeService        *services.RecipeService
+	planCache            *services.MealPlanCache
+}
+
+func NewIngredientController() *IngredientController {
+	db := database.GetDatabase()
+	if err := foodimport.NewImporter(db.Collection("ingredients")).EnsureIndexes(context.Background()); err != nil {
+		log.Printf("Ingredient indexes not created: %v", err)
+	}
+	return &IngredientController{
+		ingredientCollection: db.Collection("ingredients"),
+		recipeCollection:     db.Collection("recipes"),
+		mealAuditCollection:  db.Collection("meal_audit_logs"),
+		recipeService:        services.NewRecipeService(db.Collection("recipes"), db.Collection("ingredients"), db.Collection("meals")),
+		planCache:            services.NewMealPlanCache(db.Collection("meal_plan_cache")),
+	}
+}
+
+// ListIngredients pages through ingredients, optionally filtered by name and category
+func (ic *IngredientController) ListIngredients(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := bson.M{}
+	if q := c.Query("q"); q != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	}
+	if category := c.Query("category"); category != "" {
+		filter["category"] = category
+	}
+
+	total, err := ic.ingredientCollection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count ingredients"})
+		return
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := ic.ingredientCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	ingredients := []models.Ingredient{}
+	if err := cursor.All(context.Background(), &ingredients); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode ingredients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ingredients": ingredients,
+		"pagination": gin.H{
+			"current_page": page,
+			"limit":        limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+func (ic *IngredientController) GetIngredient(c *gin.Context) {
+	ingredientID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+		return
+	}
+
+	var ingredient models.Ingredient
+	err = ic.ingredientCollection.FindOne(context.Background(), bson.M{"_id": ingredientID}).Decode(&ingredient)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredient"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ingredient)
+}
+
+func (ic *IngredientController) CreateIngredient(c *gin.Context) {
+	var request models.IngredientRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if err := helpers.ValidateAllergens(request.Allergens); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ic.ingredientExists(request.Name, primitive.NilObjectID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ingredient already exists"})
+		return
+	}
+
+	now := time.Now()
+	ingredient := models.Ingredient{
+		ID:               primitive.NewObjectID(),
+		Name:             request.Name,
+		Category:         request.Category,
+		CaloriesPer100g:  request.CaloriesPer100g,
+		NutritionPer100g: request.NutritionPer100g,
+		DensityGPerML:    request.DensityGPerML,
+		GramsPerPiece:    request.GramsPerPiece,
+		Allergens:        request.Allergens,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	_, err := ic.ingredientCollection.InsertOne(context.Background(), ingredient)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ingredient"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ingredient)
+}
+
+// UpdateIngredient replaces an ingredient and recalculates every meal whose recipe uses it
+func (ic *IngredientController) UpdateIngredient(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	ingredientID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+		return
+	}
+
+	var request models.IngredientRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if err := helpers.ValidateAllergens(request.Allergens); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ingredient models.Ingredient
+	err = ic.ingredientCollection.FindOne(context.Background(), bson.M{"_id": ingredientID}).Decode(&ingredient)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+		return
+	}
+
+	if request.Name != ingredient.Name && ic.ingredientExists(request.Name, ingredientID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ingredient already exists"})
+		return
+	}
+
+	ingredient.Name = request.Name
+	ingredient.Category = request.Category
+	ingredient.CaloriesPer100g = request.CaloriesPer100g
+	ingredient.NutritionPer100g = request.NutritionPer100g
+	ingredient.DensityGPerML = request.DensityGPerML
+	ingredient.GramsPerPiece = request.GramsPerPiece
+	ingredient.Allergens = request.Allergens
+	ingredient.UpdatedAt = time.Now()
+
+	// Nothing is saved unless every recipe using the ingredient still computes
+	recipes, err := ic.recipeService.CheckIngredientUpdate(context.Background(), ingredient)
+	var recipeErr *services.RecipeError
+	if errors.As(err, &recipeErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": recipeErr.Error(), "meal_id": recipeErr.Recipe.MealID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check recipes"})
+		return
+	}
+
+	_, err = ic.ingredientCollection.ReplaceOne(context.Background(), bson.M{"_id": ingredientID}, ingredient)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ingredient"})
+		return
+	}
+
+	recalculated, err := ic.recalculateMeals(recipes, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ingredient updated but meal nutrition could not be recalculated"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ingredient": ingredient, "meals_recalculated": recalculated})
+}
+
+// DeleteIngredient removes an ingredient that no recipe uses
+func (ic *IngredientController) DeleteIngredient(c *gin.Context) {
+	ingredientID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+		return
+	}
+
+	inUse, err := ic.recipeCollection.CountDocuments(context.Background(), bson.M{"ingredients.ingredient_id": ingredientID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check recipes"})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ingredient is used by recipes", "recipes": inUse})
+		return
+	}
+
+	result, err := ic.ingredientCollection.DeleteOne(context.Background(), bson.M{"_id": ingredientID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ingredient"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ingredient deleted successfully"})
+}
+
+// maxUnmappedReported caps the unmapped rows echoed back by an import
+const maxUnmappedReported = 100
+
+// ImportIngredients streams an uploaded food composition file into the
+// ingredients collection. Form fields: format (usda_json, usda_csv or csv),
+// file, or food and food_nutrient for usda_csv, mapping (JSON) for csv, and dry_run.
+func (ic *IngredientController) ImportIngredients(c *gin.Context) {
+	format := c.PostForm("format")
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+	var files []multipart.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	openUpload := func(field string) (multipart.File, error) {
+		header, err := c.FormFile(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is required for format %s", field, format)
+		}
+		f, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s upload", field)
+		}
+		files = append(files, f)
+		return f, nil
+	}
+
+	var reader foodimport.Reader
+	var err error
+	switch format {
+	case "usda_json":
+		var f multipart.File
+		if f, err = openUpload("file"); err == nil {
+			reader = foodimport.NewUSDAJSONReader(f)
+		}
+	case "usda_csv":
+		var foods, nutrients multipart.File
+		if foods, err = openUpload("food"); err == nil {
+			if nutrients, err = openUpload("food_nutrient"); err == nil {
+				reader, err = foodimport.NewUSDACSVReader(foods, nutrients)
+			}
+		}
+	case "csv":
+		var mapping foodimport.CSVMapping
+		if err = json.Unmarshal([]byte(c.PostForm("mapping")), &mapping); err != nil {
+			err = fmt.Errorf("mapping must be a JSON column mapping")
+		} else {
+			var f multipart.File
+			if f, err = openUpload("file"); err == nil {
+				reader, err = foodimport.NewMappedCSVReader(f, mapping)
+			}
+		}
+	default:
+		err = fmt.Errorf("format must be one of usda_json, usda_csv, csv")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	importer := foodimport.NewImporter(ic.ingredientCollection)
+	importer.DryRun = dryRun
+	unmapped := []foodimport.UnmappedError{}
+	importer.OnUnmapped = func(row foodimport.UnmappedError) {
+		if len(unmapped) < maxUnmappedReported {
+			unmapped = append(unmapped, row)
+		}
+	}
+
+	summary, err := importer.Run(c.Request.Context(), reader)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "summary": summary, "unmapped": unmapped})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"summary": summary, "unmapped": unmapped})
+}
+
+func (ic *IngredientController) ingredientExists(name string, excludeID primitive.ObjectID) bool {
+	filter := bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(name) + "$", "$options": "i"}}
+	if !excludeID.IsZero() {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+	count, err := ic.ingredientCollection.CountDocuments(context.Background(), filter)
+	return err == nil && count > 0
+}
+
+// recalculateMeals saves the recomputed nutrition of the meals of recipes
+func (ic *IngredientController) recalculateMeals(recipes []models.Recipe, userID primitive.ObjectID) (int, error) {
+	for _, recipe := range recipes {
+		before, after, err := ic.recipeService.ApplyToMeal(context.Background(), recipe, userID)
+		if err != nil {
+			return 0, err
+		}
+		recordMealAudit(ic.mealAuditCollection, recipe.MealID, userID, "recalculate", models.DiffMeals(*before, *after))
+	}
+
+	if len(recipes) > 0 {
+		if err := ic.planCache.Invalidate(context.Background()); err != nil {
+			log.Printf("Failed to invalidate meal plan cache: %v", err)
+		}
+	}
+	return len(recipes), nil
+}
@@ -2,276 +2,2139 @@ package controllers
 
 import (
 	"context"
+	"figorate/catalogue"
 	"figorate/database"
+	"figorate/helpers"
 	"figorate/models"
 	"figorate/services"
 	"fmt"
-	"math/rand"
+	"io"
+	"log"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MealController struct {
-	mealCollection     *mongo.Collection
-	mealPlanCollection *mongo.Collection
-	userCollection     *mongo.Collection
+	mealCollection      *mongo.Collection
+	mealAuditCollection *mongo.Collection
+	recipeCollection    *mongo.Collection
+	mealPlans           *services.MealPlanStore
+	foodLog             *services.FoodLogStore
+	pantry              *services.PantryStore
+	userCollection      *mongo.Collection
+	usageService        *services.UsageService
+	promptStore         *services.PromptStore
+	planCache           *services.MealPlanCache
+	recipeService       *services.RecipeService
+	conditionRules      *services.ConditionRuleService
+	images              *services.ImageService
 }
 
 func NewMealController() *MealController {
+	planCache := services.NewMealPlanCache(database.GetDatabase().Collection("meal_plan_cache"))
+	if err := planCache.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("Meal plan cache indexes not created: %v", err)
+	}
+
+	mealCollection := database.GetDatabase().Collection("meals")
+	if err := ensureMealIndexes(mealCollection); err != nil {
+		log.Printf("Meal indexes not created: %v", err)
+	}
+
+	usageService := services.NewUsageService(database.GetDatabase().Collection("ai_usage"), database.GetDatabase().Collection("ai_quotas"))
+	if err := usageService.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("AI quota indexes not created: %v", err)
+	}
+
+	mealPlans := services.NewMealPlanStore(
+		database.GetDatabase().Collection("meal_plans"),
+		database.GetDatabase().Collection("meal_plan_versions"),
+	)
+	if err := mealPlans.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("Meal plan indexes not created: %v", err)
+	}
+
 	return &MealController{
-		mealCollection:     database.GetDatabase().Collection("meals"),
-		mealPlanCollection: database.GetDatabase().Collection("meal_plans"),
-		userCollection:     database.GetDatabase().Collection("users"),
+		mealCollection:      mealCollection,
+		mealAuditCollection: database.GetDatabase().Collection("meal_audit_logs"),
+		recipeCollection:    database.GetDatabase().Collection("recipes"),
+		mealPlans:           mealPlans,
+		foodLog:             services.NewFoodLogStore(database.GetDatabase().Collection("food_log")),
+		pantry:              services.NewPantryStore(database.GetDatabase().Collection("pantry_items")),
+		userCollection:      database.GetDatabase().Collection("users"),
+		usageService:        usageService,
+		promptStore:         services.NewPromptStore(os.Getenv("PROMPTS_DIR"), database.GetDatabase().Collection("prompt_templates")),
+		planCache:           planCache,
+		recipeService: services.NewRecipeService(
+			database.GetDatabase().Collection("recipes"),
+			database.GetDatabase().Collection("ingredients"),
+			mealCollection,
+		),
+		conditionRules: services.NewConditionRuleService(database.GetDatabase().Collection("condition_rules")),
+		images:         newImageService(),
 	}
 }
 
-func (mc *MealController) AddMeal(c *gin.Context) {
-	var meal models.Meal
-	if err := c.ShouldBindJSON(&meal); err != nil {
+// expiringPantry returns the ingredients in the user's pantry that expire soon
+func (mc *MealController) expiringPantry(ctx context.Context, user models.User, today time.Time) ([]primitive.ObjectID, error) {
+	items, err := mc.pantry.Items(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return services.ExpiringIngredients(items, today), nil
+}
+
+// ensureMealIndexes creates the text index backing search and the indexes used by filters and sorts
+func ensureMealIndexes(collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetWeights(bson.M{"name": 10, "description": 2}).SetName("meal_text"),
+		},
+		{Keys: bson.D{{Key: "category", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "calories", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "prep_time", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+	})
+	return err
+}
+
+// activeMealFilter restricts a meal query to meals that have not been soft deleted
+func activeMealFilter(filter bson.M) bson.M {
+	filter["deleted_at"] = nil
+	return filter
+}
+
+// CreateMeal adds a meal to the catalogue
+func (mc *MealController) CreateMeal(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var request models.MealRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if err := helpers.ValidateMealTags(request.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := helpers.ValidateAllergens(request.Allergens); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if mc.mealExists(request.Name, request.Category, primitive.NilObjectID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A meal with this name already exists in this category"})
+		return
 	}
-	meal.CreatedAt = time.Now()
-	result, err := mc.mealCollection.InsertOne(context.Background(), meal)
+
+	now := time.Now()
+	meal := models.Meal{
+		ID:          primitive.NewObjectID(),
+		Name:        request.Name,
+		Description: request.Description,
+		Image:       request.Image,
+		Calories:    request.Calories,
+		Nutrition:   request.Nutrition,
+		Preptime:    request.Preptime,
+		Category:    request.Category,
+		Tags:        request.Tags,
+		CreatedBy:   userID,
+		UpdatedBy:   userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	meal.SetAllergens(request.Allergens, nil)
+
+	_, err := mc.mealCollection.InsertOne(context.Background(), meal)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add meal"})
 		return
 	}
 
-	meal.ID = result.InsertedID.(primitive.ObjectID)
+	recordMealAudit(mc.mealAuditCollection, meal.ID, userID, "create", models.DiffMeals(models.Meal{}, meal))
+	mc.invalidatePlanCache()
+
 	c.JSON(http.StatusCreated, meal)
+}
+
+// GetMeal returns a single meal from the catalogue
+func (mc *MealController) GetMeal(c *gin.Context) {
+	mealID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
+		return
+	}
+
+	meal, err := mc.findMeal(mealID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meal not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal"})
+		return
+	}
+
+	rules, err := mc.userConditionRules(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
 
+	c.JSON(http.StatusOK, models.MealWithWarnings{Meal: *meal, Warnings: services.MealWarnings(*meal, rules)})
 }
 
-func (mc *MealController) GenerateMealPlan(c *gin.Context) {
+// userConditionRules loads the condition rules for the authenticated user
+func (mc *MealController) userConditionRules(c *gin.Context) ([]models.ConditionRule, error) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		return nil, err
+	}
+	return mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+}
+
+// authenticatedUser loads the user making the request
+func (mc *MealController) authenticatedUser(c *gin.Context) (*models.User, error) {
 	userIDHex, _ := c.Get("user_id")
 	userID, _ := primitive.ObjectIDFromHex(userIDHex.(string))
 
 	var user models.User
-	err := mc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
-	if err != nil {
+	if err := mc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// mealSortFields maps the public sort names to document fields
+var mealSortFields = map[string]string{
+	"name":       "name",
+	"calories":   "calories",
+	"prep_time":  "prep_time",
+	"created_at": "created_at",
+}
+
+// SearchMeals browses the catalogue with filters, full-text search, sorting and
+// keyset (cursor) pagination. Cursors encode the last meal's sort value and ID,
+// so pages stay stable while meals are added or removed.
+func (mc *MealController) SearchMeals(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+	var user models.User
+	if err := mc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	filter := bson.M{
-		"tags": bson.M{
-			"$in": []string{user.NutritionPreference},
-		},
+	conditions := []bson.M{activeMealFilter(bson.M{})}
+
+	// Results never include meals the user's allergens or restrictions rule out.
+	// Admins curating the catalogue can opt out with unrestricted=true.
+	if !(user.Role == "admin" && c.Query("unrestricted") == "true") {
+		conditions = append(conditions, services.UserDietaryProfile(user).Conditions()...)
 	}
-	var meals []models.Meal
-	cursor, err := mc.mealCollection.Find(context.Background(), filter)
+
+	if categories := splitQuery(c.Query("category")); len(categories) > 0 {
+		conditions = append(conditions, bson.M{"category": bson.M{"$in": categories}})
+	}
+
+	if tags := splitQuery(c.Query("tags")); len(tags) > 0 {
+		operator := "$all"
+		if c.DefaultQuery("tags_mode", "all") == "any" {
+			operator = "$in"
+		}
+		conditions = append(conditions, bson.M{"tags": bson.M{operator: tags}})
+	}
+
+	if allergens := splitQuery(c.Query("exclude_allergens")); len(allergens) > 0 {
+		conditions = append(conditions, bson.M{"allergens": bson.M{"$nin": allergens}})
+	}
+
+	for _, r := range []struct{ field, minParam, maxParam string }{
+		{"calories", "min_calories", "max_calories"},
+		{"prep_time", "min_prep_time", "max_prep_time"},
+	} {
+		bounds := bson.M{}
+		for param, operator := range map[string]string{r.minParam: "$gte", r.maxParam: "$lte"} {
+			raw := c.Query(param)
+			if raw == "" {
+				continue
+			}
+			value, err := strconv.Atoi(raw)
+			if err != nil || value < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a non-negative integer"})
+				return
+			}
+			bounds[operator] = value
+		}
+		if len(bounds) > 0 {
+			conditions = append(conditions, bson.M{r.field: bounds})
+		}
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		conditions = append(conditions, bson.M{"$text": bson.M{"$search": q}})
+	}
+
+	// Sort is a field name, prefixed with - for descending
+	sortParam := c.DefaultQuery("sort", "name")
+	direction := 1
+	sortName := sortParam
+	if strings.HasPrefix(sortParam, "-") {
+		direction = -1
+		sortName = strings.TrimPrefix(sortParam, "-")
+	}
+	sortField, valid := mealSortFields[sortName]
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of: name, calories, prep_time, created_at (prefix with - for descending)"})
+		return
+	}
+
+	if cursorParam := c.Query("cursor"); cursorParam != "" {
+		after, err := mealCursorCondition(cursorParam, sortParam, sortField, direction)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		conditions = append(conditions, after)
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := mc.mealCollection.Find(context.Background(), bson.M{"$and": conditions}, findOptions)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search meals"})
 		return
 	}
 	defer cursor.Close(context.Background())
 
+	meals := []models.Meal{}
 	if err := cursor.All(context.Background(), &meals); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to  process meal"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode meals"})
 		return
 	}
 
-	// Initialize AI service
-	aiService := services.NewAIService(os.Getenv("OPENAI_API_KEY"))
+	hasMore := len(meals) > limit
+	var nextCursor string
+	if hasMore {
+		meals = meals[:limit]
+		last := meals[len(meals)-1]
+		nextCursor, err = helpers.EncodeCursor(models.MealSearchCursor{
+			Sort:  sortParam,
+			Value: mealSortValue(last, sortField),
+			ID:    last.ID.Hex(),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build cursor"})
+			return
+		}
+	}
 
-	now := time.Now()
-	daysInMonth := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+	results := make([]models.MealWithWarnings, 0, len(meals))
+	for _, meal := range meals {
+		results = append(results, models.MealWithWarnings{Meal: meal, Warnings: services.MealWarnings(meal, rules)})
+	}
 
-	// Generate meal plan using AI
-	mealPlanDays, err := aiService.GenerateMealPlan(c.Request.Context(), services.MealPlanRequest{
-		UserPreference: user.NutritionPreference,
-		AvailableMeals: meals,
-		DaysToGenerate: daysInMonth,
+	c.JSON(http.StatusOK, gin.H{
+		"meals":       results,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
 	})
-	fmt.Print("meal plan generated ",mealPlanDays)
+}
+
+// mealCursorCondition matches meals that sort strictly after the cursor position
+func mealCursorCondition(cursorParam, sortParam, sortField string, direction int) (bson.M, error) {
+	var position models.MealSearchCursor
+	if err := helpers.DecodeCursor(cursorParam, &position); err != nil {
+		return nil, err
+	}
+	if position.Sort != sortParam {
+		return nil, fmt.Errorf("cursor was issued for a different sort order")
+	}
+
+	lastID, err := primitive.ObjectIDFromHex(position.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate meal plan: %v", err)})
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	value := position.Value
+	if sortField == "created_at" {
+		raw, _ := value.(string)
+		createdAt, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		value = createdAt
+	}
+
+	operator := "$gt"
+	if direction < 0 {
+		operator = "$lt"
+	}
+	return bson.M{"$or": []bson.M{
+		{sortField: bson.M{operator: value}},
+		{sortField: value, "_id": bson.M{operator: lastID}},
+	}}, nil
+}
+
+func mealSortValue(meal models.Meal, sortField string) interface{} {
+	switch sortField {
+	case "calories":
+		return meal.Calories
+	case "prep_time":
+		return meal.Preptime
+	case "created_at":
+		return meal.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return meal.Name
+}
+
+// splitQuery parses a comma separated query parameter, ignoring blanks
+func splitQuery(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// UpdateMeal replaces every editable field of a meal (PUT)
+func (mc *MealController) UpdateMeal(c *gin.Context) {
+	var request models.MealRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
 		return
 	}
 
-	// Create monthly meal plan
-	monthlyPlan := models.MonthlyMealPlan{
-		UserID:    userID,
-		Month:     int(now.Month()),
-		Year:      now.Year(),
-		Days:      mealPlanDays,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-
-	// Save the meal plan
-	_, err = mc.mealPlanCollection.DeleteMany(context.Background(), bson.M{
-		"user_id": userID,
-		"month":   monthlyPlan.Month,
-		"year":    monthlyPlan.Year,
+	mc.applyMealUpdate(c, func(meal *models.Meal) {
+		meal.Name = request.Name
+		meal.Description = request.Description
+		meal.Image = request.Image
+		meal.Calories = request.Calories
+		meal.Nutrition = request.Nutrition
+		meal.Preptime = request.Preptime
+		meal.Category = request.Category
+		meal.Tags = request.Tags
+		meal.SetAllergens(request.Allergens, meal.IngredientAllergens)
 	})
+}
+
+// PatchMeal updates only the fields present in the request (PATCH)
+func (mc *MealController) PatchMeal(c *gin.Context) {
+	var request models.UpdateMealRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	mc.applyMealUpdate(c, func(meal *models.Meal) {
+		if request.Name != nil {
+			meal.Name = *request.Name
+		}
+		if request.Description != nil {
+			meal.Description = *request.Description
+		}
+		if request.Image != nil {
+			meal.Image = *request.Image
+		}
+		if request.Calories != nil {
+			meal.Calories = *request.Calories
+		}
+		if request.Nutrition != nil {
+			meal.Nutrition = *request.Nutrition
+		}
+		if request.Preptime != nil {
+			meal.Preptime = *request.Preptime
+		}
+		if request.Category != nil {
+			meal.Category = *request.Category
+		}
+		if request.Tags != nil {
+			meal.Tags = *request.Tags
+		}
+		if request.Allergens != nil {
+			meal.SetAllergens(*request.Allergens, meal.IngredientAllergens)
+		}
+	})
+}
+
+// DeleteMeal soft deletes a meal so existing plans and audit history keep their references
+func (mc *MealController) DeleteMeal(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	mealID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear existing meal plan"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
 		return
 	}
 
-	result, err := mc.mealPlanCollection.InsertOne(context.Background(), monthlyPlan)
+	now := time.Now()
+	result, err := mc.mealCollection.UpdateOne(context.Background(),
+		activeMealFilter(bson.M{"_id": mealID}),
+		bson.M{"$set": bson.M{"deleted_at": now, "updated_at": now, "updated_by": userID}},
+	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save meal plan"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete meal"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal not found"})
 		return
 	}
 
-	monthlyPlan.ID = result.InsertedID.(primitive.ObjectID)
-	c.JSON(http.StatusCreated, monthlyPlan)
+	recordMealAudit(mc.mealAuditCollection, mealID, userID, "delete", nil)
+	mc.invalidatePlanCache()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Meal deleted successfully"})
 }
 
-// GetDailyMealPlan fetches a user's meal plan for a specific day
-func (mc *MealController) GetDailyMealPlan(c *gin.Context) {
-	userIDHex, _ := c.Get("user_id")
-	userID, _ := primitive.ObjectIDFromHex(userIDHex.(string))
+// GetMealAudit lists the change history of a meal, newest first
+func (mc *MealController) GetMealAudit(c *gin.Context) {
+	mealID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
+		return
+	}
 
-	// Get day from request
-	dayStr := c.Param("day")
-	day, err := strconv.Atoi(dayStr)
-	if err != nil || day < 1 || day > 31 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day"})
+	cursor, err := mc.mealAuditCollection.Find(context.Background(),
+		bson.M{"meal_id": mealID},
+		options.Find().SetSort(bson.M{"created_at": -1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
 		return
 	}
+	defer cursor.Close(context.Background())
 
-	// Get current month and year
-	now := time.Now()
+	entries := []models.MealAuditLog{}
+	if err := cursor.All(context.Background(), &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode audit log"})
+		return
+	}
 
-	var mealPlan models.MonthlyMealPlan
-	err = mc.mealPlanCollection.FindOne(context.Background(), bson.M{
-		"user_id": userID,
-		"month":   int(now.Month()),
-		"year":    now.Year(),
-	}).Decode(&mealPlan)
+	c.JSON(http.StatusOK, gin.H{"audit": entries})
+}
 
+// GetMealRecipe returns the ingredients and steps of a meal
+func (mc *MealController) GetMealRecipe(c *gin.Context) {
+	mealID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
 		return
 	}
 
-	dailyMeals, exists := mealPlan.Days[day]
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No meal plan for this day"})
+	var recipe models.Recipe
+	err = mc.recipeCollection.FindOne(context.Background(), bson.M{"meal_id": mealID}).Decode(&recipe)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
 		return
 	}
 
-	c.JSON(http.StatusOK, dailyMeals)
+	c.JSON(http.StatusOK, recipe)
 }
 
-// RecalibrateMealPlan updates the meal plan based on new preferences or requirements
-func (mc *MealController) RecalibrateMealPlan(c *gin.Context) {
-	userIDHex, _ := c.Get("user_id")
-	userID, _ := primitive.ObjectIDFromHex(userIDHex.(string))
+// SetMealRecipe creates or replaces a meal's recipe and recomputes the meal's
+// calories and nutrition from its ingredients
+func (mc *MealController) SetMealRecipe(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	mealID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
+		return
+	}
 
-	// Optional: Allow specific days to be recalibrated
-	var recalibrationRequest struct {
-		Days []int `json:"days"` // Optional: specific days to recalibrate
+	if _, err := mc.findMeal(mealID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal not found"})
+		return
 	}
-	if err := c.ShouldBindJSON(&recalibrationRequest); err != nil {
-		// If no body provided, recalibrate all remaining days
-		recalibrationRequest.Days = nil
+
+	var request models.RecipeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
 	}
 
-	// Get current meal plan
 	now := time.Now()
-	var mealPlan models.MonthlyMealPlan
-	err := mc.mealPlanCollection.FindOne(context.Background(), bson.M{
-		"user_id": userID,
-		"month":   int(now.Month()),
-		"year":    now.Year(),
-	}).Decode(&mealPlan)
+	recipe := models.Recipe{
+		MealID:      mealID,
+		Servings:    request.Servings,
+		Ingredients: request.Ingredients,
+		Steps:       request.Steps,
+		UpdatedAt:   now,
+	}
 
+	// Validate ingredients and units before saving anything
+	ingredients, err := mc.recipeService.LoadIngredients(c.Request.Context(), recipe)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+	if _, _, err := services.RecipeNutrition(recipe, ingredients); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get updated user preferences
-	var user models.User
-	err = mc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	var existing models.Recipe
+	err = mc.recipeCollection.FindOne(context.Background(), bson.M{"meal_id": mealID}).Decode(&existing)
+	switch err {
+	case nil:
+		recipe.ID = existing.ID
+		recipe.CreatedAt = existing.CreatedAt
+	case mongo.ErrNoDocuments:
+		recipe.ID = primitive.NewObjectID()
+		recipe.CreatedAt = now
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipe"})
+		return
+	}
+
+	_, err = mc.recipeCollection.ReplaceOne(context.Background(), bson.M{"_id": recipe.ID}, recipe, options.Replace().SetUpsert(true))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recipe"})
 		return
 	}
 
-	// Fetch meals matching updated preferences
-	filter := bson.M{
-		"tags": bson.M{
-			"$in": []string{user.NutritionPreference},
-		},
+	before, after, err := mc.recipeService.ApplyToMeal(c.Request.Context(), recipe, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Recipe saved but meal nutrition could not be recalculated"})
+		return
 	}
 
-	var meals []models.Meal
-	cursor, err := mc.mealCollection.Find(context.Background(), filter)
+	if changes := models.DiffMeals(*before, *after); len(changes) > 0 {
+		recordMealAudit(mc.mealAuditCollection, mealID, userID, "recalculate", changes)
+		mc.invalidatePlanCache()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipe": recipe, "meal": after})
+}
+
+// UploadMealImage stores an uploaded photo of a meal in the standard sizes and
+// makes the medium one the meal's image
+func (mc *MealController) UploadMealImage(c *gin.Context) {
+	mealID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
+		return
+	}
+	existing, err := mc.findMeal(mealID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meal not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal"})
 		return
 	}
-	defer cursor.Close(context.Background())
 
-	if err := cursor.All(context.Background(), &meals); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process meals"})
+	set := uploadImage(c, mc.images, "meals/"+mealID.Hex())
+	if set == nil {
 		return
 	}
 
-	mealsByCategory := make(map[string][]models.Meal)
-	for _, meal := range meals {
-		mealsByCategory[meal.Category] = append(mealsByCategory[meal.Category], meal)
+	saved := mc.applyMealUpdate(c, func(meal *models.Meal) {
+		meal.Image = set.Medium
+		meal.Images = set
+	})
+	if saved == nil {
+		// The meal keeps its old image, so drop the files just uploaded
+		mc.images.Replace(context.Background(), set, existing.Images)
 	}
+}
 
-	// Recalibrate specific days or remaining days in the month
-	if len(recalibrationRequest.Days) > 0 {
-		// Recalibrate only specified days
-		for _, day := range recalibrationRequest.Days {
-			if day >= 1 && day <= 31 {
-				mealPlan.Days[day] = generateDailyMeals(mealsByCategory)
-			}
-		}
-	} else {
-		// Recalibrate all days from today onwards
-		currentDay := now.Day()
-		daysInMonth := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+// maxImportRowsReported caps the row errors and changes returned by an import
+const maxImportRowsReported = 200
 
-		for day := currentDay; day <= daysInMonth; day++ {
-			mealPlan.Days[day] = generateDailyMeals(mealsByCategory)
-		}
+// ImportMeals upserts meals from an uploaded CSV or JSON file by name and
+// category. With dry_run=true nothing is written, but the response still
+// lists what would change.
+func (mc *MealController) ImportMeals(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
 	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
 
-	mealPlan.UpdatedAt = now
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	format := c.PostForm("format")
+	if format == "" {
+		format = catalogue.FormatFromFilename(header.Filename)
+	}
 
-	// Update the meal plan in database
-	_, err = mc.mealPlanCollection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": mealPlan.ID},
-		bson.M{"$set": mealPlan},
-	)
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to open upload"})
+		return
+	}
+	defer file.Close()
+
+	reader, err := catalogue.NewReader(format, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	importer := catalogue.NewImporter(mc.mealCollection, mc.mealAuditCollection)
+	importer.UserID = userID
+	importer.DryRun = dryRun
+	rowErrors := []catalogue.RowError{}
+	importer.OnInvalid = func(row catalogue.RowError) {
+		if len(rowErrors) < maxImportRowsReported {
+			rowErrors = append(rowErrors, row)
+		}
+	}
+	changes := []catalogue.Change{}
+	importer.OnChange = func(change catalogue.Change) {
+		if len(changes) < maxImportRowsReported {
+			changes = append(changes, change)
+		}
+	}
+
+	summary, err := importer.Run(c.Request.Context(), reader)
+	if summary.Changed() && !dryRun {
+		mc.invalidatePlanCache()
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update meal plan"})
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "summary": summary, "errors": rowErrors, "changes": changes})
 		return
 	}
 
-	c.JSON(http.StatusOK, mealPlan)
+	c.JSON(http.StatusOK, gin.H{"summary": summary, "errors": rowErrors, "changes": changes})
 }
 
-// Helper function to generate
-func generateDailyMeals(mealsByCategory map[string][]models.Meal) models.DailyMeals {
-	return models.DailyMeals{
-		Breakfast: getRandomMeal(mealsByCategory["breakfast"]).Name,
-		Lunch:     getRandomMeal(mealsByCategory["lunch"]).Name,
-		Dinner:    getRandomMeal(mealsByCategory["dinner"]).Name,
-		Dessert:   getRandomMeal(mealsByCategory["dessert"]).Name,
+// ExportMeals downloads the active catalogue as CSV or JSON, in the format ImportMeals reads
+func (mc *MealController) ExportMeals(c *gin.Context) {
+	format := c.DefaultQuery("format", catalogue.FormatCSV)
+	if format != catalogue.FormatCSV && format != catalogue.FormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	meals, err := catalogue.Meals(c.Request.Context(), mc.mealCollection)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == catalogue.FormatJSON {
+		contentType = "application/json; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="meals-%s.%s"`, time.Now().Format("2006-01-02"), format))
+	c.Status(http.StatusOK)
+	if err := catalogue.Write(c.Writer, format, meals); err != nil {
+		log.Printf("Meal export failed: %v", err)
 	}
 }
 
-func getRandomMeal(meals []models.Meal) models.Meal {
-	if len(meals) == 0 {
-		return models.Meal{Name: "No meal available"}
+// applyMealUpdate loads the meal named in the route, applies update, validates
+// and saves it. It returns the stored meal, or nil once an error response is written.
+func (mc *MealController) applyMealUpdate(c *gin.Context, update func(meal *models.Meal)) *models.Meal {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return nil
+	}
+
+	mealID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
+		return nil
+	}
+
+	existing, err := mc.findMeal(mealID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meal not found"})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal"})
+		return nil
+	}
+
+	updated := *existing
+	update(&updated)
+
+	// An image URL set by hand replaces any uploaded variants
+	if updated.Images != nil && updated.Image != updated.Images.Medium {
+		updated.Images = nil
+	}
+
+	if err := helpers.ValidateMealTags(updated.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	}
+	if err := helpers.ValidateAllergens(updated.DeclaredAllergens); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	}
+	if (updated.Name != existing.Name || updated.Category != existing.Category) &&
+		mc.mealExists(updated.Name, updated.Category, mealID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A meal with this name already exists in this category"})
+		return nil
+	}
+
+	changes := models.DiffMeals(*existing, updated)
+	if len(changes) == 0 {
+		c.JSON(http.StatusOK, existing)
+		return existing
+	}
+
+	updated.UpdatedAt = time.Now()
+	updated.UpdatedBy = userID
+
+	_, err = mc.mealCollection.ReplaceOne(context.Background(), bson.M{"_id": mealID}, updated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update meal"})
+		return nil
+	}
+
+	recordMealAudit(mc.mealAuditCollection, mealID, userID, "update", changes)
+	mc.invalidatePlanCache()
+	if mc.images != nil {
+		mc.images.Replace(context.Background(), existing.Images, updated.Images)
+	}
+
+	c.JSON(http.StatusOK, updated)
+	return &updated
+}
+
+func (mc *MealController) findMeal(mealID primitive.ObjectID) (*models.Meal, error) {
+	var meal models.Meal
+	err := mc.mealCollection.FindOne(context.Background(), activeMealFilter(bson.M{"_id": mealID})).Decode(&meal)
+	if err != nil {
+		return nil, err
+	}
+	return &meal, nil
+}
+
+// mealExists reports whether another active meal already uses this name and category
+func (mc *MealController) mealExists(name, category string, excludeID primitive.ObjectID) bool {
+	filter := activeMealFilter(bson.M{"name": name, "category": category})
+	if !excludeID.IsZero() {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+	count, err := mc.mealCollection.CountDocuments(context.Background(), filter)
+	return err == nil && count > 0
+}
+
+func recordMealAudit(collection *mongo.Collection, mealID, userID primitive.ObjectID, action string, changes map[string]models.FieldChange) {
+	entry := models.MealAuditLog{
+		MealID:    mealID,
+		UserID:    userID,
+		Action:    action,
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	}
+	if _, err := collection.InsertOne(context.Background(), entry); err != nil {
+		log.Printf("Failed to record meal audit for %s: %v", mealID.Hex(), err)
+	}
+}
+
+// invalidatePlanCache drops cached plans, which were generated from the old catalogue
+func (mc *MealController) invalidatePlanCache() {
+	if err := mc.planCache.Invalidate(context.Background()); err != nil {
+		log.Printf("Failed to invalidate meal plan cache: %v", err)
+	}
+}
+
+func (mc *MealController) GenerateMealPlan(c *gin.Context) {
+	userIDHex, _ := c.Get("user_id")
+	userID, _ := primitive.ObjectIDFromHex(userIDHex.(string))
+
+	// The body is optional; without one the current month is planned
+	var request models.GenerateMealPlanRequest
+	if err := c.ShouldBindJSON(&request); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	var user models.User
+	err := mc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Dates follow the user's timezone, not the server's
+	now := time.Now()
+	start, end, err := planRange(request.StartDate, request.EndDate, user.Today(now))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Allergens and dietary restrictions are hard exclusions: the planner only
+	// ever sees meals the user can safely eat
+	dietary := services.UserDietaryProfile(user)
+	filter := dietary.Apply(activeMealFilter(bson.M{}))
+	var meals []models.Meal
+	cursor, err := mc.mealCollection.Find(context.Background(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	if err := cursor.All(context.Background(), &meals); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to  process meal"})
+		return
+	}
+
+	// Medical conditions narrow the catalogue further and become planning constraints
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+	meals = services.FilterMealsForConditions(meals, rules)
+
+	// Meals that use up pantry items about to expire are preferred
+	expiring, err := mc.expiringPantry(c.Request.Context(), user, user.Today(now))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+		return
+	}
+	usingExpiring, err := mc.recipeService.MealsUsing(c.Request.Context(), expiring)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipes"})
+		return
+	}
+	var useUpMeals []string
+	for _, meal := range meals {
+		if usingExpiring[meal.ID] {
+			useUpMeals = append(useUpMeals, meal.Name)
+		}
+	}
+
+	// Initialize AI service
+	aiService := services.NewAIService(os.Getenv("OPENAI_API_KEY"), mc.promptStore)
+
+	planRequest := services.MealPlanRequest{
+		UserPreference:      user.NutritionPreference,
+		HealthGoals:         user.HealthGoals,
+		MedicalConditions:   user.MedicalConditions,
+		Allergens:           dietary.Allergens,
+		DietaryRestrictions: dietary.Restrictions,
+		AvailableMeals:      meals,
+		DaysToGenerate:      models.DayCount(start, end),
+		Constraints:         services.ConditionConstraints(rules),
+		Targets:             user.NutritionTargets,
+		Tolerance:           services.TargetTolerance(),
+		Slots:               user.Slots(),
+		UseUpMeals:          useUpMeals,
+	}
+
+	prompt, err := mc.promptStore.Active(c.Request.Context(), services.PromptMealPlan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load meal plan prompt"})
+		return
+	}
+
+	// Reuse a plan generated for identical inputs when one is cached
+	cacheKey := services.MealPlanCacheKey(planRequest, prompt, aiService.Model())
+	cached, err := mc.planCache.Get(c.Request.Context(), cacheKey)
+	if err != nil {
+		log.Printf("Meal plan cache lookup failed: %v", err)
+	}
+
+	var result *services.MealPlanResult
+	if cached != nil {
+		days := cached.Days
+		if services.ShuffleEnabled() {
+			days = services.ShuffleDays(days, userID)
+		}
+		result = &services.MealPlanResult{
+			Days:          days,
+			Model:         cached.Model,
+			PromptVersion: cached.PromptVersion,
+		}
+	} else {
+		// Reserve a request from the user's daily AI quota before calling the paid API
+		quota, reserved, err := mc.usageService.Reserve(c.Request.Context(), user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check AI usage quota"})
+			return
+		}
+		if !reserved {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Daily AI usage quota exceeded", "quota": quota})
+			return
+		}
+
+		// Generate meal plan using AI
+		result, err = aiService.GenerateMealPlanFromPrompt(c.Request.Context(), prompt, planRequest)
+		if err != nil {
+			if err := mc.usageService.Release(c.Request.Context(), userID, quota.Date); err != nil {
+				log.Printf("Failed to release AI quota for user %s: %v", userID.Hex(), err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate meal plan: %v", err)})
+			return
+		}
+
+		if err := mc.usageService.Record(c.Request.Context(), userID, services.FeatureMealPlan, result.Model, result.Usage); err != nil {
+			log.Printf("Failed to record AI usage for user %s: %v", userID.Hex(), err)
+		}
+		if err := mc.planCache.Put(c.Request.Context(), cacheKey, planRequest, result); err != nil {
+			log.Printf("Failed to cache meal plan: %v", err)
+		}
+	}
+	mealPlanDays := services.DatedDays(result.Days, start)
+	startDate, endDate := models.FormatDate(start), models.FormatDate(end)
+
+	// Slots the user locked on the dates being replaced carry over untouched
+	existing, err := mc.mealPlans.Between(context.Background(), userID, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plans"})
+		return
+	}
+	for date, previous := range models.DaysInRange(existing, startDate, endDate) {
+		if dailyMeals, exists := mealPlanDays[date]; exists {
+			mealPlanDays[date] = dailyMeals.KeepLocked(previous)
+		}
+	}
+
+	// Locked meals the user's allergens or restrictions now rule out are
+	// replaced with the rest
+	unlocked, ok := mc.unlockDisallowed(c, mealPlanDays, dietary, planRequest.Slots, startDate)
+	if !ok {
+		return
+	}
+
+	// Never trust the model to stay inside the catalogue it was given
+	planner := services.NewDeterministicPlanner(now.UnixNano())
+	if replaced := planner.RestrictToCatalogue(mealPlanDays, meals, planRequest.Slots, startDate); replaced > 0 {
+		log.Printf("Replaced %d meals outside the dietary catalogue for user %s", replaced, userID.Hex())
+	}
+
+	// Nor to add up to the user's targets: swap meals on days that miss them
+	var targetMisses []string
+	if user.NutritionTargets != nil {
+		var adjusted int
+		adjusted, targetMisses = planner.FitToTargets(mealPlanDays, meals, planRequest.Slots, *user.NutritionTargets, planRequest.Tolerance, startDate)
+		if adjusted > 0 {
+			log.Printf("Adjusted %d days to meet nutrition targets for user %s", adjusted, userID.Hex())
+		}
+	}
+
+	mealPlan := models.MealPlan{
+		UserID:        userID,
+		StartDate:     startDate,
+		EndDate:       endDate,
+		Days:          mealPlanDays,
+		Model:         result.Model,
+		PromptVersion: result.PromptVersion,
+		Cached:        cached != nil,
+		Targets:       user.NutritionTargets,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	// Save the meal plan, replacing whatever was planned for its dates
+	source := models.PlanSourceAI
+	if result.Model == "deterministic" {
+		source = models.PlanSourceDeterministic
+	}
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" {
+		reason = fmt.Sprintf("Generated plan for %s to %s", startDate, endDate)
+	}
+	if err := mc.mealPlans.Save(context.Background(), &mealPlan, reason, source); err != nil {
+		respondPlanWriteError(c, err, "Failed to save meal plan")
+		return
+	}
+
+	mealsByID := services.IndexMealsByID(meals)
+	mealPlan.DailyTotals = services.PlanTotals(mealPlan.Days, mealsByID)
+	mealPlan.Warnings = services.PlanWarnings(mealPlan.Days, mealsByID, rules)
+	mealPlan.TargetMisses = targetMisses
+	mealPlan.Unlocked = unlocked
+	c.JSON(http.StatusCreated, mealPlan)
+}
+
+// unlockDisallowed unlocks the slots of days from fromDate onwards locked to
+// a meal the profile rules out, answering 500 if the meals can't be loaded
+func (mc *MealController) unlockDisallowed(c *gin.Context, days map[string]models.DailyMeals, profile services.DietaryProfile, slots []models.MealSlot, fromDate string) ([]models.UnlockedSlot, bool) {
+	dailyMeals := make([]models.DailyMeals, 0, len(days))
+	for _, day := range days {
+		dailyMeals = append(dailyMeals, day)
+	}
+	mealsByID, err := mc.plannedMeals(dailyMeals...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return nil, false
+	}
+	unlocked := services.UnlockDisallowed(days, mealsByID, profile, slots, fromDate)
+	if len(unlocked) > 0 {
+		log.Printf("Unlocked %d slots outside the dietary profile", len(unlocked))
+	}
+	return unlocked, true
+}
+
+// planRange resolves the dates a request covers, defaulting to the month of today
+func planRange(startDate, endDate string, today time.Time) (time.Time, time.Time, error) {
+	if startDate == "" && endDate == "" {
+		start, end := models.MonthRange(today)
+		return start, end, nil
+	}
+	if startDate == "" || endDate == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date and end_date must be given together")
+	}
+	return models.ParseDateRange(startDate, endDate)
+}
+
+// GetMealPlan fetches the user's planned days from start_date to end_date,
+// defaulting to the current month, with the full details of every meal they
+// reference. The days may come from several plans.
+func (mc *MealController) GetMealPlan(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	start, end, err := planRange(c.Query("start_date"), c.Query("end_date"), user.Today(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	startDate, endDate := models.FormatDate(start), models.FormatDate(end)
+
+	plans, err := mc.mealPlans.Between(context.Background(), user.ID, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plans"})
+		return
+	}
+	days := models.DaysInRange(plans, startDate, endDate)
+	if len(days) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		return
+	}
+
+	var dailyMeals []models.DailyMeals
+	for _, day := range days {
+		dailyMeals = append(dailyMeals, day)
+	}
+	mealsByID, err := mc.plannedMeals(dailyMeals...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+
+	planIDs := make([]primitive.ObjectID, 0, len(plans))
+	for _, plan := range plans {
+		planIDs = append(planIDs, plan.ID)
+	}
+	meals := make(map[string]models.Meal, len(mealsByID))
+	for id, meal := range mealsByID {
+		meals[id.Hex()] = meal
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start_date":   startDate,
+		"end_date":     endDate,
+		"plan_ids":     planIDs,
+		"slots":        user.Slots(),
+		"days":         days,
+		"daily_totals": services.PlanTotals(days, mealsByID),
+		"warnings":     services.PlanWarnings(days, mealsByID, rules),
+		"meals":        meals,
+	})
+}
+
+// plannedMeals loads the meals the given days reference by ID. Soft deleted
+// meals are included so plans made before a deletion still show in full.
+func (mc *MealController) plannedMeals(days ...models.DailyMeals) (map[primitive.ObjectID]models.Meal, error) {
+	seen := map[primitive.ObjectID]bool{}
+	ids := []primitive.ObjectID{}
+	for _, dailyMeals := range days {
+		for _, id := range dailyMeals.MealIDs() {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return map[primitive.ObjectID]models.Meal{}, nil
+	}
+
+	cursor, err := mc.mealCollection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var meals []models.Meal
+	if err := cursor.All(context.Background(), &meals); err != nil {
+		return nil, err
+	}
+	return services.IndexMealsByID(meals), nil
+}
+
+// GetDailyMealPlan fetches a user's planned meals for one date, or for
+// "today" in the user's timezone. The date may also be given as a day of the
+// current month, as before plans had dates.
+func (mc *MealController) GetDailyMealPlan(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	date, err := planDate(c.Param("date"), user.Today(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mealPlan, err := mc.mealPlans.ForDate(context.Background(), user.ID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+	if mealPlan == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No meal plan for this day"})
+		return
+	}
+	response, ok := mc.dailyPlanResponse(c, user, mealPlan, date)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMealReminders lists when the user's meals are due over the next hours
+// (24 by default), on their own clock, so the app can schedule notifications
+func (mc *MealController) GetMealReminders(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	within := time.Duration(hours) * time.Hour
+	if err != nil || hours < 1 || within > services.MaxReminderWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("hours must be between 1 and %d", int(services.MaxReminderWindow.Hours()))})
+		return
+	}
+
+	now := time.Now()
+	startDate := models.FormatDate(user.Today(now))
+	endDate := models.FormatDate(models.LocalDate(now.Add(within), user.Location()))
+	plans, err := mc.mealPlans.Between(context.Background(), user.ID, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timezone":  user.Location().String(),
+		"reminders": services.MealReminders(*user, models.DaysInRange(plans, startDate, endDate), now, within),
+	})
+}
+
+// dailyPlanResponse describes one date of a plan: its meals in full, slot by
+// slot, with the day's totals and warnings
+func (mc *MealController) dailyPlanResponse(c *gin.Context, user *models.User, mealPlan *models.MealPlan, date string) (gin.H, bool) {
+	dailyMeals := mealPlan.Days[date]
+
+	// Look up the day's meals to expand them and report its nutrition totals
+	mealsByID, err := mc.plannedMeals(dailyMeals)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return nil, false
+	}
+
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return nil, false
+	}
+
+	totals := services.DailyTotals(dailyMeals, mealsByID)
+	warnings := services.DayWarnings(date, totals, rules)
+	for _, id := range dailyMeals.MealIDs() {
+		if meal, exists := mealsByID[id]; exists {
+			warnings = append(warnings, services.MealWarnings(meal, rules)...)
+		}
+	}
+
+	calorieTarget := 0
+	if user.NutritionTargets != nil {
+		calorieTarget = user.NutritionTargets.Calories
+	}
+	response := gin.H{
+		"date":     date,
+		"plan_id":  mealPlan.ID,
+		"version":  mealPlan.Version,
+		"totals":   totals,
+		"warnings": warnings,
+		"slots":    dailyMeals.Ordered(user.Slots(), mealsByID, calorieTarget),
+	}
+	for slot, meal := range dailyMeals.Expand(mealsByID) {
+		response[slot] = meal
+	}
+	return response, true
+}
+
+// planDate reads a YYYY-MM-DD date, "today", or a day of the month of today
+func planDate(value string, today time.Time) (string, error) {
+	if value == "today" {
+		return models.FormatDate(today), nil
+	}
+	if day, err := strconv.Atoi(value); err == nil {
+		first, last := models.MonthRange(today)
+		if day < 1 || day > last.Day() {
+			return "", fmt.Errorf("Invalid day")
+		}
+		return models.FormatDate(first.AddDate(0, 0, day-1)), nil
+	}
+	date, err := models.ParseDate(value)
+	if err != nil {
+		return "", err
+	}
+	return models.FormatDate(date), nil
+}
+
+// Recalibration steers away from meals the food diary shows were skipped or
+// replaced at least missedMealThreshold times in the last adherenceWindowDays
+const (
+	adherenceWindowDays = 14
+	missedMealThreshold = 2
+)
+
+// RecalibrateMealPlan replans dates of the meal plan under the user's current
+// preferences and any constraints in the request, and reports what changed and why
+func (mc *MealController) RecalibrateMealPlan(c *gin.Context) {
+	userIDHex, _ := c.Get("user_id")
+	userID, _ := primitive.ObjectIDFromHex(userIDHex.(string))
+
+	// Without a body every remaining day is recalibrated
+	var recalibrationRequest models.RecalibrationRequest
+	if err := c.ShouldBindJSON(&recalibrationRequest); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if (recalibrationRequest.MinCalories > 0) != (recalibrationRequest.MaxCalories > 0) ||
+		recalibrationRequest.MinCalories > recalibrationRequest.MaxCalories {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_calories and max_calories must be given together, min first"})
+		return
+	}
+
+	constraints := services.RecalibrationConstraints{
+		ExcludeMeals: map[primitive.ObjectID]bool{},
+		MaxPrepTime:  recalibrationRequest.MaxPrepTime,
+		MinCalories:  recalibrationRequest.MinCalories,
+		MaxCalories:  recalibrationRequest.MaxCalories,
+	}
+	for _, id := range recalibrationRequest.ExcludeMeals {
+		mealID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID " + id})
+			return
+		}
+		constraints.ExcludeMeals[mealID] = true
+	}
+	var useUp []primitive.ObjectID
+	for _, id := range recalibrationRequest.UseUp {
+		ingredientID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID " + id})
+			return
+		}
+		useUp = append(useUp, ingredientID)
+	}
+
+	// Get updated user preferences
+	var user models.User
+	err := mc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	slots := user.Slots()
+
+	// Today is the user's today, so recalibration starts on their current day
+	now := time.Now()
+	localToday := user.Today(now)
+	today := models.FormatDate(localToday)
+	dates := recalibrationRequest.Dates
+	for _, day := range recalibrationRequest.Days {
+		date, err := planDate(strconv.Itoa(day), localToday)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dates = append(dates, date)
+	}
+	for i, value := range dates {
+		date, err := planDate(value, localToday)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dates[i] = date
+	}
+
+	// Days with skipped or eating out slots are recalibrated too
+	slotRef := func(ref *models.SlotRef) bool {
+		date, err := planDate(ref.Date, localToday)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		if _, ok := models.FindSlot(slots, ref.Slot); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not one of your meal slots", ref.Slot)})
+			return false
+		}
+		ref.Date = date
+		dates = append(dates, date)
+		return true
+	}
+	for i := range recalibrationRequest.Skip {
+		if !slotRef(&recalibrationRequest.Skip[i]) {
+			return
+		}
+	}
+	for i := range recalibrationRequest.EatingOut {
+		if !slotRef(&recalibrationRequest.EatingOut[i].SlotRef) {
+			return
+		}
+	}
+	constraints.Skip = recalibrationRequest.Skip
+	constraints.EatingOut = recalibrationRequest.EatingOut
+	dates = uniqueDates(dates)
+
+	// Recalibrate the plan holding the requested dates, or else today
+	planDateKey := today
+	if len(dates) > 0 {
+		planDateKey = dates[0]
+	}
+	mealPlan, err := mc.mealPlans.ForDate(context.Background(), userID, planDateKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+	if mealPlan == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		return
+	}
+	for _, date := range dates {
+		if _, exists := mealPlan.Days[date]; !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not part of the same meal plan as %s", date, planDateKey)})
+			return
+		}
+	}
+	if len(dates) == 0 {
+		for date := range mealPlan.Days {
+			if date >= today {
+				dates = append(dates, date)
+			}
+		}
+	}
+
+	// Fetch meals matching updated preferences, allergens and restrictions
+	dietary := services.UserDietaryProfile(user)
+	filter := dietary.Apply(activeMealFilter(bson.M{}))
+
+	var meals []models.Meal
+	cursor, err := mc.mealCollection.Find(context.Background(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	if err := cursor.All(context.Background(), &meals); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process meals"})
+		return
+	}
+
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+	meals = services.FilterMealsForConditions(meals, rules)
+
+	// Pantry items about to expire are used up along with the requested ingredients
+	expiring, err := mc.expiringPantry(c.Request.Context(), user, localToday)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+		return
+	}
+	useUp = append(useUp, expiring...)
+	constraints.UseUp, err = mc.recipeService.MealsUsing(c.Request.Context(), useUp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recipes"})
+		return
+	}
+
+	// Meals the user kept skipping or replacing over the last two weeks are
+	// planned only when nothing else fits
+	adherence, err := userAdherence(c.Request.Context(), mc.mealPlans, mc.foodLog, user,
+		models.FormatDate(localToday.AddDate(0, 0, -adherenceWindowDays)), models.FormatDate(localToday.AddDate(0, 0, -1)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load food diary"})
+		return
+	}
+	constraints.Avoid = adherence.OftenMissed(missedMealThreshold)
+
+	planner := services.NewDeterministicPlanner(time.Now().UnixNano())
+	previous := make(map[string]models.DailyMeals, len(mealPlan.Days))
+	for date, dailyMeals := range mealPlan.Days {
+		previous[date] = dailyMeals.Clone()
+	}
+
+	// Locked meals the user's allergens or restrictions now rule out are
+	// replaced like any other
+	unlocked, ok := mc.unlockDisallowed(c, mealPlan.Days, dietary, slots, today)
+	if !ok {
+		return
+	}
+
+	// Recalibrate the dates, keeping locked slots and fitting each day to the
+	// calorie range or the user's current targets
+	summary := planner.Recalibrate(mealPlan.Days, dates, meals, slots, constraints, user.NutritionTargets, services.TargetTolerance())
+
+	// Upcoming days left untouched may still hold meals the user's allergens
+	// or restrictions now rule out
+	if replaced := planner.RestrictToCatalogue(mealPlan.Days, meals, slots, today); replaced > 0 {
+		log.Printf("Replaced %d meals outside the dietary catalogue for user %s", replaced, userID.Hex())
+		recalibrated := make(map[string]bool, len(summary.Dates))
+		for _, date := range summary.Dates {
+			recalibrated[date] = true
+		}
+		for _, diff := range models.DiffPlanDays(previous, mealPlan.Days) {
+			for _, change := range diff.Slots {
+				if !recalibrated[diff.Date] {
+					summary.AddChange(services.RecalibrationChange{Date: diff.Date, Slot: change.Slot, From: change.From, To: change.To,
+						Reason: change.From.Name + " is no longer allowed by your dietary profile or conditions"})
+				}
+			}
+		}
+	}
+
+	mealPlan.Targets = user.NutritionTargets
+	mealPlan.UpdatedAt = now
+
+	// Update the meal plan in database
+	reason := strings.TrimSpace(recalibrationRequest.Reason)
+	if reason == "" {
+		reason = "Recalibrated " + strings.Join(summary.Dates, ", ")
+		if len(recalibrationRequest.Dates)+len(recalibrationRequest.Days)+len(constraints.Skip)+len(constraints.EatingOut) == 0 {
+			reason = "Recalibrated upcoming days"
+		}
+	}
+	if err := mc.mealPlans.Update(context.Background(), mealPlan, reason, models.PlanSourceDeterministic); err != nil {
+		respondPlanWriteError(c, err, "Failed to update meal plan")
+		return
+	}
+
+	mealsByID := services.IndexMealsByID(meals)
+	mealPlan.DailyTotals = services.PlanTotals(mealPlan.Days, mealsByID)
+	mealPlan.Warnings = services.PlanWarnings(mealPlan.Days, mealsByID, rules)
+	mealPlan.TargetMisses = summary.TargetMisses
+	mealPlan.Unlocked = unlocked
+	// The plan keeps its usual shape, with the summary alongside its fields
+	c.JSON(http.StatusOK, struct {
+		*models.MealPlan
+		Summary services.RecalibrationSummary `json:"summary"`
+	}{mealPlan, summary})
+}
+
+// uniqueDates drops repeated dates, keeping the first of each
+func uniqueDates(dates []string) []string {
+	seen := make(map[string]bool, len(dates))
+	unique := dates[:0]
+	for _, date := range dates {
+		if !seen[date] {
+			seen[date] = true
+			unique = append(unique, date)
+		}
+	}
+	return unique
+}
+
+// planVersionOwner loads the newest version of the plan named in the URL,
+// answering 404 unless it belongs to the user. It works for plans whose dates
+// were all taken over by newer ones, which only live on as versions.
+func (mc *MealController) planVersionOwner(c *gin.Context, user *models.User) (*models.MealPlanVersion, bool) {
+	planID, err := primitive.ObjectIDFromHex(c.Param("planId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal plan ID"})
+		return nil, false
+	}
+
+	latest, err := mc.mealPlans.LatestVersion(context.Background(), planID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan versions"})
+		return nil, false
+	}
+	if latest == nil || latest.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		return nil, false
+	}
+	return latest, true
+}
+
+// GetMealPlanVersions lists every version of a plan, newest first, with the
+// reason and source of each change
+func (mc *MealController) GetMealPlanVersions(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	latest, ok := mc.planVersionOwner(c, user)
+	if !ok {
+		return
+	}
+
+	versions, err := mc.mealPlans.Versions(context.Background(), latest.PlanID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan_id":         latest.PlanID,
+		"current_version": latest.Version,
+		"versions":        versions,
+	})
+}
+
+// DiffMealPlanVersions compares two versions of a plan day by day. to
+// defaults to the current version.
+func (mc *MealController) DiffMealPlanVersions(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	latest, ok := mc.planVersionOwner(c, user)
+	if !ok {
+		return
+	}
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil || from < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a version number"})
+		return
+	}
+	to := latest.Version
+	if value := c.Query("to"); value != "" {
+		if to, err = strconv.Atoi(value); err != nil || to < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a version number"})
+			return
+		}
+	}
+
+	versions := make([]*models.MealPlanVersion, 2)
+	for i, number := range []int{from, to} {
+		version, err := mc.mealPlans.Version(context.Background(), latest.PlanID, number)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan version"})
+			return
+		}
+		if version == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Meal plan has no version %d", number)})
+			return
+		}
+		versions[i] = version
+	}
+
+	fromDays, toDays := versions[0].Days, versions[1].Days
+	versions[0].Days, versions[1].Days = nil, nil
+	c.JSON(http.StatusOK, gin.H{
+		"plan_id": latest.PlanID,
+		"from":    versions[0],
+		"to":      versions[1],
+		"days":    models.DiffPlanDays(fromDays, toDays),
+	})
+}
+
+// RollbackMealPlan restores a plan to an earlier version. The rollback is a
+// new version itself, so it can be undone the same way.
+func (mc *MealController) RollbackMealPlan(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	latest, ok := mc.planVersionOwner(c, user)
+	if !ok {
+		return
+	}
+
+	var request models.RollbackRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if request.Version == latest.Version {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already the current version"})
+		return
+	}
+
+	target, err := mc.mealPlans.Version(context.Background(), latest.PlanID, request.Version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan version"})
+		return
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Meal plan has no version %d", request.Version)})
+		return
+	}
+
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" {
+		reason = fmt.Sprintf("Rolled back to version %d", target.Version)
+	}
+	mealPlan, err := mc.mealPlans.Rollback(context.Background(), *target, reason, time.Now())
+	if err != nil {
+		respondPlanWriteError(c, err, "Failed to roll back meal plan")
+		return
+	}
+
+	var days []models.DailyMeals
+	for _, dailyMeals := range mealPlan.Days {
+		days = append(days, dailyMeals)
+	}
+	mealsByID, err := mc.plannedMeals(days...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+
+	mealPlan.DailyTotals = services.PlanTotals(mealPlan.Days, mealsByID)
+	mealPlan.Warnings = services.PlanWarnings(mealPlan.Days, mealsByID, rules)
+	c.JSON(http.StatusOK, gin.H{
+		"plan":    mealPlan,
+		"changes": models.DiffPlanDays(latest.Days, mealPlan.Days),
+	})
+}
+
+// suggestionLimit is how many alternatives a slot gets unless the request asks otherwise
+const (
+	suggestionLimit    = 5
+	maxSuggestionLimit = 20
+	// suggestionVarietyDays is how many days either side count as recent
+	suggestionVarietyDays = 3
+)
+
+// planSlot resolves a date and slot to the plan holding them. The slot must
+// be one of the user's or already on the day.
+func (mc *MealController) planSlot(c *gin.Context, user *models.User, dateValue, slot string) (*models.MealPlan, string, bool) {
+	date, err := planDate(dateValue, user.Today(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+
+	mealPlan, err := mc.mealPlans.ForDate(context.Background(), user.ID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return nil, "", false
+	}
+	if mealPlan == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No meal plan for %s", date)})
+		return nil, "", false
+	}
+
+	_, onDay := mealPlan.Days[date].Get(slot)
+	if _, configured := models.FindSlot(user.Slots(), slot); !onDay && !configured {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q is not one of your meal slots", slot)})
+		return nil, "", false
+	}
+	return mealPlan, date, true
+}
+
+// SetPlanSlot puts a catalogue meal of the user's choosing into one slot of a
+// planned day, optionally locking it there
+func (mc *MealController) SetPlanSlot(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var request models.SetSlotMealRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	mealID, err := primitive.ObjectIDFromHex(request.MealID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meal ID"})
+		return
+	}
+
+	slot := c.Param("slot")
+	mealPlan, date, ok := mc.planSlot(c, user, c.Param("date"), slot)
+	if !ok {
+		return
+	}
+	dailyMeals := mealPlan.Days[date].Clone()
+	current, _ := dailyMeals.Get(slot)
+	if current.Locked {
+		c.JSON(http.StatusConflict, gin.H{"error": "This slot is locked, unlock it before changing it"})
+		return
+	}
+
+	meal, err := mc.findMeal(mealID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal"})
+		return
+	}
+	// The slot's category, allergens and restrictions are as binding here as
+	// they are for planners
+	if category := models.SlotCategory(user.Slots(), slot); meal.Category != category {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is a %s meal, but the %s slot is filled from %s", meal.Name, meal.Category, slot, category)})
+		return
+	}
+	if allowed, reason := services.UserDietaryProfile(*user).Allows(*meal); !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not allowed by your dietary profile: %s", meal.Name, reason)})
+		return
+	}
+	// Condition rules only advise, so the meal is set and its breaches reported
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+
+	planned := models.NewPlannedMeal(*meal)
+	if request.Locked != nil {
+		planned.Locked = *request.Locked
+	}
+	dailyMeals.Set(slot, planned)
+
+	reason := fmt.Sprintf("Set %s on %s to %s", slot, date, meal.Name)
+	if err := mc.mealPlans.SetDay(context.Background(), mealPlan, date, dailyMeals, time.Now(), reason, models.PlanSourceManual); err != nil {
+		respondPlanWriteError(c, err, "Failed to update meal plan")
+		return
+	}
+
+	response, ok := mc.dailyPlanResponse(c, user, mealPlan, date)
+	if !ok {
+		return
+	}
+	response["meal_warnings"] = services.MealWarnings(*meal, rules)
+	c.JSON(http.StatusOK, response)
+}
+
+// LockPlanSlot locks a slot (PUT) so regeneration and recalibration leave it
+// alone, or unlocks it (DELETE)
+func (mc *MealController) LockPlanSlot(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	slot := c.Param("slot")
+	mealPlan, date, ok := mc.planSlot(c, user, c.Param("date"), slot)
+	if !ok {
+		return
+	}
+
+	locked := c.Request.Method != http.MethodDelete
+	dailyMeals := mealPlan.Days[date].Clone()
+	planned, _ := dailyMeals.Get(slot)
+	if planned.Locked != locked {
+		planned.Locked = locked
+		if !locked && planned.Status != "" {
+			// A skipped or eating out slot only exists while locked
+			planned = models.PlannedMeal{}
+		}
+		dailyMeals.Set(slot, planned)
+
+		reason := fmt.Sprintf("Locked %s on %s", slot, date)
+		if !locked {
+			reason = fmt.Sprintf("Unlocked %s on %s", slot, date)
+		}
+		if err := mc.mealPlans.SetDay(context.Background(), mealPlan, date, dailyMeals, time.Now(), reason, models.PlanSourceManual); err != nil {
+			respondPlanWriteError(c, err, "Failed to update meal plan")
+			return
+		}
+	}
+
+	response, ok := mc.dailyPlanResponse(c, user, mealPlan, date)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SwapPlanSlots exchanges the meals of two slots, on the same date or on two
+// dates, which may belong to different plans
+func (mc *MealController) SwapPlanSlots(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var request models.SwapSlotsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	firstPlan, firstDate, ok := mc.planSlot(c, user, request.First.Date, request.First.Slot)
+	if !ok {
+		return
+	}
+	secondPlan, secondDate, ok := mc.planSlot(c, user, request.Second.Date, request.Second.Slot)
+	if !ok {
+		return
+	}
+	if firstDate == secondDate && request.First.Slot == request.Second.Slot {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pick two different slots to swap"})
+		return
+	}
+
+	first, _ := firstPlan.Days[firstDate].Get(request.First.Slot)
+	second, _ := secondPlan.Days[secondDate].Get(request.Second.Slot)
+	if first.Locked || second.Locked {
+		c.JSON(http.StatusConflict, gin.H{"error": "A locked slot can't be swapped, unlock it first"})
+		return
+	}
+
+	// Each meal must belong to the category its new slot is filled from
+	mealsByID, err := mc.plannedMeals(firstPlan.Days[firstDate], secondPlan.Days[secondDate])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+	slots := user.Slots()
+	for _, move := range []struct {
+		meal models.PlannedMeal
+		slot string
+	}{
+		{second, request.First.Slot},
+		{first, request.Second.Slot},
+	} {
+		meal, found := mealsByID[move.meal.MealID]
+		if !found {
+			continue
+		}
+		if category := models.SlotCategory(slots, move.slot); meal.Category != category {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is a %s meal, but the %s slot is filled from %s", meal.Name, meal.Category, move.slot, category)})
+			return
+		}
+	}
+
+	// Both dates of one plan change together, as one version
+	changes := map[primitive.ObjectID]map[string]models.DailyMeals{}
+	plans := map[primitive.ObjectID]*models.MealPlan{firstPlan.ID: firstPlan, secondPlan.ID: secondPlan}
+	for _, side := range []struct {
+		plan *models.MealPlan
+		date string
+		slot string
+		meal models.PlannedMeal
+	}{
+		{firstPlan, firstDate, request.First.Slot, second},
+		{secondPlan, secondDate, request.Second.Slot, first},
+	} {
+		if changes[side.plan.ID] == nil {
+			changes[side.plan.ID] = map[string]models.DailyMeals{}
+		}
+		dailyMeals, exists := changes[side.plan.ID][side.date]
+		if !exists {
+			dailyMeals = side.plan.Days[side.date].Clone()
+		}
+		dailyMeals.Set(side.slot, side.meal)
+		changes[side.plan.ID][side.date] = dailyMeals
+	}
+
+	now := time.Now()
+	reason := fmt.Sprintf("Swapped %s on %s with %s on %s", request.First.Slot, firstDate, request.Second.Slot, secondDate)
+	planIDs := []primitive.ObjectID{firstPlan.ID}
+	if secondPlan.ID != firstPlan.ID {
+		planIDs = append(planIDs, secondPlan.ID)
+	}
+	if err := mc.mealPlans.SetDaysOfPlans(context.Background(), planIDs, plans, changes, now, reason, models.PlanSourceManual); err != nil {
+		respondPlanWriteError(c, err, "Failed to update meal plan")
+		return
+	}
+
+	firstResponse, ok := mc.dailyPlanResponse(c, user, plans[firstPlan.ID], firstDate)
+	if !ok {
+		return
+	}
+	secondResponse, ok := mc.dailyPlanResponse(c, user, plans[secondPlan.ID], secondDate)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"first": firstResponse, "second": secondResponse})
+}
+
+// SuggestPlanSlot ranks alternatives for one slot of a planned day. Only meals
+// the user's allergens, restrictions and conditions allow are suggested,
+// ranked by how well they fit the calories the day has left.
+func (mc *MealController) SuggestPlanSlot(c *gin.Context) {
+	user, err := mc.authenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	limit := suggestionLimit
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxSuggestionLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSuggestionLimit)})
+			return
+		}
+	}
+
+	slotName := c.Param("slot")
+	mealPlan, date, ok := mc.planSlot(c, user, c.Param("date"), slotName)
+	if !ok {
+		return
+	}
+	slots := user.Slots()
+	slot, configured := models.FindSlot(slots, slotName)
+	if !configured {
+		slot = models.MealSlot{Name: slotName, Category: models.SlotCategory(slots, slotName)}
+	}
+	dailyMeals := mealPlan.Days[date]
+
+	filter := services.UserDietaryProfile(*user).Apply(activeMealFilter(bson.M{"category": slot.Category}))
+	var candidates []models.Meal
+	cursor, err := mc.mealCollection.Find(context.Background(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+		return
+	}
+	defer cursor.Close(context.Background())
+	if err := cursor.All(context.Background(), &candidates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process meals"})
+		return
+	}
+
+	rules, err := mc.conditionRules.ForConditions(c.Request.Context(), user.MedicalConditions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load condition rules"})
+		return
+	}
+	candidates = services.FilterMealsForConditions(candidates, rules)
+
+	// Meals already on the day are no alternative
+	onDay := map[primitive.ObjectID]bool{}
+	for _, id := range dailyMeals.MealIDs() {
+		onDay[id] = true
+	}
+	alternatives := make([]models.Meal, 0, len(candidates))
+	for _, meal := range candidates {
+		if !onDay[meal.ID] {
+			alternatives = append(alternatives, meal)
+		}
+	}
+
+	// The budget is what the user's calorie target leaves after the day's other slots
+	request := services.SuggestionRequest{Slot: slot, HealthGoals: user.HealthGoals, Rules: rules}
+	if user.NutritionTargets != nil {
+		others := dailyMeals.Clone()
+		delete(others, slotName)
+		mealsByID, err := mc.plannedMeals(others)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+			return
+		}
+		request.Budget = user.NutritionTargets.Calories - services.DailyTotals(others, mealsByID).Calories
+		request.SlotCalories = int(math.Round(slot.CalorieShare * float64(user.NutritionTargets.Calories)))
+	}
+
+	// Meals planned a few days either side count against variety
+	day, _ := models.ParseDate(date)
+	from := models.FormatDate(day.AddDate(0, 0, -suggestionVarietyDays))
+	to := models.FormatDate(day.AddDate(0, 0, suggestionVarietyDays))
+	nearby, err := mc.mealPlans.Between(context.Background(), user.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plans"})
+		return
+	}
+	request.Recent = map[primitive.ObjectID]bool{}
+	for nearbyDate, nearbyMeals := range models.DaysInRange(nearby, from, to) {
+		if nearbyDate == date {
+			continue
+		}
+		for _, id := range nearbyMeals.MealIDs() {
+			request.Recent[id] = true
+		}
+	}
+
+	current, _ := dailyMeals.Get(slotName)
+	response := gin.H{
+		"date":        date,
+		"slot":        slot,
+		"current":     current,
+		"suggestions": services.SuggestMeals(alternatives, request, limit),
+	}
+	if user.NutritionTargets != nil {
+		response["calories_left"] = request.Budget
 	}
-	return meals[rand.Intn(len(meals))]
+	c.JSON(http.StatusOK, response)
 }
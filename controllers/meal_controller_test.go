@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"testing"
+
+	"figorate/models"
+)
+
+func TestPlanDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		today   string
+		want    string
+		wantErr bool
+	}{
+		{"today", "today", "2026-10-19", "2026-10-19", false},
+		{"today on a leap day", "today", "2028-02-29", "2028-02-29", false},
+		{"day of month", "5", "2026-10-19", "2026-10-05", false},
+		{"last day of a 31 day month", "31", "2026-01-15", "2026-01-31", false},
+		{"31 in a 30 day month", "31", "2026-04-15", "", true},
+		{"29 in February", "29", "2026-02-10", "", true},
+		{"29 in a leap February", "29", "2028-02-10", "2028-02-29", false},
+		{"30 in a leap February", "30", "2028-02-10", "", true},
+		{"day zero", "0", "2026-10-19", "", true},
+		{"negative day", "-1", "2026-10-19", "", true},
+		{"last day of December", "31", "2026-12-01", "2026-12-31", false},
+		{"full date", "2027-03-01", "2026-10-19", "2027-03-01", false},
+		{"full leap day", "2028-02-29", "2026-10-19", "2028-02-29", false},
+		{"impossible leap day", "2026-02-29", "2026-10-19", "", true},
+		{"not a date", "tomorrow", "2026-10-19", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			today, err := models.ParseDate(tt.today)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := planDate(tt.value, today)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("planDate(%q) = %s, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("planDate(%q) = %s, %v, want %s", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
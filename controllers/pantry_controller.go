@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"figorate/database"
+	"figorate/helpers"
+	"figorate/models"
+	"figorate/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type PantryController struct {
+	userCollection       *mongo.Collection
+	ingredientCollection *mongo.Collection
+	mealCollection       *mongo.Collection
+	recipeService        *services.RecipeService
+	pantry               *services.PantryStore
+}
+
+func NewPantryController() *PantryController {
+	db := database.GetDatabase()
+	pantry := services.NewPantryStore(db.Collection("pantry_items"))
+	if err := pantry.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("Pantry indexes not created: %v", err)
+	}
+
+	return &PantryController{
+		userCollection:       db.Collection("users"),
+		ingredientCollection: db.Collection("ingredients"),
+		mealCollection:       db.Collection("meals"),
+		recipeService:        services.NewRecipeService(db.Collection("recipes"), db.Collection("ingredients"), db.Collection("meals")),
+		pantry:               pantry,
+	}
+}
+
+// pantryUser loads the authenticated user, answering 404 when they are gone
+func (pc *PantryController) pantryUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return nil, false
+	}
+	var user models.User
+	if err := pc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// pantryItemFromRequest validates a request against the ingredient catalogue
+// and fills item from it
+func (pc *PantryController) pantryItemFromRequest(c *gin.Context, item *models.PantryItem) bool {
+	var request models.PantryItemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return false
+	}
+	ingredientID, err := primitive.ObjectIDFromHex(request.IngredientID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+		return false
+	}
+	if request.ExpiresOn != "" {
+		expires, err := models.ParseDate(request.ExpiresOn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		request.ExpiresOn = models.FormatDate(expires)
+	}
+
+	var ingredient models.Ingredient
+	if err := pc.ingredientCollection.FindOne(context.Background(), bson.M{"_id": ingredientID}).Decode(&ingredient); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+		return false
+	}
+	item.IngredientID = ingredient.ID
+	item.Name = ingredient.Name
+	item.Quantity = request.Quantity
+	item.Unit = request.Unit
+	item.ExpiresOn = request.ExpiresOn
+	item.UpdatedAt = time.Now()
+	return true
+}
+
+// GetPantry lists the user's pantry, soonest to expire first, flagging items
+// that expire within ExpiringSoonDays. ?expiring=true keeps only those.
+func (pc *PantryController) GetPantry(c *gin.Context) {
+	user, ok := pc.pantryUser(c)
+	if !ok {
+		return
+	}
+
+	items, err := pc.pantry.Items(context.Background(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+		return
+	}
+
+	today := user.Today(time.Now())
+	onlyExpiring := c.Query("expiring") == "true"
+	views := []services.PantryItemView{}
+	expiring, expired := 0, 0
+	for _, item := range items {
+		view := services.ViewPantryItem(item, today)
+		if view.Expiring {
+			expiring++
+		}
+		if view.Expired {
+			expired++
+		}
+		if !onlyExpiring || view.Expiring {
+			views = append(views, view)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": views, "expiring": expiring, "expired": expired})
+}
+
+// GetExpiringPantryMeals lists the pantry items expiring soon with the meals,
+// among those the user may eat, whose recipes use them up
+func (pc *PantryController) GetExpiringPantryMeals(c *gin.Context) {
+	user, ok := pc.pantryUser(c)
+	if !ok {
+		return
+	}
+
+	items, err := pc.pantry.Items(context.Background(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+		return
+	}
+	today := user.Today(time.Now())
+	views := []services.PantryItemView{}
+	for _, item := range items {
+		if view := services.ViewPantryItem(item, today); view.Expiring {
+			views = append(views, view)
+		}
+	}
+
+	meals := []models.Meal{}
+	mealIDs, err := pc.recipeService.MealsUsing(c.Request.Context(), services.ExpiringIngredients(items, today))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipes"})
+		return
+	}
+	if len(mealIDs) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(mealIDs))
+		for id := range mealIDs {
+			ids = append(ids, id)
+		}
+		filter := services.UserDietaryProfile(*user).Apply(activeMealFilter(bson.M{"_id": bson.M{"$in": ids}}))
+		cursor, err := pc.mealCollection.Find(context.Background(), filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meals"})
+			return
+		}
+		if err := cursor.All(context.Background(), &meals); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process meals"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": views, "meals": meals})
+}
+
+// AddPantryItem records an ingredient the user has at home
+func (pc *PantryController) AddPantryItem(c *gin.Context) {
+	user, ok := pc.pantryUser(c)
+	if !ok {
+		return
+	}
+
+	item := models.PantryItem{UserID: user.ID}
+	if !pc.pantryItemFromRequest(c, &item) {
+		return
+	}
+	item.CreatedAt = item.UpdatedAt
+	if err := pc.pantry.Add(context.Background(), &item); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add pantry item"})
+		return
+	}
+	c.JSON(http.StatusCreated, services.ViewPantryItem(item, user.Today(time.Now())))
+}
+
+// UpdatePantryItem replaces the ingredient, quantity and expiry of an item
+func (pc *PantryController) UpdatePantryItem(c *gin.Context) {
+	user, ok := pc.pantryUser(c)
+	if !ok {
+		return
+	}
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pantry item ID"})
+		return
+	}
+
+	item, err := pc.pantry.Get(context.Background(), user.ID, itemID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry item"})
+		return
+	}
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pantry item not found"})
+		return
+	}
+	if !pc.pantryItemFromRequest(c, item) {
+		return
+	}
+	if err := pc.pantry.Update(context.Background(), *item); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pantry item"})
+		return
+	}
+	c.JSON(http.StatusOK, services.ViewPantryItem(*item, user.Today(time.Now())))
+}
+
+// DeletePantryItem removes an item from the pantry
+func (pc *PantryController) DeletePantryItem(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pantry item ID"})
+		return
+	}
+
+	deleted, err := pc.pantry.Delete(context.Background(), userID, itemID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pantry item"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pantry item not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Pantry item deleted"})
+}
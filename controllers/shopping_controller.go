@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"figorate/database"
+	"figorate/helpers"
+	"figorate/models"
+	"figorate/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// shoppingListDays is how many days a shopping list covers by default
+const shoppingListDays = 7
+
+type ShoppingController struct {
+	userCollection *mongo.Collection
+	mealPlans      *services.MealPlanStore
+	recipeService  *services.RecipeService
+	pantry         *services.PantryStore
+	shoppingLists  *services.ShoppingListStore
+}
+
+func NewShoppingController() *ShoppingController {
+	db := database.GetDatabase()
+	shoppingLists := services.NewShoppingListStore(db.Collection("shopping_lists"))
+	if err := shoppingLists.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("Shopping list indexes not created: %v", err)
+	}
+
+	return &ShoppingController{
+		userCollection: db.Collection("users"),
+		mealPlans:      services.NewMealPlanStore(db.Collection("meal_plans"), db.Collection("meal_plan_versions")),
+		recipeService:  services.NewRecipeService(db.Collection("recipes"), db.Collection("ingredients"), db.Collection("meals")),
+		pantry:         services.NewPantryStore(db.Collection("pantry_items")),
+		shoppingLists:  shoppingLists,
+	}
+}
+
+// shoppingListResponse adds the items grouped by aisle to a list
+func shoppingListResponse(list models.ShoppingList) gin.H {
+	return gin.H{"list": list, "aisles": services.ShoppingAisles(list)}
+}
+
+// shoppingList loads the list named in the URL, answering 404 unless it
+// belongs to the user
+func (sc *ShoppingController) shoppingList(c *gin.Context, userID primitive.ObjectID) (*models.ShoppingList, bool) {
+	listID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shopping list ID"})
+		return nil, false
+	}
+	list, err := sc.shoppingLists.Get(context.Background(), userID, listID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shopping list"})
+		return nil, false
+	}
+	if list == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shopping list not found"})
+		return nil, false
+	}
+	return list, true
+}
+
+// GenerateShoppingList builds the shopping list for a date range of the plan,
+// by default the coming week, less what the user's pantry holds that hasn't
+// expired
+func (sc *ShoppingController) GenerateShoppingList(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var request models.ShoppingListRequest
+	if err := c.ShouldBindJSON(&request); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	var user models.User
+	if err := sc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	today := user.Today(time.Now())
+	if request.StartDate == "" {
+		request.StartDate = models.FormatDate(today)
+	}
+	if request.EndDate == "" {
+		start, err := models.ParseDate(request.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		request.EndDate = models.FormatDate(start.AddDate(0, 0, shoppingListDays-1))
+	}
+	start, end, err := models.ParseDateRange(request.StartDate, request.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	startDate, endDate := models.FormatDate(start), models.FormatDate(end)
+
+	ctx := c.Request.Context()
+	plans, err := sc.mealPlans.Between(ctx, userID, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch meal plan"})
+		return
+	}
+	days := models.DaysInRange(plans, startDate, endDate)
+	if len(days) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No meals planned from %s to %s", startDate, endDate)})
+		return
+	}
+
+	var mealIDs []primitive.ObjectID
+	for _, dailyMeals := range days {
+		mealIDs = append(mealIDs, dailyMeals.MealIDs()...)
+	}
+	recipes, err := sc.recipeService.RecipesForMeals(ctx, mealIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipes"})
+		return
+	}
+	var ingredientIDs []primitive.ObjectID
+	for _, recipe := range recipes {
+		for _, item := range recipe.Ingredients {
+			ingredientIDs = append(ingredientIDs, item.IngredientID)
+		}
+	}
+	ingredients, err := sc.recipeService.IngredientsByID(ctx, ingredientIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+	pantry, err := sc.pantry.Items(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pantry"})
+		return
+	}
+
+	list := services.BuildShoppingList(days, recipes, ingredients, services.UnexpiredPantry(pantry, today))
+	list.UserID = userID
+	list.StartDate = startDate
+	list.EndDate = endDate
+	if err := sc.shoppingLists.Save(ctx, &list, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save shopping list"})
+		return
+	}
+	c.JSON(http.StatusOK, shoppingListResponse(list))
+}
+
+// ListShoppingLists returns the user's shopping lists, most recent first
+func (sc *ShoppingController) ListShoppingLists(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	lists, err := sc.shoppingLists.List(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shopping lists"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lists": lists})
+}
+
+// GetShoppingList returns one list with its items grouped by aisle
+func (sc *ShoppingController) GetShoppingList(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+	list, ok := sc.shoppingList(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, shoppingListResponse(*list))
+}
+
+// CheckShoppingItem checks an item off a list, or back on
+func (sc *ShoppingController) CheckShoppingItem(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+	listID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shopping list ID"})
+		return
+	}
+
+	var request models.CheckShoppingItemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	found, err := sc.shoppingLists.SetChecked(context.Background(), userID, listID, c.Param("key"), *request.Checked, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shopping list"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shopping list item not found"})
+		return
+	}
+
+	list, ok := sc.shoppingList(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, shoppingListResponse(*list))
+}
+
+// ExportShoppingList downloads a list as plain text or CSV
+func (sc *ShoppingController) ExportShoppingList(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "text")
+	var write func(io.Writer, models.ShoppingList) error
+	var contentType, extension string
+	switch format {
+	case "text":
+		write, contentType, extension = services.WriteShoppingListText, "text/plain; charset=utf-8", "txt"
+	case "csv":
+		write, contentType, extension = services.WriteShoppingListCSV, "text/csv; charset=utf-8", "csv"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be text or csv"})
+		return
+	}
+
+	list, ok := sc.shoppingList(c, userID)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="shopping-%s-%s.%s"`, list.StartDate, list.EndDate, extension))
+	c.Status(http.StatusOK)
+	if err := write(c.Writer, *list); err != nil {
+		log.Printf("Shopping list export failed: %v", err)
+	}
+}
+
+// DeleteShoppingList removes one of the user's lists
+func (sc *ShoppingController) DeleteShoppingList(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+	listID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shopping list ID"})
+		return
+	}
+
+	deleted, err := sc.shoppingLists.Delete(context.Background(), userID, listID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shopping list"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shopping list not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Shopping list deleted"})
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"figorate/models"
+	"figorate/services"
+	"figorate/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newImageService builds the image service on the configured storage backend.
+// A misconfigured backend disables uploads rather than the whole API.
+func newImageService() *services.ImageService {
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Printf("Image uploads disabled: %v", err)
+		return nil
+	}
+	return services.NewImageService(store)
+}
+
+// readImageUpload reads the "image" file of a multipart request, writing an
+// error response and returning false when it is missing or too large
+func readImageUpload(c *gin.Context) ([]byte, bool) {
+	maxBytes := services.ImageMaxBytes()
+	// Leave room for the multipart envelope around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+
+	header, err := c.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large", "max_bytes": maxBytes})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An image file is required"})
+		return nil, false
+	}
+	if header.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large", "max_bytes": maxBytes})
+		return nil, false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return nil, false
+	}
+	return data, true
+}
+
+// uploadImage stores an uploaded image under prefix, writing an error response
+// and returning nil when the upload is rejected or cannot be stored
+func uploadImage(c *gin.Context, images *services.ImageService, prefix string) *models.ImageSet {
+	if images == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Image uploads are not configured"})
+		return nil
+	}
+
+	data, ok := readImageUpload(c)
+	if !ok {
+		return nil
+	}
+
+	set, err := images.Upload(c.Request.Context(), prefix, data)
+	if err != nil {
+		var invalid *services.InvalidImageError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Reason})
+			return nil
+		}
+		log.Printf("Image upload failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+		return nil
+	}
+	return set
+}
@@ -3,12 +3,15 @@ package controllers
 import (
 	"context"
 	"log"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"figorate/database"
 	"figorate/helpers"
 	"figorate/models"
+	"figorate/services"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -18,11 +21,15 @@ import (
 
 type UserController struct {
 	userCollection *mongo.Collection
+	usageService   *services.UsageService
+	images         *services.ImageService
 }
 
 func NewUserController() *UserController {
 	return &UserController{
 		userCollection: database.GetDatabase().Collection("users"),
+		usageService:   services.NewUsageService(database.GetDatabase().Collection("ai_usage"), database.GetDatabase().Collection("ai_quotas")),
+		images:         newImageService(),
 	}
 }
 
@@ -54,6 +61,11 @@ func (uc *UserController) GetProfile(c *gin.Context) {
 		"firstName": user.FirstName,
 		"lastName":  user.LastName,
 		"createdAt": user.CreatedAt,
+
+		"profilePicture": user.ProfilePicture,
+		"profileImages":  user.ProfileImages,
+		"timezone":       user.Location().String(),
+		"mealSlots":      user.Slots(),
 	}
 
 	c.JSON(http.StatusOK, profile)
@@ -85,22 +97,378 @@ func (uc *UserController) CompleteOnboarding(c *gin.Context) {
 		return
 	}
 
+	fields := bson.M{
+		"gender":               onboardingRequest.Gender,
+		"birthdate":            onboardingRequest.Birthdate,
+		"health_goals":         onboardingRequest.HealthGoals,
+		"medical_conditions":   onboardingRequest.MedicalConditions,
+		"nutrition_preference": onboardingRequest.NutritionPreference,
+		"allergens":            onboardingRequest.Allergens,
+		"dietary_restrictions": onboardingRequest.DietaryRestrictions,
+		"updated_at":           time.Now(),
+	}
+	if onboardingRequest.Timezone != "" {
+		fields["timezone"] = onboardingRequest.Timezone
+	}
+
+	// Body metrics are optional at onboarding; with them the user gets calorie and macro targets
+	if metrics := onboardingRequest.BodyMetrics; metrics != nil {
+		user := models.User{
+			Gender:        onboardingRequest.Gender,
+			Birthdate:     onboardingRequest.Birthdate,
+			HealthGoals:   onboardingRequest.HealthGoals,
+			Timezone:      onboardingRequest.Timezone,
+			ActivityLevel: metrics.ActivityLevel,
+			UnitSystem:    metrics.UnitSystem,
+		}
+		user.HeightCm, user.WeightKg = helpers.BodyMetricsToMetric(metrics.UnitSystem, metrics.Height, metrics.Weight)
+		targets, err := services.ComputeTargets(user, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for key, value := range bodyMetricsFields(user, targets) {
+			fields[key] = value
+		}
+	} else {
+		// Goals or birthdate may have changed, so refresh targets from stored metrics
+		var user models.User
+		if err := uc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err == nil && user.HeightCm > 0 {
+			user.Gender = onboardingRequest.Gender
+			user.Birthdate = onboardingRequest.Birthdate
+			user.HealthGoals = onboardingRequest.HealthGoals
+			if onboardingRequest.Timezone != "" {
+				user.Timezone = onboardingRequest.Timezone
+			}
+			if targets, err := services.ComputeTargets(user, time.Now()); err == nil {
+				fields["nutrition_targets"] = targets
+			}
+		}
+	}
+
 	filter := bson.M{"_id": userID}
-	update := bson.M{
+	update := bson.M{"$set": fields}
+
+	_, err = uc.userCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding information"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Onboarding completed successfully"})
+}
+
+// GetDietaryProfile returns the user's allergens and restrictions, including
+// the allergens their restrictions rule out
+func (uc *UserController) GetDietaryProfile(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := uc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dietaryProfileResponse(services.UserDietaryProfile(user)))
+}
+
+// UpdateDietaryProfile replaces the user's allergens and restrictions. The
+// legacy nutrition preference is folded into the restrictions and cleared.
+func (uc *UserController) UpdateDietaryProfile(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var request models.DietaryProfileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	if err := helpers.ValidateAllergens(request.Allergens); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := helpers.ValidateDietaryRestrictions(request.DietaryRestrictions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile := services.UserDietaryProfile(models.User{
+		Allergens:           request.Allergens,
+		DietaryRestrictions: request.DietaryRestrictions,
+	})
+
+	result, err := uc.userCollection.UpdateOne(context.Background(), bson.M{"_id": userID}, bson.M{
 		"$set": bson.M{
-			"gender":               onboardingRequest.Gender,
-			"birthdate":            onboardingRequest.Birthdate,
-			"health_goals":         onboardingRequest.HealthGoals,
-			"medical_conditions":   onboardingRequest.MedicalConditions,
-			"nutrition_preference": onboardingRequest.NutritionPreference,
+			"allergens":            profile.Allergens,
+			"dietary_restrictions": profile.Restrictions,
+			"nutrition_preference": "",
 			"updated_at":           time.Now(),
 		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update dietary profile"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
 	}
 
-	_, err = uc.userCollection.UpdateOne(context.Background(), filter, update)
+	c.JSON(http.StatusOK, dietaryProfileResponse(profile))
+}
+
+func dietaryProfileResponse(profile services.DietaryProfile) gin.H {
+	return gin.H{
+		"allergens":            profile.Allergens,
+		"dietary_restrictions": profile.Restrictions,
+		"excluded_allergens":   profile.ExcludedAllergens(),
+	}
+}
+
+// GetNutritionTargets returns the user's body metrics in their preferred units
+// together with the daily targets computed from them
+func (uc *UserController) GetNutritionTargets(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := uc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding information"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Onboarding completed successfully"})
+	if user.NutritionTargets == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No nutrition targets yet, set your body metrics first"})
+		return
+	}
+
+	c.JSON(http.StatusOK, nutritionTargetsResponse(user, user.NutritionTargets))
+}
+
+// UpdateBodyMetrics stores the user's height, weight, activity level and unit
+// preference and recomputes their daily targets
+func (uc *UserController) UpdateBodyMetrics(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var request models.BodyMetricsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+
+	var user models.User
+	err := uc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.HeightCm, user.WeightKg = helpers.BodyMetricsToMetric(request.UnitSystem, request.Height, request.Weight)
+	user.ActivityLevel = request.ActivityLevel
+	user.UnitSystem = request.UnitSystem
+	if err := helpers.ValidateBodyMetrics(user.HeightCm, user.WeightKg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	targets, err := services.ComputeTargets(user, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to compute targets: " + err.Error() + ", complete onboarding first"})
+		return
+	}
+
+	fields := bodyMetricsFields(user, targets)
+	fields["updated_at"] = time.Now()
+	_, err = uc.userCollection.UpdateOne(context.Background(), bson.M{"_id": userID}, bson.M{"$set": fields})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update body metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, nutritionTargetsResponse(user, targets))
+}
+
+// UpdateTimezone sets the IANA timezone the user's plan dates follow
+func (uc *UserController) UpdateTimezone(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var request models.UpdateTimezoneRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	loc, err := models.LoadTimezone(request.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	result, err := uc.userCollection.UpdateOne(context.Background(), bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"timezone": loc.String(), "updated_at": now}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timezone"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"timezone": loc.String(), "today": models.FormatDate(models.LocalDate(now, loc))})
+}
+
+// GetMealSlots returns the meals of the user's day, the defaults until they configure their own
+func (uc *UserController) GetMealSlots(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := uc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"slots": user.Slots(), "default": len(user.MealSlots) == 0})
+}
+
+// UpdateMealSlots replaces the meals of the user's day. Plans generated from
+// now on use the new slots; existing plans keep theirs.
+func (uc *UserController) UpdateMealSlots(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var request models.UpdateMealSlotsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.GenerateValidationError(err)})
+		return
+	}
+	for i := range request.Slots {
+		request.Slots[i].Name = strings.ToLower(strings.TrimSpace(request.Slots[i].Name))
+		request.Slots[i].Category = strings.ToLower(strings.TrimSpace(request.Slots[i].Category))
+	}
+	if err := helpers.ValidateMealSlots(request.Slots); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := uc.userCollection.UpdateOne(context.Background(), bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"meal_slots": request.Slots, "updated_at": time.Now()}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update meal slots"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"slots": request.Slots, "default": false})
+}
+
+func bodyMetricsFields(user models.User, targets *models.NutritionTargets) bson.M {
+	return bson.M{
+		"height_cm":         user.HeightCm,
+		"weight_kg":         user.WeightKg,
+		"activity_level":    user.ActivityLevel,
+		"unit_system":       user.UnitSystem,
+		"nutrition_targets": targets,
+	}
+}
+
+func nutritionTargetsResponse(user models.User, targets *models.NutritionTargets) gin.H {
+	height, weight := helpers.BodyMetricsFromMetric(user.UnitSystem, user.HeightCm, user.WeightKg)
+	return gin.H{
+		"unit_system":    user.UnitSystem,
+		"height":         math.Round(height*10) / 10,
+		"weight":         math.Round(weight*10) / 10,
+		"activity_level": user.ActivityLevel,
+		"targets":        targets,
+		"tolerance":      services.TargetTolerance(),
+	}
+}
+
+// UploadProfilePicture stores an uploaded profile picture in the standard sizes,
+// replacing the previous one
+func (uc *UserController) UploadProfilePicture(c *gin.Context) {
+	userID, ok := authenticatedUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := uc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	set := uploadImage(c, uc.images, "users/"+userID.Hex())
+	if set == nil {
+		return
+	}
+
+	_, err = uc.userCollection.UpdateOne(context.Background(), bson.M{"_id": userID}, bson.M{
+		"$set": bson.M{
+			"profile_picture": set.Medium,
+			"profile_images":  set,
+			"updated_at":      time.Now(),
+		},
+	})
+	if err != nil {
+		uc.images.Replace(context.Background(), set, user.ProfileImages)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile picture"})
+		return
+	}
+	uc.images.Replace(context.Background(), user.ProfileImages, set)
+
+	c.JSON(http.StatusOK, gin.H{"profilePicture": set.Medium, "profileImages": set})
+}
+
+// GetAIUsage reports how much of today's AI quota the user has consumed
+func (uc *UserController) GetAIUsage(c *gin.Context) {
+	userIDHex, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDHex.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	err = uc.userCollection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	quota, err := uc.usageService.CheckQuota(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check AI usage quota"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"quota": quota, "exceeded": quota.Exceeded()})
 }
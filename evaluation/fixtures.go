@@ -0,0 +1,111 @@
+package evaluation
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"figorate/models"
+	"figorate/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fixture is one user profile and catalogue replayed through the planners
+type Fixture struct {
+	Name                string        `json:"name"`
+	NutritionPreference string        `json:"nutrition_preference"`
+	HealthGoals         []string      `json:"health_goals"`
+	MedicalConditions   []string      `json:"medical_conditions"`
+	Allergens           []string      `json:"allergens"`
+	DietaryRestrictions []string      `json:"dietary_restrictions"`
+	Days                int           `json:"days"`
+	Meals               []models.Meal `json:"meals"`
+	// MealSlots are the fixture user's meals of the day, DefaultMealSlots when empty
+	MealSlots []models.MealSlot `json:"meal_slots,omitempty"`
+}
+
+// Request builds the planner input for the fixture. Like the meal controller,
+// only meals the user's allergens and restrictions allow are offered to the
+// planner, and the built-in medical condition rules become constraints.
+func (f Fixture) Request() services.MealPlanRequest {
+	dietary := f.DietaryProfile()
+	rules := services.RulesFor(services.DefaultConditionRules(), f.MedicalConditions)
+	return services.MealPlanRequest{
+		UserPreference:      f.NutritionPreference,
+		HealthGoals:         f.HealthGoals,
+		MedicalConditions:   f.MedicalConditions,
+		Allergens:           dietary.Allergens,
+		DietaryRestrictions: dietary.Restrictions,
+		AvailableMeals:      services.FilterMealsForConditions(dietary.FilterMeals(f.Meals), rules),
+		DaysToGenerate:      f.Days,
+		Constraints:         services.ConditionConstraints(rules),
+		Slots:               f.Slots(),
+	}
+}
+
+// Slots returns the fixture user's meal slots
+func (f Fixture) Slots() []models.MealSlot {
+	return models.MealSlotsOrDefault(f.MealSlots)
+}
+
+// DietaryProfile is the fixture user's allergens and restrictions
+func (f Fixture) DietaryProfile() services.DietaryProfile {
+	return services.UserDietaryProfile(models.User{
+		NutritionPreference: f.NutritionPreference,
+		Allergens:           f.Allergens,
+		DietaryRestrictions: f.DietaryRestrictions,
+	})
+}
+
+// LoadFixtures reads every *.json fixture in dir, ordered by name
+func LoadFixtures(dir string) ([]Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fixtures: %v", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixtures found in %s", dir)
+	}
+
+	fixtures := make([]Fixture, 0, len(paths))
+	for _, path := range paths {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %v", path, err)
+		}
+
+		var fixture Fixture
+		if err := json.Unmarshal(body, &fixture); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %v", path, err)
+		}
+		if fixture.Name == "" {
+			fixture.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if fixture.Days <= 0 {
+			fixture.Days = 7
+		}
+		for i, meal := range fixture.Meals {
+			if meal.ID.IsZero() {
+				fixture.Meals[i].ID = fixtureMealID(fixture.Name, meal.Name)
+			}
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	sort.Slice(fixtures, func(i, j int) bool { return fixtures[i].Name < fixtures[j].Name })
+	return fixtures, nil
+}
+
+// fixtureMealID derives a stable ID for a fixture meal, as plans reference
+// meals by ID and reports should not change from run to run
+func fixtureMealID(fixture, meal string) primitive.ObjectID {
+	sum := sha256.Sum256([]byte(fixture + "/" + meal))
+	var id primitive.ObjectID
+	copy(id[:], sum[:])
+	return id
+}
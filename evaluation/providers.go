@@ -0,0 +1,155 @@
+package evaluation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"figorate/models"
+	"figorate/services"
+)
+
+// RecordedTransport replays a saved chat completion response instead of calling the provider
+type RecordedTransport struct {
+	Path string
+}
+
+func (t *RecordedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := os.ReadFile(t.Path)
+	if err != nil {
+		return nil, fmt.Errorf("no recorded response: %v", err)
+	}
+	return jsonResponse(req, body), nil
+}
+
+// RecordingTransport forwards requests to the real provider and saves each successful response to Path
+type RecordingTransport struct {
+	Path string
+	Next http.RoundTripper
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %v", err)
+	}
+	if err := os.WriteFile(t.Path, body, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to save recording: %v", err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// UnknownFakeMeal is the meal FakePlan names that no catalogue has
+const UnknownFakeMeal = "Chef's Special"
+
+// FakePlan is a deliberately careless answer to request, so the fake planner
+// scores visibly below a good one: each slot only ever alternates between the
+// first two meals of its category, and the last slot of the last day names a
+// meal that isn't in the catalogue.
+func FakePlan(request services.MealPlanRequest) map[int]map[string]string {
+	mealsByCategory := services.GroupMealsByCategory(request.AvailableMeals)
+	slots := models.MealSlotsOrDefault(request.Slots)
+
+	plan := make(map[int]map[string]string, request.DaysToGenerate)
+	for day := 1; day <= request.DaysToGenerate; day++ {
+		names := make(map[string]string, len(slots))
+		for _, slot := range slots {
+			meals := mealsByCategory[slot.Category]
+			if len(meals) > 2 {
+				meals = meals[:2]
+			}
+			if len(meals) > 0 {
+				names[slot.Name] = meals[day%len(meals)].Name
+			}
+		}
+		plan[day] = names
+	}
+	if last := plan[request.DaysToGenerate]; last != nil && len(slots) > 0 {
+		last[slots[len(slots)-1].Name] = UnknownFakeMeal
+	}
+	return plan
+}
+
+// FakeTransport answers every chat completion with a fixed plan of meal
+// names, exercising prompt rendering and response parsing without a provider.
+// It answers as whichever model was asked for.
+type FakeTransport struct {
+	Plan map[int]map[string]string
+}
+
+func (t *FakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	content, err := json.Marshal(t.Plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode fake plan: %v", err)
+	}
+
+	prompt, _ := io.ReadAll(req.Body)
+	var asked struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(prompt, &asked); err != nil {
+		return nil, fmt.Errorf("failed to decode fake request: %v", err)
+	}
+	promptTokens := len(prompt) / 4
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": asked.Model,
+		"choices": []interface{}{
+			map[string]interface{}{
+				"message": map[string]interface{}{"role": "assistant", "content": string(content)},
+			},
+		},
+		"usage": models.TokenUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: len(content) / 4,
+			TotalTokens:      promptTokens + len(content)/4,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode fake response: %v", err)
+	}
+	return jsonResponse(req, body), nil
+}
+
+// PromptPlanner generates plans with one version of the meal plan prompt,
+// whichever is active, so prompt versions can be compared side by side
+type PromptPlanner struct {
+	Service *services.AIService
+	Prompt  *models.PromptTemplate
+}
+
+func (p PromptPlanner) GenerateMealPlan(ctx context.Context, request services.MealPlanRequest) (*services.MealPlanResult, error) {
+	return p.Service.GenerateMealPlanFromPrompt(ctx, p.Prompt, request)
+}
+
+func jsonResponse(req *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,149 @@
+package evaluation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"figorate/models"
+	"figorate/services"
+)
+
+// Planner names a way of producing plans. New is called once per fixture so
+// providers such as recorded responses can be fixture specific. AI planners
+// run once per prompt version and model compared, labelled by Prompt and
+// Model.
+type Planner struct {
+	Name   string
+	Prompt string
+	Model  string
+	New    func(fixture Fixture) (services.MealPlanner, error)
+}
+
+// Result is one planner's plan for one fixture
+type Result struct {
+	Fixture       string            `json:"fixture"`
+	Planner       string            `json:"planner"`
+	Model         string            `json:"model,omitempty"`
+	PromptVersion string            `json:"prompt_version,omitempty"`
+	Scores        Scores            `json:"scores"`
+	Usage         models.TokenUsage `json:"usage"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// Summary averages a planner's scores, for one prompt version and model, over
+// the fixtures it completed
+type Summary struct {
+	Planner string `json:"planner"`
+	Prompt  string `json:"prompt,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Runs    int    `json:"runs"`
+	Failed  int    `json:"failed"`
+	Scores  Scores `json:"scores"`
+}
+
+type Report struct {
+	Results []Result  `json:"results"`
+	Summary []Summary `json:"summary"`
+}
+
+// Run replays every fixture through every planner and scores the plans
+func Run(ctx context.Context, fixtures []Fixture, planners []Planner) Report {
+	var report Report
+	for _, planner := range planners {
+		summary := Summary{Planner: planner.Name, Prompt: planner.Prompt, Model: planner.Model}
+
+		for _, fixture := range fixtures {
+			result := Result{Fixture: fixture.Name, Planner: planner.Name, PromptVersion: planner.Prompt, Model: planner.Model}
+
+			generated, err := generate(ctx, planner, fixture)
+			if err != nil {
+				result.Error = err.Error()
+				summary.Failed++
+			} else {
+				result.Model = generated.Model
+				result.PromptVersion = generated.PromptVersion
+				result.Usage = generated.Usage
+				result.Scores = Score(fixture, generated.Days)
+				summary.Runs++
+				addScores(&summary.Scores, result.Scores)
+			}
+			report.Results = append(report.Results, result)
+		}
+
+		if summary.Runs > 0 {
+			divideScores(&summary.Scores, summary.Runs)
+		}
+		report.Summary = append(report.Summary, summary)
+	}
+	return report
+}
+
+func generate(ctx context.Context, planner Planner, fixture Fixture) (*services.MealPlanResult, error) {
+	mealPlanner, err := planner.New(fixture)
+	if err != nil {
+		return nil, err
+	}
+	return mealPlanner.GenerateMealPlan(ctx, fixture.Request())
+}
+
+func addScores(total *Scores, s Scores) {
+	total.Variety += s.Variety
+	total.CalorieBalance += s.CalorieBalance
+	total.PreferenceCompliance += s.PreferenceCompliance
+	total.PrepTimeDistribution += s.PrepTimeDistribution
+	total.Overall += s.Overall
+	total.UnknownMeals += s.UnknownMeals
+	total.MissingSlots += s.MissingSlots
+}
+
+func divideScores(total *Scores, n int) {
+	total.Variety /= float64(n)
+	total.CalorieBalance /= float64(n)
+	total.PreferenceCompliance /= float64(n)
+	total.PrepTimeDistribution /= float64(n)
+	total.Overall /= float64(n)
+}
+
+// WriteText prints per-fixture results followed by a comparison of the
+// planners, prompt versions and models, showing each one's overall score
+// relative to the first
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "FIXTURE\tPLANNER\tPROMPT\tMODEL\tVARIETY\tCALORIES\tPREFERENCE\tPREP\tOVERALL\tUNKNOWN\tMISSING\tTOKENS")
+	for _, result := range r.Results {
+		if result.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\terror: %s\n", result.Fixture, result.Planner, result.Error)
+			continue
+		}
+		s := result.Scores
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%d\t%d\t%d\n",
+			result.Fixture, result.Planner, orDash(result.PromptVersion), orDash(result.Model),
+			s.Variety, s.CalorieBalance, s.PreferenceCompliance, s.PrepTimeDistribution, s.Overall,
+			s.UnknownMeals, s.MissingSlots, result.Usage.TotalTokens)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "PLANNER\tPROMPT\tMODEL\tRUNS\tFAILED\tVARIETY\tCALORIES\tPREFERENCE\tPREP\tOVERALL\tDELTA")
+	for i, summary := range r.Summary {
+		s := summary.Scores
+		delta := "-"
+		if i > 0 && r.Summary[0].Runs > 0 && summary.Runs > 0 {
+			delta = fmt.Sprintf("%+.2f", s.Overall-r.Summary[0].Scores.Overall)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%s\n",
+			summary.Planner, orDash(summary.Prompt), orDash(summary.Model), summary.Runs, summary.Failed,
+			s.Variety, s.CalorieBalance, s.PreferenceCompliance, s.PrepTimeDistribution, s.Overall, delta)
+	}
+
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+package evaluation
+
+import (
+	"math"
+	"strings"
+
+	"figorate/models"
+)
+
+// Scores rates a plan from 0 (worst) to 1 (best) on the rules the meal plan prompt asks for
+type Scores struct {
+	Variety              float64 `json:"variety"`
+	CalorieBalance       float64 `json:"calorie_balance"`
+	PreferenceCompliance float64 `json:"preference_compliance"` // slots the user's allergens and restrictions allow
+	PrepTimeDistribution float64 `json:"prep_time_distribution"`
+	Overall              float64 `json:"overall"`
+	UnknownMeals         int     `json:"unknown_meals"` // names not in the catalogue
+	MissingSlots         int     `json:"missing_slots"` // empty slots or missing days
+}
+
+// Score evaluates a generated plan against the fixture it was generated for
+func Score(fixture Fixture, days map[int]models.DailyMeals) Scores {
+	catalogue := make(map[string]models.Meal, len(fixture.Meals))
+	availablePerCategory := make(map[string]int)
+	for _, meal := range fixture.Meals {
+		catalogue[strings.ToLower(meal.Name)] = meal
+	}
+	for _, meal := range fixture.Request().AvailableMeals {
+		availablePerCategory[meal.Category]++
+	}
+	slots := fixture.Slots()
+
+	dietary := fixture.DietaryProfile()
+	var scores Scores
+	totalSlots := fixture.Days * len(slots)
+	used := make(map[string]bool)
+	compliant := 0
+	consecutiveRepeats := 0
+	dailyCalories := make([]float64, 0, fixture.Days)
+	dailyPrep := make([]float64, 0, fixture.Days)
+
+	var previous models.DailyMeals
+	for day := 1; day <= fixture.Days; day++ {
+		dailyMeals, exists := days[day]
+		if !exists {
+			scores.MissingSlots += len(slots)
+			previous = models.DailyMeals{}
+			continue
+		}
+
+		calories, prep := 0, 0
+		for _, slot := range slots {
+			planned, _ := dailyMeals.Get(slot.Name)
+			name := planned.Name
+			if name == "" {
+				scores.MissingSlots++
+				continue
+			}
+
+			meal, known := catalogue[strings.ToLower(name)]
+			if !known {
+				scores.UnknownMeals++
+				continue
+			}
+
+			used[strings.ToLower(name)] = true
+			calories += meal.Calories
+			prep += meal.Preptime
+
+			if previousMeal, _ := previous.Get(slot.Name); strings.EqualFold(previousMeal.Name, name) {
+				consecutiveRepeats++
+			}
+			if allowed, _ := dietary.Allows(meal); meal.Category == slot.Category && allowed {
+				compliant++
+			}
+		}
+
+		dailyCalories = append(dailyCalories, float64(calories))
+		dailyPrep = append(dailyPrep, float64(prep))
+		previous = dailyMeals
+	}
+
+	if totalSlots == 0 {
+		return scores
+	}
+
+	// Variety: distinct meals used relative to what the catalogue allows, minus back-to-back repeats
+	slotsPerCategory := make(map[string]int)
+	for _, slot := range slots {
+		slotsPerCategory[slot.Category]++
+	}
+	possible := 0
+	for category, count := range slotsPerCategory {
+		possible += min(availablePerCategory[category], count*fixture.Days)
+	}
+	if possible > 0 {
+		scores.Variety = clamp(float64(len(used))/float64(possible)) * (1 - float64(consecutiveRepeats)/float64(totalSlots))
+	}
+
+	scores.CalorieBalance = clamp(1 - 2*coefficientOfVariation(dailyCalories))
+	scores.PrepTimeDistribution = clamp(1 - 2*coefficientOfVariation(dailyPrep))
+	scores.PreferenceCompliance = float64(compliant) / float64(totalSlots)
+	scores.Overall = (scores.Variety + scores.CalorieBalance + scores.PreferenceCompliance + scores.PrepTimeDistribution) / 4
+
+	return scores
+}
+
+func coefficientOfVariation(values []float64) float64 {
+	if len(values) == 0 {
+		return 1
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 1
+	}
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance/float64(len(values))) / mean
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
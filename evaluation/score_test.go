@@ -0,0 +1,101 @@
+package evaluation
+
+import (
+	"math"
+	"testing"
+
+	"figorate/models"
+)
+
+// scoreFixture is a vegetarian user with two slots over two days. Steak is
+// in the catalogue but not offered, so it only shows up in careless plans.
+var scoreFixture = Fixture{
+	Name:                "score",
+	DietaryRestrictions: []string{"vegetarian"},
+	Days:                2,
+	MealSlots: []models.MealSlot{
+		{Name: "breakfast", Category: "breakfast", CalorieShare: 0.4},
+		{Name: "dinner", Category: "dinner", CalorieShare: 0.6},
+	},
+	Meals: []models.Meal{
+		{Name: "Overnight Oats", Category: "breakfast", Calories: 400, Preptime: 10, Tags: []string{"vegetarian"}},
+		{Name: "Veggie Omelette", Category: "breakfast", Calories: 400, Preptime: 10, Tags: []string{"vegetarian"}},
+		{Name: "Pasta Primavera", Category: "dinner", Calories: 600, Preptime: 20, Tags: []string{"vegetarian"}},
+		{Name: "Steak", Category: "dinner", Calories: 600, Preptime: 20},
+	},
+}
+
+func planOf(days ...map[string]string) map[int]models.DailyMeals {
+	plan := make(map[int]models.DailyMeals, len(days))
+	for i, names := range days {
+		if names == nil {
+			continue
+		}
+		dailyMeals := models.DailyMeals{}
+		for slot, name := range names {
+			dailyMeals.Set(slot, models.PlannedMeal{Name: name})
+		}
+		plan[i+1] = dailyMeals
+	}
+	return plan
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    map[int]models.DailyMeals
+		want    Scores
+		overall float64
+	}{
+		{
+			// Only one dinner is allowed, so repeating it is the one blemish
+			name: "compliant plan",
+			days: planOf(
+				map[string]string{"breakfast": "Overnight Oats", "dinner": "Pasta Primavera"},
+				map[string]string{"breakfast": "veggie omelette", "dinner": "Pasta Primavera"},
+			),
+			want:    Scores{Variety: 0.75, CalorieBalance: 1, PreferenceCompliance: 1, PrepTimeDistribution: 1},
+			overall: 0.9375,
+		},
+		{
+			name: "restricted, unknown and missing meals",
+			days: planOf(
+				map[string]string{"breakfast": "Overnight Oats", "dinner": "Steak"},
+				map[string]string{"breakfast": "Chef's Special"},
+			),
+			want: Scores{Variety: 2.0 / 3, PreferenceCompliance: 0.25, UnknownMeals: 1, MissingSlots: 1},
+		},
+		{
+			name: "missing day",
+			days: planOf(map[string]string{"breakfast": "Overnight Oats", "dinner": "Pasta Primavera"}, nil),
+			want: Scores{Variety: 2.0 / 3, CalorieBalance: 1, PreferenceCompliance: 0.5, PrepTimeDistribution: 1, MissingSlots: 2},
+		},
+	}
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(scoreFixture, tt.days)
+			if !near(got.Variety, tt.want.Variety) || !near(got.CalorieBalance, tt.want.CalorieBalance) ||
+				!near(got.PreferenceCompliance, tt.want.PreferenceCompliance) || !near(got.PrepTimeDistribution, tt.want.PrepTimeDistribution) {
+				t.Errorf("Score = %+v, want %+v", got, tt.want)
+			}
+			if got.UnknownMeals != tt.want.UnknownMeals || got.MissingSlots != tt.want.MissingSlots {
+				t.Errorf("Score counted %d unknown and %d missing, want %d and %d",
+					got.UnknownMeals, got.MissingSlots, tt.want.UnknownMeals, tt.want.MissingSlots)
+			}
+			overall := (got.Variety + got.CalorieBalance + got.PreferenceCompliance + got.PrepTimeDistribution) / 4
+			if !near(got.Overall, overall) || (tt.overall != 0 && !near(got.Overall, tt.overall)) {
+				t.Errorf("Overall = %v, want the mean of the four scores", got.Overall)
+			}
+		})
+	}
+}
+
+func TestScoreWithoutDays(t *testing.T) {
+	fixture := scoreFixture
+	fixture.Days = 0
+	if got := Score(fixture, planOf()); got != (Scores{}) {
+		t.Errorf("Score of an empty fixture = %+v, want zero scores", got)
+	}
+}
@@ -0,0 +1,278 @@
+// Package foodimport reads food composition datasets (USDA FoodData Central
+// exports or any CSV described by a column mapping) and loads them into the
+// ingredients collection. Readers stream their input one food at a time so
+// multi-gigabyte exports can be imported with constant memory.
+package foodimport
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"figorate/models"
+)
+
+// Food is one normalized dataset row: calories in kcal and nutrition per 100g
+type Food struct {
+	Source    string
+	SourceID  string
+	Name      string
+	Category  string
+	Calories  float64
+	Nutrition models.Nutrition
+}
+
+// Reader yields foods until io.EOF. Rows that cannot be mapped are returned
+// as *UnmappedError so the caller can report them and carry on.
+type Reader interface {
+	Next() (*Food, error)
+}
+
+// UnmappedError describes a dataset row that was skipped
+type UnmappedError struct {
+	Line     int    `json:"line,omitempty"`
+	SourceID string `json:"source_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (e *UnmappedError) Error() string {
+	return fmt.Sprintf("line %d (%s %s): %s", e.Line, e.SourceID, e.Name, e.Reason)
+}
+
+// Nutrient fields a dataset value can be mapped to. Any other field name is
+// stored as a micronutrient and must end in its unit, e.g. potassium_mg.
+const (
+	FieldCalories      = "calories"
+	FieldProtein       = "protein"
+	FieldCarbohydrates = "carbohydrates"
+	FieldFat           = "fat"
+	FieldFiber         = "fiber"
+	FieldSugar         = "sugar"
+	FieldSodium        = "sodium"
+)
+
+// fieldUnit returns the unit a field is stored in
+func fieldUnit(field string) (string, error) {
+	switch field {
+	case FieldCalories:
+		return "kcal", nil
+	case FieldProtein, FieldCarbohydrates, FieldFat, FieldFiber, FieldSugar:
+		return "g", nil
+	case FieldSodium:
+		return "mg", nil
+	}
+	for _, suffix := range []string{"mg", "mcg", "g"} {
+		if strings.HasSuffix(field, "_"+suffix) {
+			return suffix, nil
+		}
+	}
+	return "", fmt.Errorf("field %s must be a known nutrient or end in _g, _mg or _mcg", field)
+}
+
+// unitFactors converts an amount to grams (mass) or kcal (energy)
+var unitFactors = map[string]struct {
+	dimension string
+	factor    float64
+}{
+	"g":    {"mass", 1},
+	"mg":   {"mass", 0.001},
+	"mcg":  {"mass", 0.000001},
+	"ug":   {"mass", 0.000001},
+	"µg":   {"mass", 0.000001},
+	"kg":   {"mass", 1000},
+	"kcal": {"energy", 1},
+	"kj":   {"energy", 1 / 4.184},
+}
+
+// convertAmount converts between the mass and energy units found in datasets
+func convertAmount(amount float64, from, to string) (float64, error) {
+	source, ok := unitFactors[strings.ToLower(strings.TrimSpace(from))]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit %q", from)
+	}
+	target, ok := unitFactors[to]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit %q", to)
+	}
+	if source.dimension != target.dimension {
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	return amount * source.factor / target.factor, nil
+}
+
+// nutrientValues collects the values of one food, keeping the highest
+// priority value (lowest number) when a dataset reports a field more than once
+type nutrientValues struct {
+	values   map[string]float64
+	priority map[string]int
+}
+
+func newNutrientValues() *nutrientValues {
+	return &nutrientValues{values: map[string]float64{}, priority: map[string]int{}}
+}
+
+func (v *nutrientValues) set(field string, priority int, amount float64, unit string) error {
+	if current, ok := v.priority[field]; ok && current <= priority {
+		return nil
+	}
+	to, err := fieldUnit(field)
+	if err != nil {
+		return err
+	}
+	converted, err := convertAmount(amount, unit, to)
+	if err != nil {
+		return err
+	}
+	v.values[field] = converted
+	v.priority[field] = priority
+	return nil
+}
+
+// food validates the collected values scaled to 100g and builds the Food
+func (v *nutrientValues) food(basisGrams float64) (float64, models.Nutrition, error) {
+	if basisGrams <= 0 {
+		basisGrams = 100
+	}
+	scale := 100 / basisGrams
+
+	calories, ok := v.values[FieldCalories]
+	if !ok {
+		return 0, models.Nutrition{}, fmt.Errorf("no energy value")
+	}
+
+	var nutrition models.Nutrition
+	for field, amount := range v.values {
+		if amount < 0 {
+			return 0, models.Nutrition{}, fmt.Errorf("negative value for %s", field)
+		}
+		amount = roundAmount(amount * scale)
+		switch field {
+		case FieldCalories:
+		case FieldProtein:
+			nutrition.Protein = amount
+		case FieldCarbohydrates:
+			nutrition.Carbohydrates = amount
+		case FieldFat:
+			nutrition.Fat = amount
+		case FieldFiber:
+			nutrition.Fiber = amount
+		case FieldSugar:
+			nutrition.Sugar = amount
+		case FieldSodium:
+			nutrition.Sodium = amount
+		default:
+			if nutrition.Micronutrients == nil {
+				nutrition.Micronutrients = map[string]float64{}
+			}
+			nutrition.Micronutrients[field] = amount
+		}
+	}
+
+	calories = roundAmount(calories * scale)
+	if calories > 900 {
+		return 0, models.Nutrition{}, fmt.Errorf("energy of %.0f kcal per 100g is not plausible", calories)
+	}
+	return calories, nutrition, nil
+}
+
+func roundAmount(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// parseAmount reads a numeric cell. Blank cells and the usual placeholders
+// for "not measured" or "trace" report ok=false rather than an error.
+func parseAmount(cell string) (float64, bool, error) {
+	cell = strings.TrimSpace(cell)
+	switch strings.ToLower(cell) {
+	case "", "-", "n/a", "na", "nd", "tr", "trace":
+		return 0, false, nil
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(cell, ",", "."), 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
+
+// normalizeName tidies whitespace and caps names at the ingredient limit
+func normalizeName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if utf8.RuneCountInString(name) > 100 {
+		name = strings.TrimSpace(string([]rune(name)[:100]))
+	}
+	return name
+}
+
+// NameKey is the case-insensitive key ingredients are de-duplicated on
+func NameKey(name string) string {
+	return strings.ToLower(normalizeName(name))
+}
+
+// Ingredient aisles, matching IngredientRequest's category values
+var aisles = map[string]bool{
+	"produce": true, "meat": true, "seafood": true, "dairy": true, "bakery": true, "grains": true,
+	"canned": true, "frozen": true, "spices": true, "condiments": true, "beverages": true,
+	"snacks": true, "other": true,
+}
+
+// USDA food group IDs (food_category.csv) mapped to aisles
+var usdaCategoryAisles = map[string]string{
+	"1":  "dairy",      // Dairy and Egg Products
+	"2":  "spices",     // Spices and Herbs
+	"4":  "condiments", // Fats and Oils
+	"5":  "meat",       // Poultry Products
+	"6":  "canned",     // Soups, Sauces, and Gravies
+	"7":  "meat",       // Sausages and Luncheon Meats
+	"8":  "grains",     // Breakfast Cereals
+	"9":  "produce",    // Fruits and Fruit Juices
+	"10": "meat",       // Pork Products
+	"11": "produce",    // Vegetables and Vegetable Products
+	"12": "snacks",     // Nut and Seed Products
+	"13": "meat",       // Beef Products
+	"14": "beverages",  // Beverages
+	"15": "seafood",    // Finfish and Shellfish Products
+	"16": "grains",     // Legumes and Legume Products
+	"17": "meat",       // Lamb, Veal, and Game Products
+	"18": "bakery",     // Baked Products
+	"19": "snacks",     // Sweets
+	"20": "grains",     // Cereal Grains and Pasta
+	"23": "snacks",     // Snacks
+}
+
+// Keywords in free-text category names, checked in order
+var categoryKeywords = []struct {
+	keyword string
+	aisle   string
+}{
+	{"seafood", "seafood"}, {"fish", "seafood"}, {"shellfish", "seafood"},
+	{"dairy", "dairy"}, {"egg", "dairy"}, {"cheese", "dairy"}, {"milk", "dairy"}, {"yogurt", "dairy"},
+	{"fruit", "produce"}, {"vegetable", "produce"},
+	{"poultry", "meat"}, {"beef", "meat"}, {"pork", "meat"}, {"lamb", "meat"}, {"sausage", "meat"}, {"meat", "meat"},
+	{"bread", "bakery"}, {"baked", "bakery"},
+	{"cereal", "grains"}, {"grain", "grains"}, {"pasta", "grains"}, {"legume", "grains"}, {"rice", "grains"},
+	{"spice", "spices"}, {"herb", "spices"},
+	{"oil", "condiments"}, {"fat", "condiments"}, {"sauce", "condiments"}, {"condiment", "condiments"},
+	{"frozen", "frozen"}, {"canned", "canned"}, {"soup", "canned"},
+	{"beverage", "beverages"}, {"drink", "beverages"}, {"juice", "beverages"},
+	{"snack", "snacks"}, {"sweet", "snacks"}, {"candy", "snacks"}, {"nut", "snacks"}, {"seed", "snacks"},
+}
+
+// mapCategory turns a dataset category (aisle name, USDA group ID or free text) into an aisle
+func mapCategory(category string) string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if aisles[category] {
+		return category
+	}
+	if aisle, ok := usdaCategoryAisles[category]; ok {
+		return aisle
+	}
+	for _, entry := range categoryKeywords {
+		if strings.Contains(category, entry.keyword) {
+			return entry.aisle
+		}
+	}
+	return "other"
+}
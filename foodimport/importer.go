@@ -0,0 +1,173 @@
+package foodimport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Summary counts what happened to each row of an import
+type Summary struct {
+	Read       int  `json:"read"`
+	Imported   int  `json:"imported"`
+	Duplicates int  `json:"duplicates"`
+	Unmapped   int  `json:"unmapped"`
+	DryRun     bool `json:"dry_run"`
+}
+
+// Importer writes foods into the ingredients collection in batches, skipping
+// any whose name (case-insensitive) or source ID is already present
+type Importer struct {
+	collection *mongo.Collection
+	BatchSize  int
+	DryRun     bool
+	// OnUnmapped is called for every row that could not be mapped
+	OnUnmapped func(UnmappedError)
+}
+
+func NewImporter(collection *mongo.Collection) *Importer {
+	return &Importer{collection: collection, BatchSize: 500}
+}
+
+// EnsureIndexes creates the indexes duplicate checks rely on
+func (im *Importer) EnsureIndexes(ctx context.Context) error {
+	_, err := im.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+		{
+			Keys:    bson.D{{Key: "source", Value: 1}, {Key: "source_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create ingredient indexes: %v", err)
+	}
+	return nil
+}
+
+// Run drains reader into the collection
+func (im *Importer) Run(ctx context.Context, reader Reader) (Summary, error) {
+	summary := Summary{DryRun: im.DryRun}
+	seen := map[string]bool{}
+	batch := make([]*Food, 0, im.BatchSize)
+
+	for {
+		food, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if unmapped, ok := err.(*UnmappedError); ok {
+			summary.Read++
+			summary.Unmapped++
+			if im.OnUnmapped != nil {
+				im.OnUnmapped(*unmapped)
+			}
+			continue
+		}
+		if err != nil {
+			return summary, err
+		}
+		summary.Read++
+
+		key := NameKey(food.Name)
+		if seen[key] {
+			summary.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		batch = append(batch, food)
+		if len(batch) >= im.BatchSize {
+			if err := im.flush(ctx, batch, &summary); err != nil {
+				return summary, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := im.flush(ctx, batch, &summary); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// flush drops foods that already exist and inserts the rest
+func (im *Importer) flush(ctx context.Context, batch []*Food, summary *Summary) error {
+	names := make([]string, 0, len(batch))
+	sourceIDs := map[string][]string{}
+	for _, food := range batch {
+		names = append(names, food.Name)
+		if food.SourceID != "" {
+			sourceIDs[food.Source] = append(sourceIDs[food.Source], food.SourceID)
+		}
+	}
+
+	or := []bson.M{{"name": bson.M{"$in": names}}}
+	for source, ids := range sourceIDs {
+		or = append(or, bson.M{"source": source, "source_id": bson.M{"$in": ids}})
+	}
+
+	findOptions := options.Find().
+		SetProjection(bson.M{"name": 1, "source": 1, "source_id": 1}).
+		SetCollation(&options.Collation{Locale: "en", Strength: 2})
+	cursor, err := im.collection.Find(ctx, bson.M{"$or": or}, findOptions)
+	if err != nil {
+		return fmt.Errorf("failed to check existing ingredients: %v", err)
+	}
+	var existing []models.Ingredient
+	if err := cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("failed to decode existing ingredients: %v", err)
+	}
+
+	existingNames := map[string]bool{}
+	existingSources := map[string]bool{}
+	for _, ingredient := range existing {
+		existingNames[NameKey(ingredient.Name)] = true
+		if ingredient.SourceID != "" {
+			existingSources[ingredient.Source+":"+ingredient.SourceID] = true
+		}
+	}
+
+	now := time.Now()
+	documents := make([]interface{}, 0, len(batch))
+	for _, food := range batch {
+		if existingNames[NameKey(food.Name)] || (food.SourceID != "" && existingSources[food.Source+":"+food.SourceID]) {
+			summary.Duplicates++
+			continue
+		}
+		documents = append(documents, models.Ingredient{
+			ID:               primitive.NewObjectID(),
+			Name:             food.Name,
+			Category:         food.Category,
+			CaloriesPer100g:  food.Calories,
+			NutritionPer100g: food.Nutrition,
+			Source:           food.Source,
+			SourceID:         food.SourceID,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		})
+	}
+
+	if len(documents) == 0 {
+		return nil
+	}
+	if !im.DryRun {
+		if _, err := im.collection.InsertMany(ctx, documents); err != nil {
+			return fmt.Errorf("failed to insert ingredients: %v", err)
+		}
+	}
+	summary.Imported += len(documents)
+	return nil
+}
@@ -0,0 +1,175 @@
+package foodimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"unicode/utf8"
+)
+
+// ColumnMapping points a nutrient field at a CSV column and the unit it is in
+type ColumnMapping struct {
+	Column string `json:"column"`
+	Unit   string `json:"unit"`
+}
+
+// CSVMapping describes how to read a food composition CSV that is not a USDA
+// export. Nutrients maps field names (calories, protein, carbohydrates, fat,
+// fiber, sugar, sodium or a micronutrient such as potassium_mg) to columns.
+// Values are per BasisGrams of food, 100 when unset.
+//
+//	{
+//	  "source": "cofid",
+//	  "name": "Food Name",
+//	  "source_id": "Food Code",
+//	  "category": "Group",
+//	  "delimiter": ";",
+//	  "nutrients": {
+//	    "calories": {"column": "Energy (kJ)", "unit": "kj"},
+//	    "protein": {"column": "Protein (g)", "unit": "g"},
+//	    "sodium": {"column": "Sodium (g)", "unit": "g"}
+//	  }
+//	}
+type CSVMapping struct {
+	Source          string                   `json:"source"`
+	Name            string                   `json:"name"`
+	SourceID        string                   `json:"source_id"`
+	Category        string                   `json:"category"`
+	DefaultCategory string                   `json:"default_category"`
+	Delimiter       string                   `json:"delimiter"`
+	BasisGrams      float64                  `json:"basis_grams"`
+	Nutrients       map[string]ColumnMapping `json:"nutrients"`
+}
+
+// LoadCSVMapping reads a mapping from a JSON file
+func LoadCSVMapping(path string) (CSVMapping, error) {
+	var mapping CSVMapping
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return mapping, fmt.Errorf("failed to read mapping: %v", err)
+	}
+	if err := json.Unmarshal(body, &mapping); err != nil {
+		return mapping, fmt.Errorf("failed to parse mapping: %v", err)
+	}
+	return mapping, mapping.Validate()
+}
+
+// Validate checks the mapping before any rows are read
+func (m *CSVMapping) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("mapping must name the food name column")
+	}
+	if _, ok := m.Nutrients[FieldCalories]; !ok {
+		return fmt.Errorf("mapping must include a calories column")
+	}
+	if utf8.RuneCountInString(m.Delimiter) > 1 {
+		return fmt.Errorf("delimiter must be a single character")
+	}
+	for field, column := range m.Nutrients {
+		to, err := fieldUnit(field)
+		if err != nil {
+			return err
+		}
+		if column.Column == "" {
+			return fmt.Errorf("nutrient %s has no column", field)
+		}
+		unit := column.Unit
+		if unit == "" {
+			unit = to
+		}
+		if _, err := convertAmount(0, unit, to); err != nil {
+			return fmt.Errorf("nutrient %s: %v", field, err)
+		}
+	}
+	return nil
+}
+
+// MappedCSVReader streams rows of a CSV described by a CSVMapping
+type MappedCSVReader struct {
+	reader  *csv.Reader
+	mapping CSVMapping
+	columns map[string]int
+	fields  []string
+	line    int
+}
+
+func NewMappedCSVReader(r io.Reader, mapping CSVMapping) (*MappedCSVReader, error) {
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	if mapping.Source == "" {
+		mapping.Source = "csv"
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	if mapping.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(mapping.Delimiter)
+	}
+
+	required := []string{mapping.Name}
+	fields := make([]string, 0, len(mapping.Nutrients))
+	for field, column := range mapping.Nutrients {
+		required = append(required, column.Column)
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	columns, err := readHeader(reader, required...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MappedCSVReader{reader: reader, mapping: mapping, columns: columns, fields: fields, line: 1}, nil
+}
+
+func (r *MappedCSVReader) Next() (*Food, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read CSV: %v", err)
+	}
+	r.line++
+
+	category := r.mapping.DefaultCategory
+	if r.mapping.Category != "" {
+		if value := cell(row, r.columns, r.mapping.Category); value != "" {
+			category = value
+		}
+	}
+	food := &Food{
+		Source:   r.mapping.Source,
+		SourceID: cell(row, r.columns, r.mapping.SourceID),
+		Name:     normalizeName(cell(row, r.columns, r.mapping.Name)),
+		Category: mapCategory(category),
+	}
+	unmapped := &UnmappedError{Line: r.line, SourceID: food.SourceID, Name: food.Name}
+
+	values := newNutrientValues()
+	for _, field := range r.fields {
+		column := r.mapping.Nutrients[field]
+		amount, present, err := parseAmount(cell(row, r.columns, column.Column))
+		if err != nil {
+			unmapped.Reason = fmt.Sprintf("invalid value for %s", field)
+			return nil, unmapped
+		}
+		if !present {
+			continue
+		}
+		unit := column.Unit
+		if unit == "" {
+			unit, _ = fieldUnit(field)
+		}
+		if err := values.set(field, 0, amount, unit); err != nil {
+			unmapped.Reason = err.Error()
+			return nil, unmapped
+		}
+	}
+
+	return finishFood(food, values, r.mapping.BasisGrams, unmapped)
+}
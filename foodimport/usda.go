@@ -0,0 +1,335 @@
+package foodimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// usdaNutrient maps a FoodData Central nutrient to a field. Priority orders
+// alternatives for the same field, e.g. Atwater energy when plain energy is missing.
+type usdaNutrient struct {
+	Field    string
+	Priority int
+}
+
+// FoodData Central nutrient IDs (nutrient.csv id)
+var usdaNutrientsByID = map[int]usdaNutrient{
+	1008: {FieldCalories, 0},
+	2047: {FieldCalories, 1},
+	2048: {FieldCalories, 2},
+	1062: {FieldCalories, 3}, // kJ
+	1003: {FieldProtein, 0},
+	1004: {FieldFat, 0},
+	1005: {FieldCarbohydrates, 0},
+	1050: {FieldCarbohydrates, 1}, // by summation
+	1079: {FieldFiber, 0},
+	2000: {FieldSugar, 0},
+	1063: {FieldSugar, 1},
+	1093: {FieldSodium, 0},
+	1087: {"calcium_mg", 0},
+	1089: {"iron_mg", 0},
+	1090: {"magnesium_mg", 0},
+	1091: {"phosphorus_mg", 0},
+	1092: {"potassium_mg", 0},
+	1095: {"zinc_mg", 0},
+	1162: {"vitamin_c_mg", 0},
+	1106: {"vitamin_a_mcg", 0},
+	1114: {"vitamin_d_mcg", 0},
+	1178: {"vitamin_b12_mcg", 0},
+	1253: {"cholesterol_mg", 0},
+	1258: {"saturated_fat_g", 0},
+}
+
+// Legacy SR nutrient numbers (nutrient_nbr), used by older JSON exports
+var usdaNutrientsByNumber = map[string]int{
+	"208": 1008, "957": 2047, "958": 2048, "268": 1062,
+	"203": 1003, "204": 1004, "205": 1005, "291": 1079, "269": 2000, "307": 1093,
+	"301": 1087, "303": 1089, "304": 1090, "305": 1091, "306": 1092, "309": 1095,
+	"401": 1162, "320": 1106, "328": 1114, "418": 1178, "601": 1253, "606": 1258,
+}
+
+// usdaUnits gives the unit of each nutrient in CSV exports, which only carry
+// nutrient IDs in food_nutrient.csv
+var usdaUnits = map[int]string{
+	1008: "kcal", 2047: "kcal", 2048: "kcal", 1062: "kj",
+	1093: "mg", 1087: "mg", 1089: "mg", 1090: "mg", 1091: "mg", 1092: "mg", 1095: "mg", 1162: "mg", 1253: "mg",
+	1106: "ug", 1114: "ug", 1178: "ug",
+}
+
+func usdaUnit(id int) string {
+	if unit, ok := usdaUnits[id]; ok {
+		return unit
+	}
+	return "g"
+}
+
+// USDAJSONReader streams the foods array of a FoodData Central JSON download
+// (FoundationFoods, SRLegacyFoods, SurveyFoods or BrandedFoods)
+type USDAJSONReader struct {
+	decoder *json.Decoder
+	started bool
+	index   int
+}
+
+func NewUSDAJSONReader(r io.Reader) *USDAJSONReader {
+	return &USDAJSONReader{decoder: json.NewDecoder(r)}
+}
+
+type usdaJSONFood struct {
+	FdcID        int    `json:"fdcId"`
+	Description  string `json:"description"`
+	FoodCategory *struct {
+		Description string `json:"description"`
+	} `json:"foodCategory"`
+	BrandedFoodCategory string `json:"brandedFoodCategory"`
+	FoodNutrients       []struct {
+		Nutrient struct {
+			ID       int    `json:"id"`
+			Number   string `json:"number"`
+			UnitName string `json:"unitName"`
+		} `json:"nutrient"`
+		Amount *float64 `json:"amount"`
+	} `json:"foodNutrients"`
+}
+
+// start moves the decoder to the first element of the top-level foods array
+func (r *USDAJSONReader) start() error {
+	token, err := r.decoder.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read USDA JSON: %v", err)
+	}
+	switch token {
+	case json.Delim('['):
+		return nil
+	case json.Delim('{'):
+		if _, err := r.decoder.Token(); err != nil {
+			return fmt.Errorf("failed to read USDA JSON: %v", err)
+		}
+		token, err = r.decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read USDA JSON: %v", err)
+		}
+		if token != json.Delim('[') {
+			return fmt.Errorf("expected an array of foods in USDA JSON")
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected USDA JSON layout")
+}
+
+func (r *USDAJSONReader) Next() (*Food, error) {
+	if !r.started {
+		if err := r.start(); err != nil {
+			return nil, err
+		}
+		r.started = true
+	}
+	if !r.decoder.More() {
+		return nil, io.EOF
+	}
+
+	var item usdaJSONFood
+	if err := r.decoder.Decode(&item); err != nil {
+		return nil, fmt.Errorf("failed to decode USDA food: %v", err)
+	}
+	r.index++
+
+	category := item.BrandedFoodCategory
+	if item.FoodCategory != nil {
+		category = item.FoodCategory.Description
+	}
+	food := &Food{
+		Source:   "usda",
+		SourceID: strconv.Itoa(item.FdcID),
+		Name:     normalizeName(item.Description),
+		Category: mapCategory(category),
+	}
+	unmapped := &UnmappedError{Line: r.index, SourceID: food.SourceID, Name: food.Name}
+
+	values := newNutrientValues()
+	for _, entry := range item.FoodNutrients {
+		if entry.Amount == nil {
+			continue
+		}
+		id := entry.Nutrient.ID
+		if _, ok := usdaNutrientsByID[id]; !ok {
+			id = usdaNutrientsByNumber[entry.Nutrient.Number]
+		}
+		nutrient, ok := usdaNutrientsByID[id]
+		if !ok {
+			continue
+		}
+		if err := values.set(nutrient.Field, nutrient.Priority, *entry.Amount, entry.Nutrient.UnitName); err != nil {
+			unmapped.Reason = err.Error()
+			return nil, unmapped
+		}
+	}
+
+	return finishFood(food, values, 100, unmapped)
+}
+
+// USDACSVReader joins food.csv with food_nutrient.csv from a FoodData Central
+// CSV download. Both files are ordered by fdc_id in the official exports, so
+// they are merged in a single pass instead of indexing either one in memory.
+type USDACSVReader struct {
+	foods     *csv.Reader
+	nutrients *csv.Reader
+	foodCols  map[string]int
+	nutCols   map[string]int
+	line      int
+	pending   []string // nutrient row read ahead of the current food
+	lastFood  int
+	lastNut   int
+}
+
+func NewUSDACSVReader(foods, foodNutrients io.Reader) (*USDACSVReader, error) {
+	r := &USDACSVReader{foods: csv.NewReader(foods), nutrients: csv.NewReader(foodNutrients)}
+	r.nutrients.FieldsPerRecord = -1
+	r.foods.FieldsPerRecord = -1
+
+	var err error
+	if r.foodCols, err = readHeader(r.foods, "fdc_id", "description"); err != nil {
+		return nil, fmt.Errorf("food.csv: %v", err)
+	}
+	if r.nutCols, err = readHeader(r.nutrients, "fdc_id", "nutrient_id", "amount"); err != nil {
+		return nil, fmt.Errorf("food_nutrient.csv: %v", err)
+	}
+	return r, nil
+}
+
+func (r *USDACSVReader) Next() (*Food, error) {
+	row, err := r.foods.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read food.csv: %v", err)
+	}
+	r.line++
+
+	fdcID, err := strconv.Atoi(cell(row, r.foodCols, "fdc_id"))
+	if err != nil {
+		return nil, &UnmappedError{Line: r.line + 1, Reason: "invalid fdc_id"}
+	}
+	if fdcID <= r.lastFood {
+		return nil, fmt.Errorf("food.csv is not ordered by fdc_id at line %d", r.line+1)
+	}
+	r.lastFood = fdcID
+
+	food := &Food{
+		Source:   "usda",
+		SourceID: strconv.Itoa(fdcID),
+		Name:     normalizeName(cell(row, r.foodCols, "description")),
+		Category: mapCategory(cell(row, r.foodCols, "food_category_id")),
+	}
+	unmapped := &UnmappedError{Line: r.line + 1, SourceID: food.SourceID, Name: food.Name}
+
+	values := newNutrientValues()
+	var setErr error
+	for {
+		nutrientRow, err := r.nextNutrient()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rowFood, err := strconv.Atoi(cell(nutrientRow, r.nutCols, "fdc_id"))
+		if err != nil {
+			continue
+		}
+		if rowFood < r.lastNut {
+			return nil, fmt.Errorf("food_nutrient.csv is not ordered by fdc_id near fdc_id %d", rowFood)
+		}
+		r.lastNut = rowFood
+		if rowFood < fdcID {
+			// Nutrients for a food missing from food.csv
+			continue
+		}
+		if rowFood > fdcID {
+			r.pending = nutrientRow
+			break
+		}
+
+		id, _ := strconv.Atoi(cell(nutrientRow, r.nutCols, "nutrient_id"))
+		nutrient, ok := usdaNutrientsByID[id]
+		if !ok || setErr != nil {
+			continue
+		}
+		amount, present, err := parseAmount(cell(nutrientRow, r.nutCols, "amount"))
+		if err != nil {
+			setErr = fmt.Errorf("invalid amount for nutrient %d", id)
+			continue
+		}
+		if present {
+			setErr = values.set(nutrient.Field, nutrient.Priority, amount, usdaUnit(id))
+		}
+	}
+	if setErr != nil {
+		unmapped.Reason = setErr.Error()
+		return nil, unmapped
+	}
+
+	return finishFood(food, values, 100, unmapped)
+}
+
+func (r *USDACSVReader) nextNutrient() ([]string, error) {
+	if r.pending != nil {
+		row := r.pending
+		r.pending = nil
+		return row, nil
+	}
+	row, err := r.nutrients.Read()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read food_nutrient.csv: %v", err)
+	}
+	return row, err
+}
+
+// readHeader reads a CSV header row and checks the required columns exist
+func readHeader(r *csv.Reader, required ...string) (map[string]int, error) {
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+func cell(row []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// finishFood validates the collected values and fills in the food, or
+// returns the row as unmapped
+func finishFood(food *Food, values *nutrientValues, basisGrams float64, unmapped *UnmappedError) (*Food, error) {
+	if food.Name == "" {
+		unmapped.Reason = "missing name"
+		return nil, unmapped
+	}
+	calories, nutrition, err := values.food(basisGrams)
+	if err != nil {
+		unmapped.Reason = err.Error()
+		return nil, unmapped
+	}
+	food.Calories = calories
+	food.Nutrition = nutrition
+	return food, nil
+}
@@ -0,0 +1,28 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// EncodeCursor serializes a pagination position into an opaque URL-safe token
+func EncodeCursor(position interface{}) (string, error) {
+	body, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(body), nil
+}
+
+// DecodeCursor reads a token produced by EncodeCursor back into position
+func DecodeCursor(cursor string, position interface{}) error {
+	body, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(body, position); err != nil {
+		return errors.New("invalid cursor")
+	}
+	return nil
+}
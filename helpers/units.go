@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"fmt"
+
+	"figorate/models"
+)
+
+// Unit dimensions
+const (
+	DimensionMass   = "mass"
+	DimensionVolume = "volume"
+	DimensionCount  = "count"
+)
+
+// Conversion factors to the base unit of each dimension (g, ml, piece).
+// Kitchen measures use US customary sizes.
+var massUnits = map[string]float64{"mg": 0.001, "g": 1, "kg": 1000}
+var volumeUnits = map[string]float64{"ml": 1, "l": 1000, "tsp": 4.92892, "tbsp": 14.7868, "cup": 240}
+var countUnits = map[string]float64{"piece": 1}
+
+// UnitDimension reports whether a unit measures mass, volume or count
+func UnitDimension(unit string) (string, error) {
+	if _, ok := massUnits[unit]; ok {
+		return DimensionMass, nil
+	}
+	if _, ok := volumeUnits[unit]; ok {
+		return DimensionVolume, nil
+	}
+	if _, ok := countUnits[unit]; ok {
+		return DimensionCount, nil
+	}
+	return "", fmt.Errorf("unknown unit: %s", unit)
+}
+
+// ToBaseUnit converts a quantity to grams, millilitres or pieces depending on its dimension
+func ToBaseUnit(quantity float64, unit string) (float64, string, error) {
+	if factor, ok := massUnits[unit]; ok {
+		return quantity * factor, "g", nil
+	}
+	if factor, ok := volumeUnits[unit]; ok {
+		return quantity * factor, "ml", nil
+	}
+	if factor, ok := countUnits[unit]; ok {
+		return quantity * factor, "piece", nil
+	}
+	return 0, "", fmt.Errorf("unknown unit: %s", unit)
+}
+
+// ConvertUnit converts between two units of the same dimension
+func ConvertUnit(quantity float64, from, to string) (float64, error) {
+	base, baseUnit, err := ToBaseUnit(quantity, from)
+	if err != nil {
+		return 0, err
+	}
+	one, targetBase, err := ToBaseUnit(1, to)
+	if err != nil {
+		return 0, err
+	}
+	if baseUnit != targetBase {
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	return base / one, nil
+}
+
+// ToGrams converts a quantity of an ingredient to grams, using its density for
+// volumes and its piece weight for counted units
+func ToGrams(quantity float64, unit string, ingredient models.Ingredient) (float64, error) {
+	base, baseUnit, err := ToBaseUnit(quantity, unit)
+	if err != nil {
+		return 0, err
+	}
+
+	switch baseUnit {
+	case "g":
+		return base, nil
+	case "ml":
+		if ingredient.DensityGPerML <= 0 {
+			return 0, fmt.Errorf("%s has no density, so %s cannot be converted to grams", ingredient.Name, unit)
+		}
+		return base * ingredient.DensityGPerML, nil
+	default:
+		if ingredient.GramsPerPiece <= 0 {
+			return 0, fmt.Errorf("%s has no piece weight, so %s cannot be converted to grams", ingredient.Name, unit)
+		}
+		return base * ingredient.GramsPerPiece, nil
+	}
+}
+
+// Body measurement conversions for users who prefer imperial units
+const (
+	CentimetresPerInch = 2.54
+	KilogramsPerPound  = 0.45359237
+)
+
+// BodyMetricsToMetric converts a height and weight in a unit system to centimetres and kilograms
+func BodyMetricsToMetric(unitSystem string, height, weight float64) (float64, float64) {
+	if unitSystem == "imperial" {
+		return height * CentimetresPerInch, weight * KilogramsPerPound
+	}
+	return height, weight
+}
+
+// BodyMetricsFromMetric converts centimetres and kilograms to a unit system
+func BodyMetricsFromMetric(unitSystem string, heightCm, weightKg float64) (float64, float64) {
+	if unitSystem == "imperial" {
+		return heightCm / CentimetresPerInch, weightKg / KilogramsPerPound
+	}
+	return heightCm, weightKg
+}
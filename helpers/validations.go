@@ -3,8 +3,11 @@ package helpers
 import (
 	"figorate/models"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -15,7 +18,7 @@ func GenerateValidationError(err error) string {
 		var errorMessages []string
 		for _, validationErr := range validationErrors {
 			field := strings.ToLower(validationErr.Field())
-			errorMessages = append(errorMessages, field+" is missing")
+			errorMessages = append(errorMessages, describeValidationError(field, validationErr))
 		}
 
 		// Combine messages and append "and x more" if there are multiple errors
@@ -29,6 +32,40 @@ func GenerateValidationError(err error) string {
 	return "Invalid input data"
 }
 
+// describeValidationError turns a single failed rule into a readable message
+func describeValidationError(field string, err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return field + " is missing"
+	case "oneof":
+		return field + " must be one of: " + strings.ReplaceAll(err.Param(), " ", ", ")
+	case "gt":
+		return field + " must be greater than " + err.Param()
+	case "gte", "min":
+		return field + " must be at least " + err.Param()
+	case "lte", "max":
+		return field + " must be at most " + err.Param()
+	case "email":
+		return field + " must be a valid email address"
+	case "url":
+		return field + " must be a valid URL"
+	case "datetime":
+		return field + " must match the format " + err.Param()
+	}
+	return field + " is invalid"
+}
+
+// KnownMedicalConditions are the conditions users can declare during onboarding
+var KnownMedicalConditions = map[string]bool{
+	"hypertension":           true,
+	"diabetes":               true,
+	"high_cholesterol":       true,
+	"asthma":                 true,
+	"none":                   true,
+	"kidney_disease":         true,
+	"cardiovascular_disease": true,
+}
+
 // Additional validation for onboarding input
 func ValidateOnboardingInput(req models.OnboardingRequest) error {
 
@@ -49,21 +86,170 @@ func ValidateOnboardingInput(req models.OnboardingRequest) error {
 	}
 
 
-	validMedicalConditions := map[string]bool{
-		"hypertension": true,
-		"diabetes": true,
-		"high_cholesterol": true,
-		"asthma": true,
-		"none":true,
-		"kidney_disease":true,
-		"cardiovascular_disease":true,
-	}
-
 	for _, condition := range req.MedicalConditions {
-		if !validMedicalConditions[condition] {
+		if !KnownMedicalConditions[condition] {
 			return fmt.Errorf("invalid medical condition: %s", condition)
 		}
 	}
 
+	if err := ValidateAllergens(req.Allergens); err != nil {
+		return err
+	}
+	if err := ValidateDietaryRestrictions(req.DietaryRestrictions); err != nil {
+		return err
+	}
+	if req.BodyMetrics != nil {
+		heightCm, weightKg := BodyMetricsToMetric(req.BodyMetrics.UnitSystem, req.BodyMetrics.Height, req.BodyMetrics.Weight)
+		if err := ValidateBodyMetrics(heightCm, weightKg); err != nil {
+			return err
+		}
+	}
+	if req.Timezone != "" {
+		if _, err := models.LoadTimezone(req.Timezone); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// KnownMealTags are the tags a meal may carry. Nutrition preferences are tags too,
+// so plans can filter the catalogue by them.
+var KnownMealTags = map[string]bool{
+	"vegetarian":   true,
+	"vegan":        true,
+	"pescatarian":  true,
+	"gluten_free":  true,
+	"dairy_free":   true,
+	"low_fat":      true,
+	"low_carb":     true,
+	"low_sodium":   true,
+	"high_protein": true,
+	"high_fiber":   true,
+	"keto":         true,
+	"paleo":        true,
+	"spicy":        true,
+	"quick":        true,
+	"halal":        true,
+	"kosher":       true,
+}
+
+// ValidateMealTags rejects tags outside KnownMealTags
+func ValidateMealTags(tags []string) error {
+	for _, tag := range tags {
+		if !KnownMealTags[tag] {
+			return fmt.Errorf("unknown meal tag: %s", tag)
+		}
+	}
+	return nil
+}
+
+// ValidateAllergens rejects allergens outside models.Allergens
+func ValidateAllergens(allergens []string) error {
+	for _, allergen := range allergens {
+		known := false
+		for _, candidate := range models.Allergens {
+			if allergen == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown allergen: %s", allergen)
+		}
+	}
+	return nil
+}
+
+// ValidateDietaryRestrictions rejects restrictions outside models.DietaryRestrictions
+func ValidateDietaryRestrictions(restrictions []string) error {
+	for _, restriction := range restrictions {
+		if _, ok := models.DietaryRestrictions[restriction]; !ok {
+			return fmt.Errorf("unknown dietary restriction: %s", restriction)
+		}
+	}
+	return nil
+}
+
+// ValidateNutrientLimits checks each limit names a nutrient meals carry and sets a consistent bound
+func ValidateNutrientLimits(limits []models.NutrientLimit) error {
+	for _, limit := range limits {
+		switch limit.Nutrient {
+		case "calories", "protein", "carbohydrates", "fat", "fiber", "sugar", "sodium":
+		default:
+			if !strings.HasSuffix(limit.Nutrient, "_mg") && !strings.HasSuffix(limit.Nutrient, "_mcg") && !strings.HasSuffix(limit.Nutrient, "_g") {
+				return fmt.Errorf("unknown nutrient %s: micronutrients must end in _g, _mg or _mcg", limit.Nutrient)
+			}
+		}
+		if limit.MaxPerMeal == 0 && limit.MaxPerDay == 0 && limit.MinPerDay == 0 {
+			return fmt.Errorf("limit for %s sets no bound", limit.Nutrient)
+		}
+		if limit.MaxPerDay > 0 && limit.MaxPerMeal > limit.MaxPerDay {
+			return fmt.Errorf("limit for %s allows more per meal than per day", limit.Nutrient)
+		}
+		if limit.MaxPerDay > 0 && limit.MinPerDay > limit.MaxPerDay {
+			return fmt.Errorf("limit for %s has a daily minimum above its daily maximum", limit.Nutrient)
+		}
+	}
+	return nil
+}
+
+// ValidateBodyMetrics checks a metric height and weight are within human ranges
+func ValidateBodyMetrics(heightCm, weightKg float64) error {
+	if heightCm < 100 || heightCm > 250 {
+		return fmt.Errorf("height must be between 100 and 250 cm (39 to 98 in)")
+	}
+	if weightKg < 30 || weightKg > 300 {
+		return fmt.Errorf("weight must be between 30 and 300 kg (66 to 661 lb)")
+	}
+	return nil
+}
+
+// MaxMealSlots caps how many meals a user's day can hold
+const MaxMealSlots = 8
+
+var slotNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,23}$`)
+
+// reservedSlotNames are keys the daily plan response uses alongside its slots
+var reservedSlotNames = map[string]bool{"date": true, "plan_id": true, "version": true, "totals": true, "warnings": true, "slots": true}
+
+// ValidateMealSlots checks a user's slot configuration: unique lowercase
+// names, known categories, HH:MM times and calorie shares adding up to the
+// whole day
+func ValidateMealSlots(slots []models.MealSlot) error {
+	if len(slots) == 0 || len(slots) > MaxMealSlots {
+		return fmt.Errorf("configure between 1 and %d meal slots", MaxMealSlots)
+	}
+
+	seen := make(map[string]bool, len(slots))
+	total := 0.0
+	for _, slot := range slots {
+		if !slotNamePattern.MatchString(slot.Name) {
+			return fmt.Errorf("slot name %q must start with a letter and use only lowercase letters, digits and underscores", slot.Name)
+		}
+		if reservedSlotNames[slot.Name] {
+			return fmt.Errorf("%s cannot be used as a slot name", slot.Name)
+		}
+		if seen[slot.Name] {
+			return fmt.Errorf("duplicate slot name: %s", slot.Name)
+		}
+		seen[slot.Name] = true
+
+		if !models.IsMealCategory(slot.Category) {
+			return fmt.Errorf("slot %s has unknown category %q: must be one of %s", slot.Name, slot.Category, strings.Join(models.MealCategories, ", "))
+		}
+		if slot.Time != "" {
+			if _, err := time.Parse("15:04", slot.Time); err != nil || len(slot.Time) != 5 {
+				return fmt.Errorf("slot %s time must be HH:MM", slot.Name)
+			}
+		}
+		if slot.CalorieShare <= 0 || slot.CalorieShare > 1 {
+			return fmt.Errorf("slot %s calorie share must be above 0 and at most 1", slot.Name)
+		}
+		total += slot.CalorieShare
+	}
+	if math.Abs(total-1) > 0.01 {
+		return fmt.Errorf("calorie shares must add up to 1, not %.2f", total)
+	}
 	return nil
 }
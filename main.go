@@ -83,6 +83,15 @@ func createHomePageTemplate() *template.Template {
             <div class="route-item">POST /refresh-token - Refresh Authentication Token</div>
             <div class="route-item">GET /verify-email - Verify User Email</div>
             <div class="route-item">GET /profile - Get User Profile (Protected)</div>
+            <div class="route-item">GET /profile/ai-usage - Get Daily AI Usage Quota (Protected)</div>
+            <div class="route-item">GET /profile/dietary - Get Allergens and Dietary Restrictions (Protected)</div>
+            <div class="route-item">PUT /profile/dietary - Update Allergens and Dietary Restrictions (Protected)</div>
+            <div class="route-item">PUT /profile/body-metrics - Update Height, Weight and Activity Level (Protected)</div>
+            <div class="route-item">GET /profile/targets - Get Daily Calorie and Macro Targets (Protected)</div>
+            <div class="route-item">PUT /profile/timezone - Set Timezone for Plan Dates (Protected)</div>
+            <div class="route-item">GET /profile/meal-slots - Get Meal Slots of the Day (Protected)</div>
+            <div class="route-item">PUT /profile/meal-slots - Configure Meal Slots, Times and Calorie Shares (Protected)</div>
+            <div class="route-item">POST /profile/picture - Upload Profile Picture (Protected)</div>
             <div class="route-item">POST /onboarding - Complete User Onboarding (Protected)</div>
         </div>
 
@@ -96,10 +105,91 @@ func createHomePageTemplate() *template.Template {
 
         <div class="route-group">
             <h3>Meal Routes</h3>
-            <div class="route-item">POST /meals/add - Add Meal (Protected)</div>
+            <div class="route-item">GET /meals - Search and Filter Meals (Protected)</div>
+            <div class="route-item">GET /meals/:id - Get Meal (Protected)</div>
+            <div class="route-item">GET /meals/export - Export Meal Catalogue as CSV or JSON (Admin)</div>
+            <div class="route-item">POST /meals/import - Import Meals from CSV or JSON (Admin)</div>
+            <div class="route-item">POST /meals - Create Meal (Admin)</div>
+            <div class="route-item">POST /meals/add - Create Meal (Admin)</div>
+            <div class="route-item">PUT /meals/:id - Replace Meal (Admin)</div>
+            <div class="route-item">PATCH /meals/:id - Update Meal Fields (Admin)</div>
+            <div class="route-item">DELETE /meals/:id - Delete Meal (Admin)</div>
+            <div class="route-item">GET /meals/:id/audit - Meal Change History (Admin)</div>
+            <div class="route-item">GET /meals/:id/recipe - Get Meal Recipe (Protected)</div>
+            <div class="route-item">PUT /meals/:id/recipe - Set Recipe and Recalculate Nutrition (Admin)</div>
+            <div class="route-item">POST /meals/:id/image - Upload Meal Image (Admin)</div>
             <div class="route-item">POST /meals/generate-plan - Generate Meal Plan (Protected)</div>
-            <div class="route-item">GET /meals/plan/:day - Get Daily Meal Plan (Protected)</div>
+            <div class="route-item">GET /meals/plan - Get Meal Plan Days in a Date Range (Protected)</div>
+            <div class="route-item">GET /meals/plan/:date - Get Meal Plan for a Date (Protected)</div>
+            <div class="route-item">PUT /meals/plan/:date/slots/:slot - Set a Meal in a Plan Slot (Protected)</div>
+            <div class="route-item">PUT /meals/plan/:date/slots/:slot/lock - Lock a Plan Slot (Protected)</div>
+            <div class="route-item">DELETE /meals/plan/:date/slots/:slot/lock - Unlock a Plan Slot (Protected)</div>
+            <div class="route-item">GET /meals/plan/:date/slots/:slot/suggestions - Suggest Alternatives for a Plan Slot (Protected)</div>
+            <div class="route-item">POST /meals/plan/swap - Swap the Meals of Two Plan Slots (Protected)</div>
             <div class="route-item">POST /meals/recalibrate - Recalibrate Meal Plan (Protected)</div>
+            <div class="route-item">GET /meals/plans/:planId/versions - List Meal Plan Versions (Protected)</div>
+            <div class="route-item">GET /meals/plans/:planId/diff - Compare Two Meal Plan Versions by Day (Protected)</div>
+            <div class="route-item">POST /meals/plans/:planId/rollback - Roll Back Meal Plan to a Version (Protected)</div>
+        </div>
+
+        <div class="route-group">
+            <h3>Ingredient Routes</h3>
+            <div class="route-item">GET /ingredients - List Ingredients (Protected)</div>
+            <div class="route-item">GET /ingredients/:id - Get Ingredient (Protected)</div>
+            <div class="route-item">POST /ingredients - Create Ingredient (Admin)</div>
+            <div class="route-item">POST /ingredients/import - Import Food Composition Data (Admin)</div>
+            <div class="route-item">PUT /ingredients/:id - Update Ingredient and Recalculate Meals (Admin)</div>
+            <div class="route-item">DELETE /ingredients/:id - Delete Unused Ingredient (Admin)</div>
+        </div>
+
+        <div class="route-group">
+            <h3>Chat Routes</h3>
+            <div class="route-item">POST /chat/messages - Ask the Nutrition Assistant (Protected)</div>
+            <div class="route-item">GET /chat - List Conversations (Protected)</div>
+            <div class="route-item">GET /chat/:id - Get Conversation History (Protected)</div>
+            <div class="route-item">POST /chat/:id/confirm - Confirm Proposed Plan Change (Protected)</div>
+            <div class="route-item">POST /chat/:id/cancel - Cancel Proposed Plan Change (Protected)</div>
+        </div>
+
+        <div class="route-group">
+            <h3>Food Diary Routes</h3>
+            <div class="route-item">GET /diary/:date - Get the Food Diary for a Date with Totals vs Targets (Protected)</div>
+            <div class="route-item">PUT /diary/:date/slots/:slot - Mark a Planned Meal Eaten, Skipped or Replaced (Protected)</div>
+            <div class="route-item">DELETE /diary/:date/slots/:slot - Clear What Was Logged for a Planned Meal (Protected)</div>
+            <div class="route-item">POST /diary/:date/foods - Log Off-Plan Food (Protected)</div>
+            <div class="route-item">DELETE /diary/entries/:entryId - Delete a Food Diary Entry (Protected)</div>
+            <div class="route-item">GET /diary/adherence - Weekly or Monthly Plan Adherence (Protected)</div>
+        </div>
+
+        <div class="route-group">
+            <h3>Shopping List Routes</h3>
+            <div class="route-item">POST /shopping-lists - Generate a Shopping List for Plan Dates (Protected)</div>
+            <div class="route-item">GET /shopping-lists - List Shopping Lists (Protected)</div>
+            <div class="route-item">GET /shopping-lists/:id - Get Shopping List by Aisle (Protected)</div>
+            <div class="route-item">GET /shopping-lists/:id/export - Export Shopping List as Text or CSV (Protected)</div>
+            <div class="route-item">PUT /shopping-lists/:id/items/:key - Check an Item Off (Protected)</div>
+            <div class="route-item">DELETE /shopping-lists/:id - Delete Shopping List (Protected)</div>
+        </div>
+
+        <div class="route-group">
+            <h3>Pantry Routes</h3>
+            <div class="route-item">GET /pantry - List Pantry Items with Expiry Flags (Protected)</div>
+            <div class="route-item">GET /pantry/expiring - Items Expiring Soon and Meals That Use Them (Protected)</div>
+            <div class="route-item">POST /pantry - Add Pantry Item (Protected)</div>
+            <div class="route-item">PUT /pantry/:id - Update Pantry Item (Protected)</div>
+            <div class="route-item">DELETE /pantry/:id - Delete Pantry Item (Protected)</div>
+        </div>
+
+        <div class="route-group">
+            <h3>Admin Routes</h3>
+            <div class="route-item">GET /admin/ai-usage - AI Usage and Cost Report (Admin)</div>
+            <div class="route-item">GET /admin/prompts/:name - Get Prompt Template Versions (Admin)</div>
+            <div class="route-item">POST /admin/prompts - Create Prompt Template Version (Admin)</div>
+            <div class="route-item">POST /admin/prompts/:name/activate - Activate Prompt Version (Admin)</div>
+            <div class="route-item">DELETE /admin/prompts/:name/override - Revert Prompt to File Version (Admin)</div>
+            <div class="route-item">GET /admin/condition-rules - List Medical Condition Rules (Admin)</div>
+            <div class="route-item">PUT /admin/condition-rules/:condition - Override a Condition Rule (Admin)</div>
+            <div class="route-item">DELETE /admin/condition-rules/:condition - Revert Condition Rule to Default (Admin)</div>
         </div>
     </div>
 </body>
@@ -161,6 +251,13 @@ func main() {
 	routes.SetupAuthRoutes(router)
 	routes.SetupQouteRoutes(router)
 	routes.SetupMealRoutes(router)
+	routes.SetupIngredientRoutes(router)
+	routes.SetupChatRoutes(router)
+	routes.SetupDiaryRoutes(router)
+	routes.SetupShoppingRoutes(router)
+	routes.SetupPantryRoutes(router)
+	routes.SetupAdminRoutes(router)
+	routes.SetupUploadRoutes(router)
 
 	// Start server
 	port := os.Getenv("PORT")
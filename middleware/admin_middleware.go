@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"figorate/database"
+	"figorate/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AdminMiddleware must run after JWTAuthMiddleware. It loads the
+// authenticated user and rejects the request unless their role is admin.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDHex, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(userIDHex.(string))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		err = database.GetDatabase().Collection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		if user.Role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
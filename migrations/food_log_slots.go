@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"figorate/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// foodLogSlots removes duplicate entries for a planned slot, which concurrent
+// logging could write before the slot index was unique, keeping the latest
+// update of each. The unique index is then created.
+var foodLogSlots = Migration{
+	ID:          "2026-10-19-food-log-slots",
+	Description: "Keep one food log entry per planned slot and index slots uniquely",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		foodLog := db.Collection("food_log")
+		cursor, err := foodLog.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"status": bson.M{"$in": services.PlannedFoodStatuses}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}}},
+			{{Key: "$group", Value: bson.M{
+				"_id": bson.M{"user_id": "$user_id", "date": "$date", "slot": "$slot"},
+				"ids": bson.M{"$push": "$_id"},
+			}}},
+			{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find duplicate food log entries: %v", err)
+		}
+		var groups []struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			return fmt.Errorf("failed to find duplicate food log entries: %v", err)
+		}
+
+		for _, group := range groups {
+			if _, err := foodLog.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}); err != nil {
+				return fmt.Errorf("failed to remove duplicate food log entries: %v", err)
+			}
+		}
+
+		return services.NewFoodLogStore(foodLog).EnsureIndexes(ctx)
+	},
+}
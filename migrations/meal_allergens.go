@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"figorate/models"
+	"figorate/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mealAllergens splits the allergens of meals saved before declared and
+// ingredient allergens were stored apart. Allergens a meal's recipe
+// ingredients contain are taken as coming from them and the rest as declared,
+// so an allergen both declared and in an ingredient is later dropped with the
+// ingredient; declare it again on the meal to keep it.
+var mealAllergens = Migration{
+	ID:          "2026-10-19-meal-allergens",
+	Description: "Store meals' declared allergens apart from their ingredients'",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		recipes := services.NewRecipeService(db.Collection("recipes"), db.Collection("ingredients"), db.Collection("meals"))
+		meals := db.Collection("meals")
+		cursor, err := meals.Find(ctx, bson.M{"declared_allergens": bson.M{"$exists": false}})
+		if err != nil {
+			return fmt.Errorf("failed to load meals: %v", err)
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var meal models.Meal
+			if err := cursor.Decode(&meal); err != nil {
+				return fmt.Errorf("failed to decode meal: %v", err)
+			}
+
+			var fromIngredients []string
+			found, err := recipes.RecipesForMeals(ctx, []primitive.ObjectID{meal.ID})
+			if err != nil {
+				return err
+			}
+			if recipe, exists := found[meal.ID]; exists {
+				ingredients, err := recipes.LoadIngredients(ctx, recipe)
+				if err != nil {
+					return err
+				}
+				for _, ingredient := range ingredients {
+					fromIngredients = append(fromIngredients, ingredient.Allergens...)
+				}
+			}
+			contained := map[string]bool{}
+			for _, allergen := range fromIngredients {
+				contained[allergen] = true
+			}
+			var declared []string
+			for _, allergen := range meal.Allergens {
+				if !contained[allergen] {
+					declared = append(declared, allergen)
+				}
+			}
+
+			meal.SetAllergens(declared, fromIngredients)
+			_, err = meals.UpdateOne(ctx, bson.M{"_id": meal.ID}, bson.M{"$set": bson.M{
+				"allergens":            meal.Allergens,
+				"declared_allergens":   meal.DeclaredAllergens,
+				"ingredient_allergens": meal.IngredientAllergens,
+			}})
+			if err != nil {
+				return fmt.Errorf("failed to update meal %s: %v", meal.ID.Hex(), err)
+			}
+		}
+		return cursor.Err()
+	},
+}
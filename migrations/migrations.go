@@ -0,0 +1,83 @@
+// Package migrations upgrades documents written by earlier versions of the
+// API. Each migration runs once per database; applied migrations are recorded
+// in the schema_migrations collection. Run them with cmd/migrate before
+// starting a new version.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration is one upgrade step. Up must be safe to run again after a
+// partial failure.
+type Migration struct {
+	ID          string
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// All lists every migration in the order they are applied
+var All = []Migration{
+	planMealIDs,
+	planDates,
+	planVersions,
+	mealAllergens,
+	foodLogSlots,
+}
+
+// Record is the schema_migrations entry for an applied migration
+type Record struct {
+	ID        string    `bson:"_id"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Applied returns when each applied migration ran, keyed by ID
+func Applied(ctx context.Context, db *mongo.Database) (map[string]time.Time, error) {
+	cursor, err := db.Collection("schema_migrations").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %v", err)
+	}
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %v", err)
+	}
+
+	applied := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		applied[record.ID] = record.AppliedAt
+	}
+	return applied, nil
+}
+
+// Run applies every pending migration in order, stopping at the first
+// failure. onApply, when set, is called before each one runs.
+func Run(ctx context.Context, db *mongo.Database, onApply func(Migration)) ([]string, error) {
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []string
+	for _, migration := range All {
+		if _, done := applied[migration.ID]; done {
+			continue
+		}
+		if onApply != nil {
+			onApply(migration)
+		}
+		if err := migration.Up(ctx, db); err != nil {
+			return ran, fmt.Errorf("migration %s failed: %v", migration.ID, err)
+		}
+		record := Record{ID: migration.ID, AppliedAt: time.Now()}
+		if _, err := db.Collection("schema_migrations").InsertOne(ctx, record); err != nil {
+			return ran, fmt.Errorf("failed to record migration %s: %v", migration.ID, err)
+		}
+		ran = append(ran, migration.ID)
+	}
+	return ran, nil
+}
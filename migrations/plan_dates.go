@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// planDates turns monthly plans, keyed by month, year and day of month, into
+// plans covering that month with days keyed by date. Chat actions still
+// waiting for confirmation get the date of their day, taken from the month
+// they were proposed in.
+var planDates = Migration{
+	ID:          "2026-10-19-plan-dates",
+	Description: "Key meal plan days by date instead of month and day of month",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		plans := db.Collection("meal_plans")
+		cursor, err := plans.Find(ctx, bson.M{"month": bson.M{"$exists": true}})
+		if err != nil {
+			return fmt.Errorf("failed to load meal plans: %v", err)
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var plan struct {
+				ID    primitive.ObjectID           `bson:"_id"`
+				Month int                          `bson:"month"`
+				Year  int                          `bson:"year"`
+				Days  map[string]models.DailyMeals `bson:"days"`
+			}
+			if err := cursor.Decode(&plan); err != nil {
+				return fmt.Errorf("failed to decode meal plan: %v", err)
+			}
+
+			start, end := models.MonthRange(time.Date(plan.Year, time.Month(plan.Month), 1, 0, 0, 0, 0, time.UTC))
+			days := make(map[string]models.DailyMeals, len(plan.Days))
+			for key, dailyMeals := range plan.Days {
+				day, err := strconv.Atoi(key)
+				if err != nil || day < 1 || day > end.Day() {
+					return fmt.Errorf("meal plan %s has an invalid day %q", plan.ID.Hex(), key)
+				}
+				days[models.FormatDate(start.AddDate(0, 0, day-1))] = dailyMeals
+			}
+
+			_, err := plans.UpdateOne(ctx, bson.M{"_id": plan.ID}, bson.M{
+				"$set": bson.M{
+					"start_date": models.FormatDate(start),
+					"end_date":   models.FormatDate(end),
+					"days":       days,
+				},
+				"$unset": bson.M{"month": "", "year": ""},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update meal plan %s: %v", plan.ID.Hex(), err)
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return fmt.Errorf("failed to read meal plans: %v", err)
+		}
+
+		return migratePendingActionDates(ctx, db.Collection("chat_conversations"))
+	},
+}
+
+func migratePendingActionDates(ctx context.Context, conversations *mongo.Collection) error {
+	cursor, err := conversations.Find(ctx, bson.M{"pending_action.day": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("failed to load chat conversations: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var conversation struct {
+			ID            primitive.ObjectID `bson:"_id"`
+			PendingAction struct {
+				Day       int       `bson:"day"`
+				CreatedAt time.Time `bson:"created_at"`
+			} `bson:"pending_action"`
+		}
+		if err := cursor.Decode(&conversation); err != nil {
+			return fmt.Errorf("failed to decode chat conversation: %v", err)
+		}
+
+		proposed := conversation.PendingAction.CreatedAt
+		date := time.Date(proposed.Year(), proposed.Month(), conversation.PendingAction.Day, 0, 0, 0, 0, time.UTC)
+		_, err := conversations.UpdateOne(ctx, bson.M{"_id": conversation.ID}, bson.M{
+			"$set":   bson.M{"pending_action.date": models.FormatDate(date)},
+			"$unset": bson.M{"pending_action.day": ""},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update chat conversation %s: %v", conversation.ID.Hex(), err)
+		}
+	}
+	return cursor.Err()
+}
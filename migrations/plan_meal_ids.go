@@ -0,0 +1,135 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"figorate/models"
+	"figorate/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// planMealIDs rewrites plan slots that hold a meal name into a meal ID plus
+// snapshot. Names resolve within the category of their slot, as the plan's
+// owner has it, to the active meal of that name, else the most recently
+// deleted one; names matching no meal keep just the name. Cached plans are
+// dropped, as they would otherwise be served without IDs.
+var planMealIDs = Migration{
+	ID:          "2026-10-19-plan-meal-ids",
+	Description: "Reference meals by ID in meal plan slots",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		mealsByName, err := mealsByName(ctx, db.Collection("meals"))
+		if err != nil {
+			return err
+		}
+
+		users := db.Collection("users")
+		slotsByUser := make(map[primitive.ObjectID][]models.MealSlot)
+
+		plans := db.Collection("meal_plans")
+		cursor, err := plans.Find(ctx, bson.M{})
+		if err != nil {
+			return fmt.Errorf("failed to load meal plans: %v", err)
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var plan struct {
+				ID     primitive.ObjectID       `bson:"_id"`
+				UserID primitive.ObjectID       `bson:"user_id"`
+				Days   map[string]bson.RawValue `bson:"days"`
+			}
+			if err := cursor.Decode(&plan); err != nil {
+				return fmt.Errorf("failed to decode meal plan: %v", err)
+			}
+
+			slots, loaded := slotsByUser[plan.UserID]
+			if !loaded {
+				var user models.User
+				err := users.FindOne(ctx, bson.M{"_id": plan.UserID}).Decode(&user)
+				if err != nil && err != mongo.ErrNoDocuments {
+					return fmt.Errorf("failed to load user %s: %v", plan.UserID.Hex(), err)
+				}
+				slots = user.Slots()
+				slotsByUser[plan.UserID] = slots
+			}
+
+			days, changed, err := convertPlanDays(plan.Days, mealsByName, slots)
+			if err != nil {
+				return fmt.Errorf("failed to convert meal plan %s: %v", plan.ID.Hex(), err)
+			}
+			if !changed {
+				continue
+			}
+			if _, err := plans.UpdateOne(ctx, bson.M{"_id": plan.ID}, bson.M{"$set": bson.M{"days": days}}); err != nil {
+				return fmt.Errorf("failed to update meal plan %s: %v", plan.ID.Hex(), err)
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return fmt.Errorf("failed to read meal plans: %v", err)
+		}
+
+		return services.NewMealPlanCache(db.Collection("meal_plan_cache")).Invalidate(ctx)
+	},
+}
+
+// mealsByName indexes every meal, deleted ones included, by category and
+// then name. Meals are read active first, then by deletion time, so an active
+// meal or else the latest deletion wins.
+func mealsByName(ctx context.Context, collection *mongo.Collection) (map[string]map[string]models.Meal, error) {
+	cursor, err := collection.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "deleted_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meals: %v", err)
+	}
+	var meals []models.Meal
+	if err := cursor.All(ctx, &meals); err != nil {
+		return nil, fmt.Errorf("failed to load meals: %v", err)
+	}
+
+	byName := make(map[string]map[string]models.Meal)
+	for _, meal := range meals {
+		if byName[meal.Category] == nil {
+			byName[meal.Category] = make(map[string]models.Meal)
+		}
+		if existing, exists := byName[meal.Category][meal.Name]; exists && existing.DeletedAt == nil {
+			continue
+		}
+		byName[meal.Category][meal.Name] = meal
+	}
+	return byName, nil
+}
+
+// convertPlanDays resolves the name-only slots of a plan's days, reporting
+// whether any slot needed converting
+func convertPlanDays(days map[string]bson.RawValue, mealsByName map[string]map[string]models.Meal, slots []models.MealSlot) (map[string]models.DailyMeals, bool, error) {
+	converted := make(map[string]models.DailyMeals, len(days))
+	changed := false
+	for day, raw := range days {
+		var legacy map[string]bson.RawValue
+		if err := raw.Unmarshal(&legacy); err != nil {
+			return nil, false, err
+		}
+
+		var dailyMeals models.DailyMeals
+		if err := raw.Unmarshal(&dailyMeals); err != nil {
+			return nil, false, err
+		}
+		for slot, value := range legacy {
+			if value.Type != bson.TypeString {
+				continue
+			}
+			changed = true
+			planned, _ := dailyMeals.Get(slot)
+			if meal, exists := mealsByName[models.SlotCategory(slots, slot)][planned.Name]; exists && !planned.IsEmpty() {
+				dailyMeals.Set(slot, models.NewPlannedMeal(meal))
+			}
+		}
+		converted[day] = dailyMeals
+	}
+	return converted, changed, nil
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// planVersions records every plan written before version history as its
+// version 1, so later changes can be compared against and rolled back to it
+var planVersions = Migration{
+	ID:          "2026-10-19-plan-versions",
+	Description: "Record existing meal plans as their first version",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		plans := db.Collection("meal_plans")
+		versions := db.Collection("meal_plan_versions")
+		cursor, err := plans.Find(ctx, bson.M{"$or": bson.A{
+			bson.M{"version": bson.M{"$exists": false}},
+			bson.M{"version": 0},
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to load meal plans: %v", err)
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var plan models.MealPlan
+			if err := cursor.Decode(&plan); err != nil {
+				return fmt.Errorf("failed to decode meal plan: %v", err)
+			}
+
+			plan.Version = 1
+			source := models.PlanSourceAI
+			if plan.Model == "" || plan.Model == "deterministic" {
+				source = models.PlanSourceDeterministic
+			}
+			version := models.NewMealPlanVersion(plan, "Plan as it was before version history", source, plan.UpdatedAt)
+
+			// Upserting keeps a rerun from recording the version twice
+			_, err := versions.UpdateOne(ctx, bson.M{"plan_id": plan.ID, "version": 1},
+				bson.M{"$setOnInsert": version}, options.Update().SetUpsert(true))
+			if err != nil {
+				return fmt.Errorf("failed to record version of meal plan %s: %v", plan.ID.Hex(), err)
+			}
+			if _, err := plans.UpdateOne(ctx, bson.M{"_id": plan.ID}, bson.M{"$set": bson.M{"version": 1}}); err != nil {
+				return fmt.Errorf("failed to update meal plan %s: %v", plan.ID.Hex(), err)
+			}
+		}
+		return cursor.Err()
+	},
+}
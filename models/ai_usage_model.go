@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TokenUsage mirrors the usage block returned by chat completion providers
+type TokenUsage struct {
+	PromptTokens     int `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int `bson:"completion_tokens" json:"completion_tokens"`
+	TotalTokens      int `bson:"total_tokens" json:"total_tokens"`
+}
+
+// AIUsage aggregates a user's AI calls for one day, model and feature
+type AIUsage struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID           primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Date             string             `bson:"date" json:"date"` // YYYY-MM-DD in UTC
+	Model            string             `bson:"model" json:"model"`
+	Feature          string             `bson:"feature" json:"feature"` // meal_plan, chat, etc.
+	Requests         int                `bson:"requests" json:"requests"`
+	PromptTokens     int                `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int                `bson:"completion_tokens" json:"completion_tokens"`
+	TotalTokens      int                `bson:"total_tokens" json:"total_tokens"`
+	EstimatedCost    float64            `bson:"estimated_cost" json:"estimated_cost"` // in USD
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// AIQuotaStatus describes how much of their daily AI allowance a user has used.
+// A limit of 0 means unlimited.
+type AIQuotaStatus struct {
+	Tier          string    `json:"tier"`
+	Date          string    `json:"date"`
+	RequestsUsed  int       `json:"requests_used"`
+	RequestsLimit int       `json:"requests_limit"`
+	TokensUsed    int       `json:"tokens_used"`
+	TokensLimit   int       `json:"tokens_limit"`
+	ResetsAt      time.Time `json:"resets_at"`
+}
+
+func (s AIQuotaStatus) Exceeded() bool {
+	if s.RequestsLimit > 0 && s.RequestsUsed >= s.RequestsLimit {
+		return true
+	}
+	return s.TokensLimit > 0 && s.TokensUsed >= s.TokensLimit
+}
+
+// AIUsageReportRow is one line of the admin usage report
+type AIUsageReportRow struct {
+	Model            string  `bson:"_id" json:"model"`
+	Users            int     `bson:"users" json:"users"`
+	Requests         int     `bson:"requests" json:"requests"`
+	PromptTokens     int     `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int     `bson:"completion_tokens" json:"completion_tokens"`
+	TotalTokens      int     `bson:"total_tokens" json:"total_tokens"`
+	EstimatedCost    float64 `bson:"estimated_cost" json:"estimated_cost"`
+}
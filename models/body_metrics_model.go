@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// ActivityFactors multiply BMR into total daily energy expenditure (TDEE)
+var ActivityFactors = map[string]float64{
+	"sedentary":   1.2,
+	"light":       1.375,
+	"moderate":    1.55,
+	"active":      1.725,
+	"very_active": 1.9,
+}
+
+// NutritionTargets are a user's daily calorie and macro goals, derived from
+// their body metrics, activity level and health goals
+type NutritionTargets struct {
+	BMR           int     `bson:"bmr" json:"bmr"`
+	TDEE          int     `bson:"tdee" json:"tdee"`
+	Calories      int     `bson:"calories" json:"calories"`
+	Protein       float64 `bson:"protein" json:"protein"`             // grams
+	Carbohydrates float64 `bson:"carbohydrates" json:"carbohydrates"` // grams
+	Fat           float64 `bson:"fat" json:"fat"`                     // grams
+	// Warnings explain where the goals couldn't be followed as is
+	Warnings   []string  `bson:"warnings,omitempty" json:"warnings,omitempty"`
+	ComputedAt time.Time `bson:"computed_at" json:"computed_at"`
+}
+
+// BodyMetricsRequest takes height and weight in the user's preferred units:
+// centimetres and kilograms for metric, inches and pounds for imperial
+type BodyMetricsRequest struct {
+	UnitSystem    string  `json:"unit_system" binding:"required,oneof=metric imperial"`
+	Height        float64 `json:"height" binding:"required,gt=0"`
+	Weight        float64 `json:"weight" binding:"required,gt=0"`
+	ActivityLevel string  `json:"activity_level" binding:"required,oneof=sedentary light moderate active very_active"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ChatMessage struct {
+	Role      string    `bson:"role" json:"role"` // user or assistant
+	Content   string    `bson:"content" json:"content"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// ChatAction is a change proposed by the assistant that waits for the user to confirm it
+type ChatAction struct {
+	Type       string             `bson:"type" json:"type"` // swap_meal
+	Date       string             `bson:"date" json:"date"` // YYYY-MM-DD
+	Slot       string             `bson:"slot" json:"slot"`
+	FromMeal   string             `bson:"from_meal" json:"from_meal"`
+	FromMealID primitive.ObjectID `bson:"from_meal_id,omitempty" json:"from_meal_id,omitempty"`
+	ToMeal     string             `bson:"to_meal" json:"to_meal"`
+	ToMealID   primitive.ObjectID `bson:"to_meal_id,omitempty" json:"to_meal_id,omitempty"`
+	// Warnings are the condition rules the proposed meal breaches
+	Warnings  []NutritionWarning `bson:"warnings,omitempty" json:"warnings,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type ChatConversation struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Title         string             `bson:"title" json:"title"`
+	Messages      []ChatMessage      `bson:"messages" json:"messages,omitempty"`
+	PendingAction *ChatAction        `bson:"pending_action,omitempty" json:"pending_action,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type SendChatMessageRequest struct {
+	ConversationID string `json:"conversation_id"`
+	Message        string `json:"message" binding:"required,max=2000"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NutrientLimit bounds one nutrient for a single meal and/or a whole day. Nutrient
+// is calories, protein, carbohydrates, fat, fiber, sugar, sodium or a
+// micronutrient key such as potassium_mg. Zero means no bound.
+type NutrientLimit struct {
+	Nutrient   string  `bson:"nutrient" json:"nutrient" binding:"required"`
+	MaxPerMeal float64 `bson:"max_per_meal,omitempty" json:"max_per_meal,omitempty" binding:"gte=0"`
+	MaxPerDay  float64 `bson:"max_per_day,omitempty" json:"max_per_day,omitempty" binding:"gte=0"`
+	MinPerDay  float64 `bson:"min_per_day,omitempty" json:"min_per_day,omitempty" binding:"gte=0"`
+}
+
+// ConditionRule maps a medical condition to nutrient limits and meal preferences.
+// Defaults ship in code; an admin-edited document in condition_rules replaces
+// the default for its condition.
+type ConditionRule struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Condition   string             `bson:"condition" json:"condition"`
+	Description string             `bson:"description" json:"description"`
+	Limits      []NutrientLimit    `bson:"limits" json:"limits"`
+	PreferTags  []string           `bson:"prefer_tags" json:"prefer_tags"`
+	AvoidTags   []string           `bson:"avoid_tags" json:"avoid_tags"`
+	Source      string             `bson:"-" json:"source"` // default or database
+	UpdatedBy   primitive.ObjectID `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type ConditionRuleRequest struct {
+	Description string          `json:"description" binding:"max=500"`
+	Limits      []NutrientLimit `json:"limits" binding:"dive"`
+	PreferTags  []string        `json:"prefer_tags"`
+	AvoidTags   []string        `json:"avoid_tags"`
+}
+
+// NutritionWarning flags a meal or day that breaks one of the user's condition rules
+type NutritionWarning struct {
+	Condition string  `json:"condition"`
+	Nutrient  string  `json:"nutrient,omitempty"`
+	Scope     string  `json:"scope"`          // meal or day
+	Date      string  `json:"date,omitempty"` // YYYY-MM-DD, for day warnings
+	Limit     float64 `json:"limit,omitempty"`
+	Actual    float64 `json:"actual,omitempty"`
+	Message   string  `json:"message"`
+}
+
+// MealWithWarnings is a meal annotated with the condition rules it breaks for the viewing user
+type MealWithWarnings struct {
+	Meal     `bson:",inline"`
+	Warnings []NutritionWarning `json:"warnings"`
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	// Embed the IANA database so user timezones resolve on hosts without one
+	_ "time/tzdata"
+)
+
+// DateLayout is how calendar dates are written in plans and APIs
+const DateLayout = "2006-01-02"
+
+// MaxPlanDays caps how many days a plan, or a range of plan days read at
+// once, may span
+const MaxPlanDays = 62
+
+// ParseDate reads a YYYY-MM-DD date as midnight UTC
+func ParseDate(value string) (time.Time, error) {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dates must be formatted as YYYY-MM-DD")
+	}
+	return date, nil
+}
+
+// LoadTimezone resolves an IANA timezone name such as Europe/Berlin. The
+// server's own "Local" zone is not accepted.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("timezone must be an IANA name such as Europe/Berlin")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone: %s", name)
+	}
+	return loc, nil
+}
+
+// LocalDate returns the calendar date t falls on in loc, as midnight UTC like
+// ParseDate. Date math on the result never crosses a DST transition.
+func LocalDate(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// LocalTime returns the instant a HH:MM clock time falls on date in loc. A
+// time that a DST change skips moves forward by the gap, so 02:30 on a day
+// clocks jump from 02:00 to 03:00 is 03:30, and a time that happens twice
+// means its first occurrence.
+func LocalTime(date time.Time, clock string, loc *time.Location) (time.Time, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("times must be formatted as HH:MM")
+	}
+	wall := time.Date(date.Year(), date.Month(), date.Day(), parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+
+	// time.Date leaves it open which offset applies around a transition, so
+	// try the offsets either side of it, earliest instant first
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+	offsets := []int{before, after}
+	if after > before {
+		offsets = []int{after, before}
+	}
+	for _, offset := range offsets {
+		t := wall.Add(-time.Duration(offset) * time.Second)
+		local := t.In(loc)
+		if local.Hour() == wall.Hour() && local.Minute() == wall.Minute() && local.Day() == wall.Day() {
+			return t, nil
+		}
+	}
+	return wall.Add(-time.Duration(before) * time.Second), nil
+}
+
+// FormatDate writes the calendar date of t as YYYY-MM-DD
+func FormatDate(t time.Time) string {
+	return t.Format(DateLayout)
+}
+
+// ParseDateRange reads an inclusive range of dates, checking that it runs
+// forwards and spans at most MaxPlanDays
+func ParseDateRange(startDate, endDate string) (time.Time, time.Time, error) {
+	start, err := ParseDate(startDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := ParseDate(endDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end date must not be before start date")
+	}
+	if DayCount(start, end) > MaxPlanDays {
+		return time.Time{}, time.Time{}, fmt.Errorf("date ranges may span at most %d days", MaxPlanDays)
+	}
+	return start, end, nil
+}
+
+// DayCount counts the dates from start to end inclusive
+func DayCount(start, end time.Time) int {
+	return int(end.Sub(start).Hours()/24) + 1
+}
+
+// MonthRange returns the first and last date of the month t falls in
+func MonthRange(t time.Time) (time.Time, time.Time) {
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return first, first.AddDate(0, 1, -1)
+}
+
+// WeekRange returns the Monday and Sunday of the week t falls in
+func WeekRange(t time.Time) (time.Time, time.Time) {
+	monday := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	return monday, monday.AddDate(0, 0, 6)
+}
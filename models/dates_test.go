@@ -0,0 +1,190 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// Zones either side of UTC. In 2026 Berlin springs forward on March 29 and
+// falls back on October 25; New York on March 8 and November 1.
+const (
+	berlin   = "Europe/Berlin"
+	newYork  = "America/New_York"
+	tzLayout = time.RFC3339
+)
+
+var localDateTests = []struct {
+	name string
+	zone string
+	now  string
+	want string
+}{
+	{"Berlin before spring forward midnight", berlin, "2026-03-28T22:59:00Z", "2026-03-28"},
+	{"Berlin spring forward day starts", berlin, "2026-03-28T23:00:00Z", "2026-03-29"},
+	{"Berlin spring forward during the gap", berlin, "2026-03-29T01:30:00Z", "2026-03-29"},
+	{"Berlin spring forward day ends", berlin, "2026-03-29T21:59:00Z", "2026-03-29"},
+	{"Berlin after spring forward", berlin, "2026-03-29T22:00:00Z", "2026-03-30"},
+	{"Berlin fall back day starts", berlin, "2026-10-24T22:00:00Z", "2026-10-25"},
+	{"Berlin fall back repeated hour, first", berlin, "2026-10-25T00:30:00Z", "2026-10-25"},
+	{"Berlin fall back repeated hour, second", berlin, "2026-10-25T01:30:00Z", "2026-10-25"},
+	{"Berlin fall back day ends", berlin, "2026-10-25T22:59:00Z", "2026-10-25"},
+	{"Berlin after fall back", berlin, "2026-10-25T23:00:00Z", "2026-10-26"},
+	{"New York before spring forward midnight", newYork, "2026-03-08T04:59:00Z", "2026-03-07"},
+	{"New York spring forward day starts", newYork, "2026-03-08T05:00:00Z", "2026-03-08"},
+	{"New York spring forward during the gap", newYork, "2026-03-08T07:30:00Z", "2026-03-08"},
+	{"New York spring forward day ends", newYork, "2026-03-09T03:59:00Z", "2026-03-08"},
+	{"New York after spring forward", newYork, "2026-03-09T04:00:00Z", "2026-03-09"},
+	{"New York fall back day starts", newYork, "2026-11-01T04:00:00Z", "2026-11-01"},
+	{"New York fall back repeated hour, first", newYork, "2026-11-01T05:30:00Z", "2026-11-01"},
+	{"New York fall back repeated hour, second", newYork, "2026-11-01T06:30:00Z", "2026-11-01"},
+	{"New York fall back day ends", newYork, "2026-11-02T04:59:00Z", "2026-11-01"},
+	{"New York after fall back", newYork, "2026-11-02T05:00:00Z", "2026-11-02"},
+	{"New York new year still the old year", newYork, "2027-01-01T04:00:00Z", "2026-12-31"},
+	{"Berlin leap day", berlin, "2028-02-28T23:00:00Z", "2028-02-29"},
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(tzLayout, value)
+	if err != nil {
+		t.Fatalf("bad test time %q: %v", value, err)
+	}
+	return parsed
+}
+
+func TestLocalDate(t *testing.T) {
+	for _, tt := range localDateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := LoadTimezone(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := LocalDate(mustParseTime(t, tt.now), loc)
+			if FormatDate(got) != tt.want {
+				t.Errorf("LocalDate(%s) = %s, want %s", tt.now, FormatDate(got), tt.want)
+			}
+			if got.Location() != time.UTC || got.Hour() != 0 || got.Minute() != 0 {
+				t.Errorf("LocalDate(%s) = %v, want midnight UTC", tt.now, got)
+			}
+		})
+	}
+}
+
+func TestUserToday(t *testing.T) {
+	for _, tt := range localDateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := User{Timezone: tt.zone}
+			if got := FormatDate(user.Today(mustParseTime(t, tt.now))); got != tt.want {
+				t.Errorf("Today(%s) = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+
+	// Without a usable timezone, today is the UTC date
+	for _, zone := range []string{"", "Local", "Mars/Olympus_Mons"} {
+		user := User{Timezone: zone}
+		if got := FormatDate(user.Today(mustParseTime(t, "2026-03-08T04:59:00Z"))); got != "2026-03-08" {
+			t.Errorf("Today with timezone %q = %s, want the UTC date", zone, got)
+		}
+	}
+}
+
+func TestMonthRange(t *testing.T) {
+	tests := []struct {
+		date        string
+		first, last string
+		days        int
+	}{
+		{"2026-01-31", "2026-01-01", "2026-01-31", 31},
+		{"2026-02-01", "2026-02-01", "2026-02-28", 28},
+		{"2028-02-29", "2028-02-01", "2028-02-29", 29},
+		{"2028-02-15", "2028-02-01", "2028-02-29", 29},
+		{"2100-02-10", "2100-02-01", "2100-02-28", 28},
+		{"2000-02-10", "2000-02-01", "2000-02-29", 29},
+		{"2026-03-29", "2026-03-01", "2026-03-31", 31},
+		{"2026-04-30", "2026-04-01", "2026-04-30", 30},
+		{"2026-12-31", "2026-12-01", "2026-12-31", 31},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			date, err := ParseDate(tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, last := MonthRange(date)
+			if FormatDate(first) != tt.first || FormatDate(last) != tt.last {
+				t.Errorf("MonthRange(%s) = %s to %s, want %s to %s", tt.date, FormatDate(first), FormatDate(last), tt.first, tt.last)
+			}
+			if got := DayCount(first, last); got != tt.days {
+				t.Errorf("DayCount over %s = %d, want %d", tt.date, got, tt.days)
+			}
+		})
+	}
+}
+
+func TestDayCount(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       int
+	}{
+		{"2026-10-19", "2026-10-19", 1},
+		{"2026-01-31", "2026-02-01", 2},
+		{"2026-02-28", "2026-03-01", 2},
+		{"2028-02-28", "2028-03-01", 3},
+		{"2028-02-29", "2028-03-01", 2},
+		{"2026-12-31", "2027-01-01", 2},
+		{"2026-03-01", "2026-03-31", 31}, // spans spring forward
+		{"2026-10-01", "2026-11-30", 61}, // spans fall back
+		{"2028-01-01", "2028-12-31", 366},
+	}
+	for _, tt := range tests {
+		start, _ := ParseDate(tt.start)
+		end, _ := ParseDate(tt.end)
+		if got := DayCount(start, end); got != tt.want {
+			t.Errorf("DayCount(%s, %s) = %d, want %d", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestLocalTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		zone  string
+		date  string
+		clock string
+		want  string
+	}{
+		{"Berlin winter", berlin, "2026-01-15", "08:00", "2026-01-15T07:00:00Z"},
+		{"Berlin summer", berlin, "2026-07-15", "08:00", "2026-07-15T06:00:00Z"},
+		{"Berlin spring forward before the gap", berlin, "2026-03-29", "01:30", "2026-03-29T00:30:00Z"},
+		{"Berlin spring forward in the gap", berlin, "2026-03-29", "02:30", "2026-03-29T01:30:00Z"}, // 03:30 CEST
+		{"Berlin spring forward after the gap", berlin, "2026-03-29", "08:00", "2026-03-29T06:00:00Z"},
+		{"Berlin fall back repeated hour", berlin, "2026-10-25", "02:30", "2026-10-25T00:30:00Z"}, // first, CEST
+		{"Berlin fall back after", berlin, "2026-10-25", "08:00", "2026-10-25T07:00:00Z"},
+		{"New York spring forward in the gap", newYork, "2026-03-08", "02:30", "2026-03-08T07:30:00Z"}, // 03:30 EDT
+		{"New York spring forward after the gap", newYork, "2026-03-08", "19:00", "2026-03-08T23:00:00Z"},
+		{"New York fall back repeated hour", newYork, "2026-11-01", "01:30", "2026-11-01T05:30:00Z"}, // first, EDT
+		{"New York fall back after", newYork, "2026-11-01", "19:00", "2026-11-02T00:00:00Z"},
+		{"New York late evening is the next UTC day", newYork, "2026-12-31", "20:00", "2027-01-01T01:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := LoadTimezone(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			date, _ := ParseDate(tt.date)
+			got, err := LocalTime(date, tt.clock, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := mustParseTime(t, tt.want); !got.Equal(want) {
+				t.Errorf("LocalTime(%s %s) = %s, want %s", tt.date, tt.clock, got.UTC().Format(tzLayout), tt.want)
+			}
+		})
+	}
+
+	if _, err := LocalTime(time.Now(), "8am", time.UTC); err == nil {
+		t.Error("LocalTime accepted 8am, want an HH:MM error")
+	}
+}
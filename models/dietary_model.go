@@ -0,0 +1,33 @@
+package models
+
+// Allergens users can declare and meals and ingredients can contain
+var Allergens = []string{
+	"peanut", "tree_nut", "milk", "egg", "fish", "shellfish", "mollusc",
+	"soy", "wheat", "gluten", "sesame", "mustard", "celery", "lupin", "sulphite",
+}
+
+// DietaryRestriction describes which meals a restricted user may eat
+type DietaryRestriction struct {
+	// SatisfiedBy lists meal tags, any one of which satisfies the restriction
+	SatisfiedBy []string
+	// ExcludesAllergens are never allowed under the restriction, whatever the tags say
+	ExcludesAllergens []string
+}
+
+// DietaryRestrictions are the restrictions users can hold, keyed by name
+var DietaryRestrictions = map[string]DietaryRestriction{
+	"vegetarian":  {SatisfiedBy: []string{"vegetarian", "vegan"}, ExcludesAllergens: []string{"fish", "shellfish", "mollusc"}},
+	"vegan":       {SatisfiedBy: []string{"vegan"}, ExcludesAllergens: []string{"milk", "egg", "fish", "shellfish", "mollusc"}},
+	"pescatarian": {SatisfiedBy: []string{"pescatarian", "vegetarian", "vegan"}},
+	"gluten_free": {SatisfiedBy: []string{"gluten_free"}, ExcludesAllergens: []string{"gluten", "wheat"}},
+	"dairy_free":  {SatisfiedBy: []string{"dairy_free", "vegan"}, ExcludesAllergens: []string{"milk"}},
+	"keto":        {SatisfiedBy: []string{"keto"}},
+	"paleo":       {SatisfiedBy: []string{"paleo"}},
+	"halal":       {SatisfiedBy: []string{"halal"}},
+	"kosher":      {SatisfiedBy: []string{"kosher"}},
+}
+
+type DietaryProfileRequest struct {
+	Allergens           []string `json:"allergens"`
+	DietaryRestrictions []string `json:"dietary_restrictions"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Statuses of a food log entry. Eaten, skipped and replaced answer for a
+// planned slot; off plan entries are food eaten besides the plan.
+const (
+	FoodEaten    = "eaten"
+	FoodSkipped  = "skipped"
+	FoodReplaced = "replaced"
+	FoodOffPlan  = "off_plan"
+)
+
+// FoodLogEntry is one thing the user logged in their food diary. Calories and
+// nutrition are taken when it is logged and scaled by the portion, so the
+// diary keeps its totals after meals change. A planned slot has at most one
+// entry per date.
+type FoodLogEntry struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Date   string             `bson:"date" json:"date"`
+	Slot   string             `bson:"slot,omitempty" json:"slot,omitempty"` // empty for off plan food eaten between meals
+	Status string             `bson:"status" json:"status"`
+	// Planned is what the plan held in the slot when it was logged
+	Planned   *PlannedMeal       `bson:"planned,omitempty" json:"planned,omitempty"`
+	MealID    primitive.ObjectID `bson:"meal_id,omitempty" json:"meal_id,omitempty"` // the catalogue meal eaten, if any
+	Name      string             `bson:"name,omitempty" json:"name,omitempty"`
+	Portion   float64            `bson:"portion" json:"portion"` // servings
+	Calories  int                `bson:"calories" json:"calories"`
+	Nutrition Nutrition          `bson:"nutrition" json:"nutrition"`
+	// Cooked entries took their recipe's ingredients out of the pantry, as
+	// PantryUsed records
+	Cooked     bool        `bson:"cooked,omitempty" json:"cooked,omitempty"`
+	PantryUsed []PantryUse `bson:"pantry_used,omitempty" json:"pantry_used,omitempty"`
+	CreatedAt  time.Time   `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time   `bson:"updated_at" json:"updated_at"`
+}
+
+// FoodRequest names food eaten: a catalogue meal, or a food with its own
+// calories and, optionally, nutrition per serving
+type FoodRequest struct {
+	MealID    string     `json:"meal_id"`
+	Name      string     `json:"name" binding:"max=100"`
+	Portion   float64    `json:"portion" binding:"gte=0,lte=10"` // servings, 1 when left out
+	Calories  int        `json:"calories" binding:"gte=0,lte=5000"`
+	Nutrition *Nutrition `json:"nutrition"`
+	// Cooked takes a catalogue meal's recipe out of the pantry
+	Cooked bool `json:"cooked"`
+}
+
+// LogSlotRequest records what happened to a planned slot. Eaten takes an
+// optional portion, replaced the food eaten instead.
+type LogSlotRequest struct {
+	Status string `json:"status" binding:"required,oneof=eaten skipped replaced"`
+	FoodRequest
+}
+
+// LogFoodRequest logs food eaten off plan, optionally against a slot
+type LogFoodRequest struct {
+	Slot string `json:"slot"`
+	FoodRequest
+}
@@ -0,0 +1,14 @@
+package models
+
+// ImageSet is an uploaded image resized to the standard variants. URLs are
+// content addressed, so they stay valid and cacheable for as long as the
+// image is in use.
+type ImageSet struct {
+	Full      string   `bson:"full" json:"full"`           // longest side at most 2048px
+	Medium    string   `bson:"medium" json:"medium"`       // fits 640x640
+	Small     string   `bson:"small" json:"small"`         // fits 320x320
+	Thumbnail string   `bson:"thumbnail" json:"thumbnail"` // 150x150, centre cropped
+	Width     int      `bson:"width" json:"width"`         // of the full variant
+	Height    int      `bson:"height" json:"height"`
+	Keys      []string `bson:"keys" json:"-"` // storage keys, for deleting a replaced image
+}
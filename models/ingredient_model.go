@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ingredient holds nutrition per 100g. DensityGPerML converts volume units to
+// grams and GramsPerPiece converts counted units; either may be zero when unknown.
+type Ingredient struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name             string             `bson:"name" json:"name"`
+	Category         string             `bson:"category" json:"category"` // store aisle, e.g. produce, dairy
+	CaloriesPer100g  float64            `bson:"calories_per_100g" json:"calories_per_100g"`
+	NutritionPer100g Nutrition          `bson:"nutrition_per_100g" json:"nutrition_per_100g"`
+	DensityGPerML    float64            `bson:"density_g_per_ml" json:"density_g_per_ml"`
+	GramsPerPiece    float64            `bson:"grams_per_piece" json:"grams_per_piece"`
+	Allergens        []string           `bson:"allergens" json:"allergens"`                     // passed on to meals whose recipe uses the ingredient
+	Source           string             `bson:"source,omitempty" json:"source,omitempty"`       // dataset it was imported from, e.g. usda
+	SourceID         string             `bson:"source_id,omitempty" json:"source_id,omitempty"` // row ID in that dataset
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type IngredientRequest struct {
+	Name             string    `json:"name" binding:"required,min=2,max=100"`
+	Category         string    `json:"category" binding:"required,oneof=produce meat seafood dairy bakery grains canned frozen spices condiments beverages snacks other"`
+	CaloriesPer100g  float64   `json:"calories_per_100g" binding:"gte=0,lte=900"`
+	NutritionPer100g Nutrition `json:"nutrition_per_100g"`
+	DensityGPerML    float64   `json:"density_g_per_ml" binding:"gte=0,lte=25"`
+	GramsPerPiece    float64   `json:"grams_per_piece" binding:"gte=0"`
+	Allergens        []string  `json:"allergens"`
+}
+
+// RecipeIngredient is a quantity of an ingredient in any supported unit
+type RecipeIngredient struct {
+	IngredientID primitive.ObjectID `bson:"ingredient_id" json:"ingredient_id" binding:"required"`
+	Quantity     float64            `bson:"quantity" json:"quantity" binding:"required,gt=0"`
+	Unit         string             `bson:"unit" json:"unit" binding:"required,oneof=g kg mg ml l tsp tbsp cup piece"`
+	Note         string             `bson:"note,omitempty" json:"note,omitempty"` // e.g. finely chopped
+}
+
+// Recipe links a meal to the ingredients and steps used to make it
+type Recipe struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	MealID      primitive.ObjectID `bson:"meal_id" json:"meal_id"`
+	Servings    int                `bson:"servings" json:"servings"`
+	Ingredients []RecipeIngredient `bson:"ingredients" json:"ingredients"`
+	Steps       []string           `bson:"steps" json:"steps"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type RecipeRequest struct {
+	Servings    int                `json:"servings" binding:"required,gt=0,lte=50"`
+	Ingredients []RecipeIngredient `json:"ingredients" binding:"required,min=1,dive"`
+	Steps       []string           `json:"steps" binding:"required,min=1,dive,required"`
+}
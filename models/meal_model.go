@@ -1,19 +1,140 @@
 package models
 
 import (
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Meal struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	Image     string             `bson:"image" json:"image"`
-	Calories  int                `bson:"calories" json:"calories"`
-	Preptime  int                `bson:"prep_time" json:"prep_time"` // in minutes
-	Category  string             `bson:"category" json:"category"`   // breakfast, lunch, etc.
-	Tags      []string           `bson:"tags" json:"tags"`           // vegetarian, low-fat, etc.
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Image       string             `bson:"image" json:"image"`
+	Images      *ImageSet          `bson:"images,omitempty" json:"images,omitempty"` // set when the image was uploaded
+	Calories    int                `bson:"calories" json:"calories"`
+	Nutrition   Nutrition          `bson:"nutrition" json:"nutrition"` // per serving
+	Preptime    int                `bson:"prep_time" json:"prep_time"` // in minutes
+	Category    string             `bson:"category" json:"category"`   // breakfast, lunch, etc.
+	Tags        []string           `bson:"tags" json:"tags"`           // vegetarian, low-fat, etc.
+	Allergens   []string           `bson:"allergens" json:"allergens"` // peanut, egg, etc.: declared and from ingredients
+	// DeclaredAllergens are the allergens given for the meal itself and
+	// IngredientAllergens those its recipe's ingredients contain. Allergens
+	// is always both together, see SetAllergens.
+	DeclaredAllergens   []string           `bson:"declared_allergens" json:"declared_allergens"`
+	IngredientAllergens []string           `bson:"ingredient_allergens" json:"ingredient_allergens"`
+	CreatedBy           primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	UpdatedBy           primitive.ObjectID `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	CreatedAt           time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt           time.Time          `bson:"updated_at" json:"updated_at"`
+	DeletedAt           *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // set when soft deleted
+}
+
+// SetAllergens records the allergens declared for the meal and those of its
+// recipe's ingredients, and sets Allergens to both
+func (m *Meal) SetAllergens(declared, ingredients []string) {
+	m.DeclaredAllergens = sortedUnion(declared)
+	m.IngredientAllergens = sortedUnion(ingredients)
+	m.Allergens = sortedUnion(declared, ingredients)
+}
+
+// sortedUnion merges lists into one sorted list without duplicates
+func sortedUnion(lists ...[]string) []string {
+	seen := map[string]bool{}
+	union := []string{}
+	for _, list := range lists {
+		for _, value := range list {
+			if !seen[value] {
+				seen[value] = true
+				union = append(union, value)
+			}
+		}
+	}
+	sort.Strings(union)
+	return union
+}
+
+// MealRequest creates a meal or fully replaces one (PUT)
+type MealRequest struct {
+	Name        string    `json:"name" binding:"required,min=2,max=100"`
+	Description string    `json:"description" binding:"max=1000"`
+	Image       string    `json:"image" binding:"omitempty,uri"`
+	Calories    int       `json:"calories" binding:"required,gt=0,lte=5000"`
+	Nutrition   Nutrition `json:"nutrition"`
+	Preptime    int       `json:"prep_time" binding:"required,gt=0,lte=600"`
+	Category    string    `json:"category" binding:"required,oneof=breakfast lunch dinner dessert snack"`
+	Tags        []string  `json:"tags"`
+	Allergens   []string  `json:"allergens"`
+}
+
+// UpdateMealRequest partially updates a meal (PATCH); nil fields are left unchanged
+type UpdateMealRequest struct {
+	Name        *string    `json:"name" binding:"omitempty,min=2,max=100"`
+	Description *string    `json:"description" binding:"omitempty,max=1000"`
+	Image       *string    `json:"image" binding:"omitempty,uri"`
+	Calories    *int       `json:"calories" binding:"omitempty,gt=0,lte=5000"`
+	Nutrition   *Nutrition `json:"nutrition"`
+	Preptime    *int       `json:"prep_time" binding:"omitempty,gt=0,lte=600"`
+	Category    *string    `json:"category" binding:"omitempty,oneof=breakfast lunch dinner dessert snack"`
+	Tags        *[]string  `json:"tags"`
+	Allergens   *[]string  `json:"allergens"`
+}
+
+// FieldChange records a field's value before and after an edit
+type FieldChange struct {
+	From interface{} `bson:"from" json:"from"`
+	To   interface{} `bson:"to" json:"to"`
+}
+
+// DiffMeals lists the editable fields that differ between two versions of a meal
+func DiffMeals(before, after Meal) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	if before.Name != after.Name {
+		changes["name"] = FieldChange{From: before.Name, To: after.Name}
+	}
+	if before.Description != after.Description {
+		changes["description"] = FieldChange{From: before.Description, To: after.Description}
+	}
+	if before.Image != after.Image {
+		changes["image"] = FieldChange{From: before.Image, To: after.Image}
+	}
+	if before.Calories != after.Calories {
+		changes["calories"] = FieldChange{From: before.Calories, To: after.Calories}
+	}
+	if !reflect.DeepEqual(before.Nutrition, after.Nutrition) {
+		changes["nutrition"] = FieldChange{From: before.Nutrition, To: after.Nutrition}
+	}
+	if before.Preptime != after.Preptime {
+		changes["prep_time"] = FieldChange{From: before.Preptime, To: after.Preptime}
+	}
+	if before.Category != after.Category {
+		changes["category"] = FieldChange{From: before.Category, To: after.Category}
+	}
+	if strings.Join(before.Tags, ",") != strings.Join(after.Tags, ",") {
+		changes["tags"] = FieldChange{From: before.Tags, To: after.Tags}
+	}
+	if strings.Join(before.Allergens, ",") != strings.Join(after.Allergens, ",") {
+		changes["allergens"] = FieldChange{From: before.Allergens, To: after.Allergens}
+	}
+	return changes
+}
+
+// MealAuditLog records who changed a meal and how
+type MealAuditLog struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	MealID    primitive.ObjectID     `bson:"meal_id" json:"meal_id"`
+	UserID    primitive.ObjectID     `bson:"user_id" json:"user_id"`
+	Action    string                 `bson:"action" json:"action"` // create, update, delete, recalculate, import
+	Changes   map[string]FieldChange `bson:"changes,omitempty" json:"changes,omitempty"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+}
+
+// MealSearchCursor is the keyset position encoded into the opaque search cursor
+type MealSearchCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    string      `json:"id"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MealPlanCacheEntry stores an AI-generated plan under a hash of its normalized inputs
+type MealPlanCacheEntry struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Key              string             `bson:"key" json:"key"`
+	Days             map[int]DailyMeals `bson:"days" json:"days"`
+	Preference       string             `bson:"preference" json:"preference"`
+	CatalogueVersion string             `bson:"catalogue_version" json:"catalogue_version"`
+	Model            string             `bson:"model" json:"model"`
+	PromptVersion    string             `bson:"prompt_version" json:"prompt_version"`
+	Hits             int                `bson:"hits" json:"hits"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt        time.Time          `bson:"expires_at" json:"expires_at"`
+}
@@ -1,24 +1,369 @@
 package models
 
 import (
+	"math"
+	"sort"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type DailyMeals struct {
-    Breakfast string `bson:"breakfast" json:"breakfast"`
-    Lunch     string `bson:"lunch" json:"lunch"`
-    Dinner    string `bson:"dinner" json:"dinner"`
-    Dessert   string `bson:"dessert" json:"dessert"`
-}
-
-type MonthlyMealPlan struct {
-    ID        primitive.ObjectID         `bson:"_id,omitempty" json:"id"`
-    UserID    primitive.ObjectID         `bson:"user_id" json:"user_id"`
-    Month     int                        `bson:"month" json:"month"`
-    Year      int                        `bson:"year" json:"year"`
-    Days      map[int]DailyMeals        `bson:"days" json:"days"` // Key is day of month (1-31)
-    CreatedAt time.Time                 `bson:"created_at" json:"created_at"`
-    UpdatedAt time.Time                 `bson:"updated_at" json:"updated_at"`
+// PlannedMeal fills a plan slot: the meal's ID plus a snapshot of its name,
+// image and calories taken when it was planned, so the plan still reads
+// sensibly after the meal is renamed or deleted. An empty slot has no ID.
+type PlannedMeal struct {
+    MealID   primitive.ObjectID `bson:"meal_id,omitempty" json:"meal_id,omitempty"`
+    Name     string             `bson:"name" json:"name"`
+    Image    string             `bson:"image,omitempty" json:"image,omitempty"`
+    Calories int                `bson:"calories" json:"calories"`
+    Locked   bool               `bson:"locked,omitempty" json:"locked,omitempty"` // kept as is by regeneration and recalibration
+    // Status marks a slot the user skips or eats out for, which holds no meal.
+    // Calories is then the estimate for eating out.
+    Status   string             `bson:"status,omitempty" json:"status,omitempty"`
+}
+
+// Statuses of a slot without a planned meal
+const (
+    SlotSkipped   = "skipped"
+    SlotEatingOut = "eating_out"
+)
+
+// legacyNoMealAvailable is how name-based plans marked an empty slot
+const legacyNoMealAvailable = "No meal available"
+
+// NewPlannedMeal snapshots a meal for a plan slot
+func NewPlannedMeal(meal Meal) PlannedMeal {
+    return PlannedMeal{MealID: meal.ID, Name: meal.Name, Image: meal.Image, Calories: meal.Calories}
+}
+
+// IsEmpty reports whether no meal is planned in the slot
+func (p PlannedMeal) IsEmpty() bool {
+    return p.MealID.IsZero() && p.Name == ""
+}
+
+// String returns the meal name, which is how prompts show a slot
+func (p PlannedMeal) String() string {
+    switch p.Status {
+    case SlotSkipped:
+        return "skipped"
+    case SlotEatingOut:
+        return "eating out"
+    }
+    if p.IsEmpty() {
+        return "nothing planned"
+    }
+    return p.Name
+}
+
+// UnmarshalBSONValue also reads slots written before plans referenced meals by
+// ID, which held just the meal name
+func (p *PlannedMeal) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+    raw := bson.RawValue{Type: t, Value: data}
+    if name, ok := raw.StringValueOK(); ok {
+        if name == legacyNoMealAvailable {
+            name = ""
+        }
+        *p = PlannedMeal{Name: name}
+        return nil
+    }
+    if t == bsontype.Null {
+        *p = PlannedMeal{}
+        return nil
+    }
+
+    type plain PlannedMeal
+    return raw.Unmarshal((*plain)(p))
+}
+
+// MealCategories lists the catalogue categories meals are filed under. Every
+// slot of a day is filled from one of them.
+var MealCategories = []string{"breakfast", "lunch", "dinner", "dessert", "snack"}
+
+// IsMealCategory reports whether category is one of MealCategories
+func IsMealCategory(category string) bool {
+    for _, known := range MealCategories {
+        if category == known {
+            return true
+        }
+    }
+    return false
+}
+
+// MealSlot is one meal of a user's day. Slots are listed in serving order and
+// their calorie shares add up to the whole day.
+type MealSlot struct {
+    Name         string  `bson:"name" json:"name"`                     // key of the slot in a day's meals, e.g. breakfast or snack_2
+    Category     string  `bson:"category" json:"category"`             // catalogue category the slot is filled from
+    Time         string  `bson:"time,omitempty" json:"time,omitempty"` // target time, HH:MM
+    CalorieShare float64 `bson:"calorie_share" json:"calorie_share"`   // fraction of the day's calories
+}
+
+// DefaultMealSlots is the day of a user who has not configured their own slots
+var DefaultMealSlots = []MealSlot{
+    {Name: "breakfast", Category: "breakfast", Time: "08:00", CalorieShare: 0.25},
+    {Name: "lunch", Category: "lunch", Time: "13:00", CalorieShare: 0.35},
+    {Name: "dinner", Category: "dinner", Time: "19:00", CalorieShare: 0.30},
+    {Name: "dessert", Category: "dessert", Time: "20:00", CalorieShare: 0.10},
+}
+
+// MealSlotsOrDefault returns slots, or DefaultMealSlots when none are configured
+func MealSlotsOrDefault(slots []MealSlot) []MealSlot {
+    if len(slots) == 0 {
+        return DefaultMealSlots
+    }
+    return slots
+}
+
+// SlotNames lists the names of slots in order
+func SlotNames(slots []MealSlot) []string {
+    names := make([]string, len(slots))
+    for i, slot := range slots {
+        names[i] = slot.Name
+    }
+    return names
+}
+
+// FindSlot returns the slot called name
+func FindSlot(slots []MealSlot, name string) (MealSlot, bool) {
+    for _, slot := range slots {
+        if slot.Name == name {
+            return slot, true
+        }
+    }
+    return MealSlot{}, false
+}
+
+// SlotCategory returns the category a slot is filled from. Slots that are no
+// longer configured fall back to their name, which is how the fixed
+// breakfast, lunch, dinner and dessert slots mapped to categories.
+func SlotCategory(slots []MealSlot, name string) string {
+    if slot, ok := FindSlot(slots, name); ok {
+        return slot.Category
+    }
+    return name
+}
+
+// DailyMeals holds a day's meals keyed by slot name. Days planned before slots
+// were configurable decode the same way, keyed breakfast, lunch, dinner and
+// dessert.
+type DailyMeals map[string]PlannedMeal
+
+// Get returns the meal in a slot and whether the day has that slot
+func (d DailyMeals) Get(slot string) (PlannedMeal, bool) {
+    meal, ok := d[slot]
+    return meal, ok
+}
+
+// Set replaces the meal in a slot
+func (d *DailyMeals) Set(slot string, meal PlannedMeal) {
+    if *d == nil {
+        *d = make(DailyMeals)
+    }
+    (*d)[slot] = meal
+}
+
+// Clone copies the day so it can be changed without touching the original
+func (d DailyMeals) Clone() DailyMeals {
+    clone := make(DailyMeals, len(d))
+    for slot, meal := range d {
+        clone[slot] = meal
+    }
+    return clone
+}
+
+// KeepLocked returns the day with the locked slots of previous, the same
+// date as planned before, put back in place
+func (d DailyMeals) KeepLocked(previous DailyMeals) DailyMeals {
+    kept := d.Clone()
+    for slot, meal := range previous {
+        if meal.Locked {
+            kept[slot] = meal
+        }
+    }
+    return kept
+}
+
+// SlotNames lists the day's slots in the order of slots, followed by any the
+// day holds that slots does not name, alphabetically
+func (d DailyMeals) SlotNames(slots []MealSlot) []string {
+    names := make([]string, 0, len(d))
+    listed := make(map[string]bool, len(slots))
+    for _, slot := range slots {
+        listed[slot.Name] = true
+        if _, ok := d[slot.Name]; ok {
+            names = append(names, slot.Name)
+        }
+    }
+    var extra []string
+    for slot := range d {
+        if !listed[slot] {
+            extra = append(extra, slot)
+        }
+    }
+    sort.Strings(extra)
+    return append(names, extra...)
+}
+
+// MealIDs lists the IDs of the meals planned for the day
+func (d DailyMeals) MealIDs() []primitive.ObjectID {
+    var ids []primitive.ObjectID
+    for _, slot := range d.SlotNames(nil) {
+        if planned := d[slot]; !planned.MealID.IsZero() {
+            ids = append(ids, planned.MealID)
+        }
+    }
+    return ids
+}
+
+// ExpandedMeal is a plan slot together with the full details of its meal.
+// Meal is nil for an empty slot or a meal that no longer exists.
+type ExpandedMeal struct {
+    PlannedMeal
+    Meal *Meal `json:"meal"`
+}
+
+// Expand attaches the full details from mealsByID to every slot of the day
+func (d DailyMeals) Expand(mealsByID map[primitive.ObjectID]Meal) map[string]ExpandedMeal {
+    expanded := make(map[string]ExpandedMeal, len(d))
+    for slot, planned := range d {
+        slotMeal := ExpandedMeal{PlannedMeal: planned}
+        if meal, exists := mealsByID[planned.MealID]; exists && !planned.MealID.IsZero() {
+            slotMeal.Meal = &meal
+        }
+        expanded[slot] = slotMeal
+    }
+    return expanded
+}
+
+// DaySlot is one slot of a day, as the daily plan lists them in serving order
+type DaySlot struct {
+    Slot MealSlot `json:"slot"`
+    ExpandedMeal
+    TargetCalories int `json:"target_calories,omitempty"` // the slot's share of the daily calorie target
+}
+
+// Ordered expands the day into slots, in their order and including those the
+// day was planned without. Slots the day holds but slots does not name
+// follow, as slots of their own category.
+func (d DailyMeals) Ordered(slots []MealSlot, mealsByID map[primitive.ObjectID]Meal, calorieTarget int) []DaySlot {
+    expanded := d.Expand(mealsByID)
+    all := append([]MealSlot(nil), slots...)
+    for _, name := range d.SlotNames(slots) {
+        if _, ok := FindSlot(slots, name); !ok {
+            all = append(all, MealSlot{Name: name, Category: name})
+        }
+    }
+
+    ordered := make([]DaySlot, 0, len(all))
+    for _, slot := range all {
+        ordered = append(ordered, DaySlot{
+            Slot:           slot,
+            ExpandedMeal:   expanded[slot.Name],
+            TargetCalories: int(math.Round(slot.CalorieShare * float64(calorieTarget))),
+        })
+    }
+    return ordered
+}
+
+// Names maps each slot to its meal name, the shape AI planners read and write
+func (d DailyMeals) Names() map[string]string {
+    names := make(map[string]string, len(d))
+    for slot, planned := range d {
+        names[slot] = planned.Name
+    }
+    return names
+}
+
+// MealPlan covers an inclusive range of calendar dates, its days keyed by
+// date (YYYY-MM-DD). A user's plans never share a date: a newer plan takes its
+// dates over from older ones, which may leave gaps inside their range.
+type MealPlan struct {
+    ID            primitive.ObjectID      `bson:"_id,omitempty" json:"id"`
+    UserID        primitive.ObjectID      `bson:"user_id" json:"user_id"`
+    StartDate     string                  `bson:"start_date" json:"start_date"`
+    EndDate       string                  `bson:"end_date" json:"end_date"`
+    Days          map[string]DailyMeals   `bson:"days" json:"days"`
+    Version       int                     `bson:"version" json:"version"` // latest MealPlanVersion, 0 before version history
+    Model         string                  `bson:"model,omitempty" json:"model,omitempty"`
+    PromptVersion string                  `bson:"prompt_version,omitempty" json:"prompt_version,omitempty"`
+    Cached        bool                    `bson:"cached" json:"cached"` // served from the generation cache
+    DailyTotals   map[string]NutritionTotals `bson:"-" json:"daily_totals,omitempty"` // computed for responses
+    Warnings      []NutritionWarning      `bson:"-" json:"warnings,omitempty"`     // condition rule breaches, computed for responses
+    Targets       *NutritionTargets       `bson:"targets,omitempty" json:"targets,omitempty"` // daily targets the plan was fitted to
+    TargetMisses  []string                `bson:"-" json:"target_misses,omitempty"` // dates outside the target tolerance, computed for responses
+    Unlocked      []UnlockedSlot          `bson:"-" json:"unlocked,omitempty"`       // locked slots replaced for breaking the dietary profile
+    CreatedAt     time.Time               `bson:"created_at" json:"created_at"`
+    UpdatedAt     time.Time               `bson:"updated_at" json:"updated_at"`
+}
+
+// UnlockedSlot is a locked slot whose meal the user's allergens or dietary
+// restrictions now rule out, so it was unlocked and replaced
+type UnlockedSlot struct {
+    Date   string `json:"date"`
+    Slot   string `json:"slot"`
+    Meal   string `json:"meal"`
+    Reason string `json:"reason"`
+}
+
+// DaysInRange gathers the days of plans that fall from start to end inclusive
+func DaysInRange(plans []MealPlan, start, end string) map[string]DailyMeals {
+    days := make(map[string]DailyMeals)
+    for _, plan := range plans {
+        for date, dailyMeals := range plan.Days {
+            if date >= start && date <= end {
+                days[date] = dailyMeals
+            }
+        }
+    }
+    return days
+}
+
+// GenerateMealPlanRequest picks the dates to plan. Both are optional and
+// default to the current month.
+type GenerateMealPlanRequest struct {
+    StartDate string `json:"start_date"`
+    EndDate   string `json:"end_date"`
+    Reason    string `json:"reason"` // recorded on the plan's first version
+}
+
+// SetSlotMealRequest puts a catalogue meal into one slot of a planned day
+type SetSlotMealRequest struct {
+    MealID string `json:"meal_id" binding:"required"`
+    Locked *bool  `json:"locked"` // also lock or unlock the slot; left as is when omitted
+}
+
+// SlotRef names one slot of one planned date
+type SlotRef struct {
+    Date string `json:"date" binding:"required"`
+    Slot string `json:"slot" binding:"required"`
+}
+
+// SwapSlotsRequest exchanges the meals of two slots, on one date or two
+type SwapSlotsRequest struct {
+    First  SlotRef `json:"first" binding:"required"`
+    Second SlotRef `json:"second" binding:"required"`
+}
+
+// EatingOutSlot is a slot the user eats out for
+type EatingOutSlot struct {
+    SlotRef
+    Calories int `json:"calories" binding:"gte=0"` // estimate; defaults to the slot's share of the calorie target
+}
+
+// RecalibrationRequest picks the dates to recalibrate and what their new meals
+// must respect. Without dates or days every upcoming date of the plan is
+// recalibrated. Skipped and eating out slots are recalibrated with their day.
+type RecalibrationRequest struct {
+    Dates        []string        `json:"dates"`
+    Days         []int           `json:"days"` // days of the current month
+    Reason       string          `json:"reason"`
+    ExcludeMeals []string        `json:"exclude_meals"` // meal IDs never to plan
+    MaxPrepTime  int             `json:"max_prep_time" binding:"gte=0"` // minutes, per meal
+    MinCalories  int             `json:"min_calories" binding:"gte=0"` // per day, instead of the calorie target
+    MaxCalories  int             `json:"max_calories" binding:"gte=0"`
+    UseUp        []string        `json:"use_up"` // ingredient IDs; meals whose recipes use them are preferred
+    Skip         []SlotRef       `json:"skip" binding:"dive"`
+    EatingOut    []EatingOutSlot `json:"eating_out" binding:"dive"`
 }
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sources of a meal plan version: who or what produced the change
+const (
+	PlanSourceAI            = "ai"
+	PlanSourceDeterministic = "deterministic"
+	PlanSourceManual        = "manual"
+)
+
+// MealPlanVersion is an immutable snapshot of a meal plan, written every time
+// the plan changes. Version 1 is the plan as generated; a plan whose dates were
+// all taken over by newer plans ends in a version without days.
+type MealPlanVersion struct {
+	ID            primitive.ObjectID    `bson:"_id,omitempty" json:"id"`
+	PlanID        primitive.ObjectID    `bson:"plan_id" json:"plan_id"`
+	UserID        primitive.ObjectID    `bson:"user_id" json:"user_id"`
+	Version       int                   `bson:"version" json:"version"`
+	Reason        string                `bson:"reason" json:"reason"`
+	Source        string                `bson:"source" json:"source"`
+	StartDate     string                `bson:"start_date,omitempty" json:"start_date,omitempty"`
+	EndDate       string                `bson:"end_date,omitempty" json:"end_date,omitempty"`
+	Days          map[string]DailyMeals `bson:"days" json:"days,omitempty"`
+	Model         string                `bson:"model,omitempty" json:"model,omitempty"`
+	PromptVersion string                `bson:"prompt_version,omitempty" json:"prompt_version,omitempty"`
+	Targets       *NutritionTargets     `bson:"targets,omitempty" json:"targets,omitempty"`
+	// ReplacedPlanIDs are the older plans this version took dates over from
+	ReplacedPlanIDs []primitive.ObjectID `bson:"replaced_plan_ids,omitempty" json:"replaced_plan_ids,omitempty"`
+	CreatedAt       time.Time            `bson:"created_at" json:"created_at"`
+}
+
+// NewMealPlanVersion snapshots a plan as its current version
+func NewMealPlanVersion(plan MealPlan, reason, source string, now time.Time) MealPlanVersion {
+	return MealPlanVersion{
+		PlanID:        plan.ID,
+		UserID:        plan.UserID,
+		Version:       plan.Version,
+		Reason:        reason,
+		Source:        source,
+		StartDate:     plan.StartDate,
+		EndDate:       plan.EndDate,
+		Days:          plan.Days,
+		Model:         plan.Model,
+		PromptVersion: plan.PromptVersion,
+		Targets:       plan.Targets,
+		CreatedAt:     now,
+	}
+}
+
+// RollbackRequest picks the version a plan is restored to
+type RollbackRequest struct {
+	Version int    `json:"version" binding:"required,min=1"`
+	Reason  string `json:"reason"`
+}
+
+// Statuses of a day in a plan diff
+const (
+	DayAdded   = "added"
+	DayRemoved = "removed"
+	DayChanged = "changed"
+)
+
+// SlotChange is a slot whose meal differs between two versions
+type SlotChange struct {
+	Slot string      `json:"slot"`
+	From PlannedMeal `json:"from"`
+	To   PlannedMeal `json:"to"`
+}
+
+// DayDiff describes how one date differs between two versions
+type DayDiff struct {
+	Date   string       `json:"date"`
+	Status string       `json:"status"`
+	Slots  []SlotChange `json:"slots,omitempty"`
+}
+
+// DiffPlanDays lists, by date, every day that differs between from and to.
+// Meals are compared by ID, so a renamed meal is not a change.
+func DiffPlanDays(from, to map[string]DailyMeals) []DayDiff {
+	dates := make(map[string]bool, len(from)+len(to))
+	for date := range from {
+		dates[date] = true
+	}
+	for date := range to {
+		dates[date] = true
+	}
+	sorted := make([]string, 0, len(dates))
+	for date := range dates {
+		sorted = append(sorted, date)
+	}
+	sort.Strings(sorted)
+
+	diffs := []DayDiff{}
+	for _, date := range sorted {
+		before, inFrom := from[date]
+		after, inTo := to[date]
+		diff := DayDiff{Date: date, Status: DayChanged}
+		switch {
+		case !inFrom:
+			diff.Status = DayAdded
+		case !inTo:
+			diff.Status = DayRemoved
+		}
+
+		slots := make(map[string]bool, len(before)+len(after))
+		for slot := range before {
+			slots[slot] = true
+		}
+		for slot := range after {
+			slots[slot] = true
+		}
+		names := make([]string, 0, len(slots))
+		for slot := range slots {
+			names = append(names, slot)
+		}
+		sort.Strings(names)
+		for _, slot := range names {
+			if !SamePlannedMeal(before[slot], after[slot]) {
+				diff.Slots = append(diff.Slots, SlotChange{Slot: slot, From: before[slot], To: after[slot]})
+			}
+		}
+
+		if diff.Status != DayChanged || len(diff.Slots) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// SamePlannedMeal compares slots by meal ID, falling back to the name for
+// slots planned before meals were referenced by ID. Locking or unlocking a
+// slot, or skipping it, is a change too.
+func SamePlannedMeal(a, b PlannedMeal) bool {
+	if a.Locked != b.Locked || a.Status != b.Status {
+		return false
+	}
+	if !a.MealID.IsZero() || !b.MealID.IsZero() {
+		return a.MealID == b.MealID
+	}
+	return a.Name == b.Name
+}
@@ -0,0 +1,36 @@
+package models
+
+// Nutrition is the nutrient content of one serving. Macronutrients are in
+// grams and sodium in milligrams. Micronutrients are keyed by nutrient and
+// unit, e.g. potassium_mg or vitamin_d_mcg.
+type Nutrition struct {
+	Protein        float64            `bson:"protein" json:"protein" binding:"gte=0"`
+	Carbohydrates  float64            `bson:"carbohydrates" json:"carbohydrates" binding:"gte=0"`
+	Fat            float64            `bson:"fat" json:"fat" binding:"gte=0"`
+	Fiber          float64            `bson:"fiber" json:"fiber" binding:"gte=0"`
+	Sugar          float64            `bson:"sugar" json:"sugar" binding:"gte=0"`
+	Sodium         float64            `bson:"sodium" json:"sodium" binding:"gte=0"`
+	Micronutrients map[string]float64 `bson:"micronutrients,omitempty" json:"micronutrients,omitempty" binding:"omitempty,dive,gte=0"`
+}
+
+// Add accumulates other scaled by factor (e.g. number of servings)
+func (n *Nutrition) Add(other Nutrition, factor float64) {
+	n.Protein += other.Protein * factor
+	n.Carbohydrates += other.Carbohydrates * factor
+	n.Fat += other.Fat * factor
+	n.Fiber += other.Fiber * factor
+	n.Sugar += other.Sugar * factor
+	n.Sodium += other.Sodium * factor
+	for name, amount := range other.Micronutrients {
+		if n.Micronutrients == nil {
+			n.Micronutrients = make(map[string]float64)
+		}
+		n.Micronutrients[name] += amount * factor
+	}
+}
+
+// NutritionTotals sums calories and nutrients over several meals
+type NutritionTotals struct {
+	Calories  int `bson:"calories" json:"calories"`
+	Nutrition `bson:",inline"`
+}
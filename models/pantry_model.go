@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PantryItem is a quantity of an ingredient the user has at home. The same
+// ingredient bought at different times is kept as separate items, each with
+// its own expiry date.
+type PantryItem struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	IngredientID primitive.ObjectID `bson:"ingredient_id" json:"ingredient_id"`
+	Name         string             `bson:"name" json:"name"` // the ingredient's name when it was added
+	Quantity     float64            `bson:"quantity" json:"quantity"`
+	Unit         string             `bson:"unit" json:"unit"`
+	ExpiresOn    string             `bson:"expires_on,omitempty" json:"expires_on,omitempty"` // YYYY-MM-DD; empty for food that keeps
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// PantryItemRequest adds an item to the pantry or replaces one
+type PantryItemRequest struct {
+	IngredientID string  `json:"ingredient_id" binding:"required"`
+	Quantity     float64 `json:"quantity" binding:"required,gt=0"`
+	Unit         string  `json:"unit" binding:"required,oneof=g kg mg ml l tsp tbsp cup piece"`
+	ExpiresOn    string  `json:"expires_on"`
+}
+
+// PantryUse is how much of a pantry item cooking a meal took
+type PantryUse struct {
+	ItemID       primitive.ObjectID `bson:"item_id" json:"item_id"`
+	IngredientID primitive.ObjectID `bson:"ingredient_id" json:"ingredient_id"`
+	Name         string             `bson:"name" json:"name"`
+	Quantity     float64            `bson:"quantity" json:"quantity"`
+	Unit         string             `bson:"unit" json:"unit"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PromptTemplate is a named, versioned text/template defining a "system" and
+// an optional "user" block. Templates ship as files under PROMPTS_DIR and an active
+// document in Mongo overrides the file version without a redeploy.
+type PromptTemplate struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Version   string             `bson:"version" json:"version"`
+	Body      string             `bson:"body" json:"body"`
+	Active    bool               `bson:"active" json:"active"`
+	Source    string             `bson:"-" json:"source"` // file or database
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type CreatePromptTemplateRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Version  string `json:"version" binding:"required"`
+	Body     string `json:"body" binding:"required"`
+	Activate bool   `json:"activate"`
+}
+
+type ActivatePromptTemplateRequest struct {
+	Version string `json:"version" binding:"required"`
+}
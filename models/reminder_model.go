@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// MealReminder is the time of one slot of the user's day, for clients to
+// schedule a notification at
+type MealReminder struct {
+	Date string       `json:"date"` // the user's calendar date
+	Slot string       `json:"slot"`
+	Time string       `json:"time"` // the slot's time on the user's clock, HH:MM
+	At   time.Time    `json:"at"`   // the same moment in UTC
+	Meal *PlannedMeal `json:"meal,omitempty"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Aisles are the store aisles ingredients are grouped by, matching
+// IngredientRequest's category values, in the order a shopping list walks them
+var Aisles = []string{
+	"produce", "meat", "seafood", "dairy", "bakery", "grains", "canned",
+	"frozen", "spices", "condiments", "beverages", "snacks", "other",
+}
+
+// ShoppingListItem is one ingredient to buy. An ingredient whose recipes
+// measure it in units that can't be converted into each other gets one item
+// per kind of unit; Key tells them apart.
+type ShoppingListItem struct {
+	Key          string             `bson:"key" json:"key"`
+	IngredientID primitive.ObjectID `bson:"ingredient_id" json:"ingredient_id"`
+	Name         string             `bson:"name" json:"name"`
+	Aisle        string             `bson:"aisle" json:"aisle"`
+	Quantity     float64            `bson:"quantity" json:"quantity"` // to buy, after what the pantry holds
+	Unit         string             `bson:"unit" json:"unit"`
+	Needed       float64            `bson:"needed" json:"needed"` // what the planned meals call for, in Unit
+	InPantry     float64            `bson:"in_pantry,omitempty" json:"in_pantry,omitempty"`
+	Meals        []string           `bson:"meals" json:"meals"` // planned meals that use it
+	Checked      bool               `bson:"checked" json:"checked"`
+}
+
+// ShoppingList gathers the ingredients of the meals planned from StartDate to
+// EndDate. Generating a list for the same dates again replaces its items but
+// keeps them checked off.
+type ShoppingList struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	StartDate string             `bson:"start_date" json:"start_date"`
+	EndDate   string             `bson:"end_date" json:"end_date"`
+	Items     []ShoppingListItem `bson:"items" json:"items"`
+	// MissingRecipes are planned meals without a recipe, whose ingredients
+	// the list can't include
+	MissingRecipes []string `bson:"missing_recipes,omitempty" json:"missing_recipes,omitempty"`
+	// UnconvertedItems are recipe ingredients left off the list because the
+	// ingredient is gone from the catalogue or its unit can't be converted
+	UnconvertedItems []string `bson:"unconverted_items,omitempty" json:"unconverted_items,omitempty"`
+	// FromPantry are ingredients the pantry fully covers
+	FromPantry []string  `bson:"from_pantry,omitempty" json:"from_pantry,omitempty"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// ShoppingListRequest picks the plan dates to shop for, by default the seven
+// days from today
+type ShoppingListRequest struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// CheckShoppingItemRequest checks an item off the list, or back on
+type CheckShoppingItemRequest struct {
+	Checked *bool `json:"checked" binding:"required"`
+}
@@ -14,8 +14,10 @@ type User struct {
 	LastName       string             `bson:"last_name" json:"last_name"`
 	AuthProvider   string             `bson:"auth_provider" json:"auth_provider"`
 	ProfilePicture string             `bson:"profile_picture" json:"profile_picture"`
+	ProfileImages  *ImageSet          `bson:"profile_images,omitempty" json:"profile_images,omitempty"` // set when the picture was uploaded
 	IsActive       bool               `bson:"is_active" json:"is_active"`
 	Role           string             `bson:"role" json:"role"`
+	PlanTier       string             `bson:"plan_tier" json:"plan_tier"` // free, premium; empty means free
 	LastLogin      time.Time          `bson:"last_login" json:"last_login"`
 	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
@@ -26,6 +28,38 @@ type User struct {
 	HealthGoals         []string `bson:"health_goals" json:"health_goals"`
 	MedicalConditions   []string `bson:"medical_conditions" json:"medical_conditions"`
 	NutritionPreference string   `bson:"nutrition_preference" json:"nutrition_preference"`
+	Allergens           []string `bson:"allergens" json:"allergens"`
+	DietaryRestrictions []string `bson:"dietary_restrictions" json:"dietary_restrictions"`
+
+	// Body metrics are stored in metric units whatever the user prefers to see
+	HeightCm         float64           `bson:"height_cm" json:"height_cm"`
+	WeightKg         float64           `bson:"weight_kg" json:"weight_kg"`
+	ActivityLevel    string            `bson:"activity_level" json:"activity_level"`
+	UnitSystem       string            `bson:"unit_system" json:"unit_system"` // metric or imperial
+	NutritionTargets *NutritionTargets `bson:"nutrition_targets,omitempty" json:"nutrition_targets,omitempty"`
+
+	// Timezone is an IANA name; plan dates and "today" follow it
+	Timezone string `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	// MealSlots are the meals of the user's day; empty means DefaultMealSlots
+	MealSlots []MealSlot `bson:"meal_slots,omitempty" json:"meal_slots,omitempty"`
+}
+
+// Location is the user's timezone, UTC until they set one
+func (u User) Location() *time.Location {
+	if loc, err := LoadTimezone(u.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// Today is the user's current calendar date, as midnight UTC like ParseDate
+func (u User) Today(now time.Time) time.Time {
+	return LocalDate(now, u.Location())
+}
+
+// Slots returns the user's meal slots, falling back to DefaultMealSlots
+func (u User) Slots() []MealSlot {
+	return MealSlotsOrDefault(u.MealSlots)
 }
 
 type SignUpRequest struct {
@@ -36,11 +70,23 @@ type SignUpRequest struct {
 }
 
 type OnboardingRequest struct {
-	Gender              string   `json:"gender" binding:"required,oneof=male female other"`
-	Birthdate           string   `json:"birthdate" binding:"required,datetime=2006-01-02"`
-	HealthGoals         []string `json:"health_goals" binding:"required"`
-	MedicalConditions   []string `json:"medical_condition" binding:"required"`
-	NutritionPreference string   `json:"nutrition_preference" binding:"required,oneof=vegetarian vegan pescatarian gluten_free dairy_free none"`
+	Gender              string              `json:"gender" binding:"required,oneof=male female other"`
+	Birthdate           string              `json:"birthdate" binding:"required,datetime=2006-01-02"`
+	HealthGoals         []string            `json:"health_goals" binding:"required"`
+	MedicalConditions   []string            `json:"medical_condition" binding:"required"`
+	NutritionPreference string              `json:"nutrition_preference" binding:"omitempty,oneof=vegetarian vegan pescatarian gluten_free dairy_free none"`
+	Allergens           []string            `json:"allergens"`
+	DietaryRestrictions []string            `json:"dietary_restrictions"`
+	BodyMetrics         *BodyMetricsRequest `json:"body_metrics"`
+	Timezone            string              `json:"timezone"`
+}
+
+type UpdateTimezoneRequest struct {
+	Timezone string `json:"timezone" binding:"required"`
+}
+
+type UpdateMealSlotsRequest struct {
+	Slots []MealSlot `json:"slots" binding:"required"`
 }
 
 type SignInRequest struct {
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"figorate/controllers"
+	"figorate/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupAdminRoutes(r *gin.Engine) {
+	adminController := controllers.NewAdminController()
+
+	adminRoutes := r.Group("/admin")
+	adminRoutes.Use(middleware.JWTAuthMiddleware(), middleware.AdminMiddleware())
+	{
+		adminRoutes.GET("/ai-usage", adminController.GetAIUsageReport)
+
+		adminRoutes.GET("/prompts/:name", adminController.GetPromptTemplate)
+		adminRoutes.POST("/prompts", adminController.CreatePromptTemplate)
+		adminRoutes.POST("/prompts/:name/activate", adminController.ActivatePromptTemplate)
+		adminRoutes.DELETE("/prompts/:name/override", adminController.ClearPromptOverride)
+
+		adminRoutes.GET("/condition-rules", adminController.ListConditionRules)
+		adminRoutes.PUT("/condition-rules/:condition", adminController.UpdateConditionRule)
+		adminRoutes.DELETE("/condition-rules/:condition", adminController.ResetConditionRule)
+	}
+}
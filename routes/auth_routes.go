@@ -24,6 +24,15 @@ func SetupAuthRoutes(r *gin.Engine) {
 	{
 		// Add protected routes here
 		protectedRoutes.GET("/profile", userController.GetProfile)
+		protectedRoutes.GET("/profile/ai-usage", userController.GetAIUsage)
+		protectedRoutes.GET("/profile/dietary", userController.GetDietaryProfile)
+		protectedRoutes.PUT("/profile/dietary", userController.UpdateDietaryProfile)
+		protectedRoutes.PUT("/profile/body-metrics", userController.UpdateBodyMetrics)
+		protectedRoutes.GET("/profile/targets", userController.GetNutritionTargets)
+		protectedRoutes.PUT("/profile/timezone", userController.UpdateTimezone)
+		protectedRoutes.GET("/profile/meal-slots", userController.GetMealSlots)
+		protectedRoutes.PUT("/profile/meal-slots", userController.UpdateMealSlots)
+		protectedRoutes.POST("/profile/picture", userController.UploadProfilePicture)
 		protectedRoutes.POST("/onboarding", onboardingController.CompleteOnboarding)
 	}
 }
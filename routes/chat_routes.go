@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"figorate/controllers"
+	"figorate/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupChatRoutes(r *gin.Engine) {
+	chatController := controllers.NewChatController()
+
+	chatRoutes := r.Group("/chat")
+	chatRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		chatRoutes.POST("/messages", chatController.SendMessage)
+		chatRoutes.GET("", chatController.ListConversations)
+		chatRoutes.GET("/:id", chatController.GetConversation)
+		chatRoutes.POST("/:id/confirm", chatController.ConfirmAction)
+		chatRoutes.POST("/:id/cancel", chatController.CancelAction)
+	}
+}
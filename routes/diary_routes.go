@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"figorate/controllers"
+	"figorate/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupDiaryRoutes(r *gin.Engine) {
+	diaryController := controllers.NewDiaryController()
+
+	diaryRoutes := r.Group("/diary")
+	diaryRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		diaryRoutes.GET("/adherence", diaryController.GetAdherence)
+		diaryRoutes.DELETE("/entries/:entryId", diaryController.DeleteDiaryEntry)
+		diaryRoutes.GET("/:date", diaryController.GetDiaryDay)
+		diaryRoutes.PUT("/:date/slots/:slot", diaryController.LogPlanSlot)
+		diaryRoutes.DELETE("/:date/slots/:slot", diaryController.ClearPlanSlot)
+		diaryRoutes.POST("/:date/foods", diaryController.LogFood)
+	}
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"figorate/controllers"
+	"figorate/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupIngredientRoutes(r *gin.Engine) {
+	ingredientController := controllers.NewIngredientController()
+	adminOnly := middleware.AdminMiddleware()
+
+	ingredientRoutes := r.Group("/ingredients")
+	ingredientRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		ingredientRoutes.GET("", ingredientController.ListIngredients)
+		ingredientRoutes.GET("/:id", ingredientController.GetIngredient)
+		ingredientRoutes.POST("", adminOnly, ingredientController.CreateIngredient)
+		ingredientRoutes.POST("/import", adminOnly, ingredientController.ImportIngredients)
+		ingredientRoutes.PUT("/:id", adminOnly, ingredientController.UpdateIngredient)
+		ingredientRoutes.DELETE("/:id", adminOnly, ingredientController.DeleteIngredient)
+	}
+}
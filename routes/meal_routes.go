@@ -11,14 +11,40 @@ import (
 
 func SetupMealRoutes(r *gin.Engine){
 	mealController := controllers.NewMealController()
+	adminOnly := middleware.AdminMiddleware()
 
 
 	mealRoutes := r.Group("/meals")
 	mealRoutes.Use(middleware.JWTAuthMiddleware())
 	{
-		mealRoutes.POST("/add", mealController.AddMeal)
+		// Catalogue
+		mealRoutes.GET("", mealController.SearchMeals)
+		mealRoutes.GET("/export", adminOnly, mealController.ExportMeals)
+		mealRoutes.POST("/import", adminOnly, mealController.ImportMeals)
+		mealRoutes.GET("/:id", mealController.GetMeal)
+		mealRoutes.POST("", adminOnly, mealController.CreateMeal)
+		mealRoutes.POST("/add", adminOnly, mealController.CreateMeal)
+		mealRoutes.PUT("/:id", adminOnly, mealController.UpdateMeal)
+		mealRoutes.PATCH("/:id", adminOnly, mealController.PatchMeal)
+		mealRoutes.DELETE("/:id", adminOnly, mealController.DeleteMeal)
+		mealRoutes.GET("/:id/audit", adminOnly, mealController.GetMealAudit)
+		mealRoutes.GET("/:id/recipe", mealController.GetMealRecipe)
+		mealRoutes.PUT("/:id/recipe", adminOnly, mealController.SetMealRecipe)
+		mealRoutes.POST("/:id/image", adminOnly, mealController.UploadMealImage)
+
+		// Plans
 		mealRoutes.POST("/generate-plan",mealController.GenerateMealPlan)
-		mealRoutes.GET("/plan/:day", mealController.GetDailyMealPlan)
+		mealRoutes.GET("/plan", mealController.GetMealPlan)
+		mealRoutes.GET("/plan/reminders", mealController.GetMealReminders)
+		mealRoutes.GET("/plan/:date", mealController.GetDailyMealPlan)
+		mealRoutes.PUT("/plan/:date/slots/:slot", mealController.SetPlanSlot)
+		mealRoutes.PUT("/plan/:date/slots/:slot/lock", mealController.LockPlanSlot)
+		mealRoutes.DELETE("/plan/:date/slots/:slot/lock", mealController.LockPlanSlot)
+		mealRoutes.GET("/plan/:date/slots/:slot/suggestions", mealController.SuggestPlanSlot)
+		mealRoutes.POST("/plan/swap", mealController.SwapPlanSlots)
 		mealRoutes.POST("/recalibrate",mealController.RecalibrateMealPlan)
+		mealRoutes.GET("/plans/:planId/versions", mealController.GetMealPlanVersions)
+		mealRoutes.GET("/plans/:planId/diff", mealController.DiffMealPlanVersions)
+		mealRoutes.POST("/plans/:planId/rollback", mealController.RollbackMealPlan)
 	}
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"figorate/controllers"
+	"figorate/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupPantryRoutes(r *gin.Engine) {
+	pantryController := controllers.NewPantryController()
+
+	pantryRoutes := r.Group("/pantry")
+	pantryRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		pantryRoutes.GET("", pantryController.GetPantry)
+		pantryRoutes.GET("/expiring", pantryController.GetExpiringPantryMeals)
+		pantryRoutes.POST("", pantryController.AddPantryItem)
+		pantryRoutes.PUT("/:id", pantryController.UpdatePantryItem)
+		pantryRoutes.DELETE("/:id", pantryController.DeletePantryItem)
+	}
+}
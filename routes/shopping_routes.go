@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"figorate/controllers"
+	"figorate/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupShoppingRoutes(r *gin.Engine) {
+	shoppingController := controllers.NewShoppingController()
+
+	shoppingRoutes := r.Group("/shopping-lists")
+	shoppingRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		shoppingRoutes.POST("", shoppingController.GenerateShoppingList)
+		shoppingRoutes.GET("", shoppingController.ListShoppingLists)
+		shoppingRoutes.GET("/:id", shoppingController.GetShoppingList)
+		shoppingRoutes.GET("/:id/export", shoppingController.ExportShoppingList)
+		shoppingRoutes.PUT("/:id/items/:key", shoppingController.CheckShoppingItem)
+		shoppingRoutes.DELETE("/:id", shoppingController.DeleteShoppingList)
+	}
+}
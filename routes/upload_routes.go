@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"os"
+
+	"figorate/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupUploadRoutes serves uploaded files when they are stored on local disk.
+// S3-compatible backends serve their objects directly.
+func SetupUploadRoutes(r *gin.Engine) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend != "" && backend != storage.BackendLocal {
+		return
+	}
+	r.Static(storage.LocalPath, storage.LocalDir())
+}
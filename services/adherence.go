@@ -0,0 +1,185 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SlotAdherence counts what happened to planned meals
+type SlotAdherence struct {
+	Planned  int `json:"planned"`
+	Eaten    int `json:"eaten"`
+	Skipped  int `json:"skipped"`
+	Replaced int `json:"replaced"`
+	Unlogged int `json:"unlogged"`
+}
+
+func (a *SlotAdherence) add(other SlotAdherence) {
+	a.Planned += other.Planned
+	a.Eaten += other.Eaten
+	a.Skipped += other.Skipped
+	a.Replaced += other.Replaced
+	a.Unlogged += other.Unlogged
+}
+
+// Rate is the share of planned meals eaten as planned, 0 when none were planned
+func (a SlotAdherence) Rate() float64 {
+	if a.Planned == 0 {
+		return 0
+	}
+	return math.Round(float64(a.Eaten)/float64(a.Planned)*1000) / 1000
+}
+
+// DayAdherence is one date of the diary measured against the plan
+type DayAdherence struct {
+	Date string `json:"date"`
+	SlotAdherence
+	OffPlan int                    `json:"off_plan"`
+	Totals  models.NutritionTotals `json:"totals"`
+	// WithinTargets is set for logged days when the user has targets
+	WithinTargets *bool `json:"within_targets,omitempty"`
+}
+
+// MissedMeal is a planned meal the user skipped or replaced
+type MissedMeal struct {
+	MealID primitive.ObjectID `json:"meal_id"`
+	Name   string             `json:"name"`
+	Times  int                `json:"times"`
+}
+
+// AdherenceStats measures a period of the food diary against the plan
+type AdherenceStats struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	SlotAdherence
+	Rate            float64                  `json:"rate"`
+	LoggedDays      int                      `json:"logged_days"`
+	OffPlan         int                      `json:"off_plan"`
+	OffPlanCalories int                      `json:"off_plan_calories"`
+	AverageCalories int                      `json:"average_calories"` // per logged day
+	TargetCalories  int                      `json:"target_calories,omitempty"`
+	DaysOnTarget    int                      `json:"days_on_target"`
+	Slots           map[string]SlotAdherence `json:"slots"`
+	Days            []DayAdherence           `json:"days"`
+	// MissedMeals are the planned meals skipped or replaced, most often first
+	MissedMeals []MissedMeal `json:"missed_meals"`
+}
+
+// OftenMissed returns the meals skipped or replaced at least times times
+func (s AdherenceStats) OftenMissed(times int) map[primitive.ObjectID]bool {
+	missed := map[primitive.ObjectID]bool{}
+	for _, meal := range s.MissedMeals {
+		if meal.Times >= times {
+			missed[meal.MealID] = true
+		}
+	}
+	return missed
+}
+
+// DiaryTotals sums what entries say was eaten
+func DiaryTotals(entries []models.FoodLogEntry) models.NutritionTotals {
+	var totals models.NutritionTotals
+	for _, entry := range entries {
+		totals.Calories += entry.Calories
+		totals.Nutrition.Add(entry.Nutrition, 1)
+	}
+	return totals
+}
+
+// Adherence compares the diary entries from start to end inclusive with the
+// plan's days. Slots planned with a meal count as planned; skipped and eating
+// out slots of the plan do not. Days are judged on the targets when given.
+func Adherence(days map[string]models.DailyMeals, entries []models.FoodLogEntry, start, end string, targets *models.NutritionTargets, tolerance float64) AdherenceStats {
+	stats := AdherenceStats{Start: start, End: end, Slots: map[string]SlotAdherence{}, Days: []DayAdherence{}, MissedMeals: []MissedMeal{}}
+	if targets != nil {
+		stats.TargetCalories = targets.Calories
+	}
+
+	entriesByDate := map[string][]models.FoodLogEntry{}
+	for _, entry := range entries {
+		entriesByDate[entry.Date] = append(entriesByDate[entry.Date], entry)
+	}
+
+	missed := map[primitive.ObjectID]*MissedMeal{}
+	loggedCalories := 0
+	first, _ := models.ParseDate(start)
+	last, _ := models.ParseDate(end)
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		date := models.FormatDate(day)
+		dayEntries := entriesByDate[date]
+		logged := map[string]models.FoodLogEntry{}
+		result := DayAdherence{Date: date, Totals: DiaryTotals(dayEntries)}
+		for _, entry := range dayEntries {
+			if entry.Status == models.FoodOffPlan {
+				result.OffPlan++
+				stats.OffPlanCalories += entry.Calories
+				continue
+			}
+			logged[entry.Slot] = entry
+		}
+
+		dailyMeals := days[date]
+		for _, slot := range dailyMeals.SlotNames(nil) {
+			planned := dailyMeals[slot]
+			if planned.IsEmpty() || planned.Status != "" {
+				continue
+			}
+			var counts SlotAdherence
+			counts.Planned = 1
+			switch logged[slot].Status {
+			case models.FoodEaten:
+				counts.Eaten = 1
+			case models.FoodSkipped:
+				counts.Skipped = 1
+			case models.FoodReplaced:
+				counts.Replaced = 1
+			default:
+				counts.Unlogged = 1
+			}
+			if (counts.Skipped == 1 || counts.Replaced == 1) && !planned.MealID.IsZero() {
+				if missed[planned.MealID] == nil {
+					missed[planned.MealID] = &MissedMeal{MealID: planned.MealID, Name: planned.Name}
+				}
+				missed[planned.MealID].Times++
+			}
+			result.SlotAdherence.add(counts)
+			slotCounts := stats.Slots[slot]
+			slotCounts.add(counts)
+			stats.Slots[slot] = slotCounts
+		}
+
+		if len(dayEntries) > 0 {
+			stats.LoggedDays++
+			loggedCalories += result.Totals.Calories
+			if targets != nil {
+				within := WithinTargets(result.Totals, *targets, tolerance)
+				result.WithinTargets = &within
+				if within {
+					stats.DaysOnTarget++
+				}
+			}
+		}
+		stats.SlotAdherence.add(result.SlotAdherence)
+		stats.OffPlan += result.OffPlan
+		stats.Days = append(stats.Days, result)
+	}
+
+	stats.Rate = stats.SlotAdherence.Rate()
+	if stats.LoggedDays > 0 {
+		stats.AverageCalories = loggedCalories / stats.LoggedDays
+	}
+	for _, meal := range missed {
+		stats.MissedMeals = append(stats.MissedMeals, *meal)
+	}
+	sort.Slice(stats.MissedMeals, func(i, j int) bool {
+		if stats.MissedMeals[i].Times != stats.MissedMeals[j].Times {
+			return stats.MissedMeals[i].Times > stats.MissedMeals[j].Times
+		}
+		return stats.MissedMeals[i].Name < stats.MissedMeals[j].Name
+	})
+	return stats
+}
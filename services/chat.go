@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"figorate/models"
+)
+
+// chatHistoryLimit caps how many previous messages are sent back to the model
+const chatHistoryLimit = 20
+
+// ChatPlanDay is one day of the user's plan as shown to the assistant. Day is
+// the day of the month.
+type ChatPlanDay struct {
+	Day     int
+	Date    string
+	Weekday string
+	Meals   models.DailyMeals
+	Slots   []ChatPlanSlot // Meals in the user's slot order
+}
+
+// ChatPlanSlot is one meal of a ChatPlanDay
+type ChatPlanSlot struct {
+	Name string
+	Meal models.PlannedMeal
+}
+
+// ChatPromptData grounds the assistant on the user's profile, plan and catalogue
+type ChatPromptData struct {
+	Today    string
+	User     models.User
+	PlanDays []ChatPlanDay
+	Meals    []models.Meal
+}
+
+// ChatReply is the assistant's answer, with a proposed action when it called a tool
+type ChatReply struct {
+	Content       string
+	Action        *models.ChatAction
+	Model         string
+	PromptVersion string
+	Usage         models.TokenUsage
+}
+
+// swapMealTool lets the assistant propose a swap in one of the user's slots
+func swapMealTool(slots []models.MealSlot) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "swap_meal",
+			"description": "Propose replacing the meal in one slot of the user's plan. The user must confirm before it is applied.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"date": map[string]interface{}{"type": "string", "description": "Date of the planned day, YYYY-MM-DD"},
+					"slot": map[string]interface{}{"type": "string", "enum": models.SlotNames(slots)},
+					"meal": map[string]interface{}{"type": "string", "description": "Exact name of a meal from the catalogue"},
+				},
+				"required": []string{"date", "slot", "meal"},
+			},
+		},
+	}
+}
+
+// Chat continues a conversation with the nutrition assistant
+func (s *AIService) Chat(ctx context.Context, data ChatPromptData, history []models.ChatMessage) (*ChatReply, error) {
+	prompt, err := s.prompts.Render(ctx, PromptChatAssistant, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render prompt: %v", err)
+	}
+
+	if len(history) > chatHistoryLimit {
+		history = history[len(history)-chatHistoryLimit:]
+	}
+
+	messages := []map[string]string{{"role": "system", "content": prompt.System}}
+	for _, message := range history {
+		messages = append(messages, map[string]string{"role": message.Role, "content": message.Content})
+	}
+
+	reqBody := map[string]interface{}{
+		"model":       s.model,
+		"messages":    messages,
+		"tools":       []interface{}{swapMealTool(data.User.Slots())},
+		"temperature": 0.4,
+	}
+
+	aiResp, err := s.complete(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &ChatReply{
+		Content:       aiResp.Choices[0].Message.Content,
+		Model:         s.respondedModel(aiResp),
+		PromptVersion: prompt.Version,
+		Usage:         aiResp.Usage,
+	}
+
+	for _, call := range aiResp.Choices[0].Message.ToolCalls {
+		if call.Function.Name != "swap_meal" {
+			continue
+		}
+
+		var args struct {
+			Date string `json:"date"`
+			Slot string `json:"slot"`
+			Meal string `json:"meal"`
+		}
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return nil, fmt.Errorf("failed to parse tool arguments: %v", err)
+		}
+
+		reply.Action = &models.ChatAction{
+			Type:      "swap_meal",
+			Date:      args.Date,
+			Slot:      args.Slot,
+			ToMeal:    args.Meal,
+			CreatedAt: time.Now(),
+		}
+		break
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultConditionRules are the built-in rules per medical condition. Limits
+// follow common dietary guidance for adults and can be replaced by admins.
+func DefaultConditionRules() map[string]models.ConditionRule {
+	return map[string]models.ConditionRule{
+		"hypertension": {
+			Condition:   "hypertension",
+			Description: "Limit sodium to lower blood pressure",
+			Limits: []models.NutrientLimit{
+				{Nutrient: "sodium", MaxPerMeal: 600, MaxPerDay: 1500},
+			},
+			PreferTags: []string{"low_sodium"},
+		},
+		"diabetes": {
+			Condition:   "diabetes",
+			Description: "Limit sugar and spread carbohydrates evenly across meals",
+			Limits: []models.NutrientLimit{
+				{Nutrient: "sugar", MaxPerMeal: 15, MaxPerDay: 25},
+				{Nutrient: "carbohydrates", MaxPerMeal: 60},
+				{Nutrient: "fiber", MinPerDay: 25},
+			},
+			PreferTags: []string{"high_fiber", "low_carb"},
+		},
+		"kidney_disease": {
+			Condition:   "kidney_disease",
+			Description: "Limit sodium, potassium and phosphorus",
+			Limits: []models.NutrientLimit{
+				{Nutrient: "sodium", MaxPerDay: 2000},
+				{Nutrient: "potassium_mg", MaxPerDay: 2000},
+				{Nutrient: "phosphorus_mg", MaxPerDay: 800},
+			},
+			PreferTags: []string{"low_sodium"},
+		},
+		"high_cholesterol": {
+			Condition:   "high_cholesterol",
+			Description: "Limit saturated fat and dietary cholesterol",
+			Limits: []models.NutrientLimit{
+				{Nutrient: "saturated_fat_g", MaxPerDay: 13},
+				{Nutrient: "cholesterol_mg", MaxPerDay: 200},
+				{Nutrient: "fiber", MinPerDay: 25},
+			},
+			PreferTags: []string{"high_fiber", "low_fat"},
+		},
+		"cardiovascular_disease": {
+			Condition:   "cardiovascular_disease",
+			Description: "Limit sodium and saturated fat",
+			Limits: []models.NutrientLimit{
+				{Nutrient: "sodium", MaxPerMeal: 600, MaxPerDay: 1500},
+				{Nutrient: "saturated_fat_g", MaxPerDay: 13},
+			},
+			PreferTags: []string{"low_sodium", "low_fat"},
+		},
+	}
+}
+
+// ConditionRuleService resolves the rule for each condition, letting a
+// document in the condition_rules collection replace the built-in default
+type ConditionRuleService struct {
+	collection *mongo.Collection
+}
+
+func NewConditionRuleService(collection *mongo.Collection) *ConditionRuleService {
+	return &ConditionRuleService{collection: collection}
+}
+
+// Rules returns the effective rule for every condition that has one
+func (s *ConditionRuleService) Rules(ctx context.Context) (map[string]models.ConditionRule, error) {
+	rules := DefaultConditionRules()
+	for condition, rule := range rules {
+		rule.Source = "default"
+		rules[condition] = rule
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch condition rules: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var overrides []models.ConditionRule
+	if err := cursor.All(ctx, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to decode condition rules: %v", err)
+	}
+	for _, rule := range overrides {
+		rule.Source = "database"
+		rules[rule.Condition] = rule
+	}
+	return rules, nil
+}
+
+// ForConditions returns the rules that apply to a user's conditions, ordered by condition
+func (s *ConditionRuleService) ForConditions(ctx context.Context, conditions []string) ([]models.ConditionRule, error) {
+	rules, err := s.Rules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return RulesFor(rules, conditions), nil
+}
+
+// Save replaces the rule for a condition
+func (s *ConditionRuleService) Save(ctx context.Context, rule models.ConditionRule) error {
+	rule.UpdatedAt = time.Now()
+	_, err := s.collection.ReplaceOne(ctx,
+		bson.M{"condition": rule.Condition},
+		rule,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save condition rule: %v", err)
+	}
+	return nil
+}
+
+// Reset drops the override for a condition so the default applies again
+func (s *ConditionRuleService) Reset(ctx context.Context, condition string) (bool, error) {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"condition": condition})
+	if err != nil {
+		return false, fmt.Errorf("failed to reset condition rule: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// RulesFor picks the rules matching conditions, ordered by condition
+func RulesFor(rules map[string]models.ConditionRule, conditions []string) []models.ConditionRule {
+	var matched []models.ConditionRule
+	for _, condition := range uniqueSorted(conditions) {
+		if rule, ok := rules[condition]; ok {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// nutrientAmount reads a nutrient from a meal's or day's totals
+func nutrientAmount(totals models.NutritionTotals, nutrient string) float64 {
+	switch nutrient {
+	case "calories":
+		return float64(totals.Calories)
+	case "protein":
+		return totals.Protein
+	case "carbohydrates":
+		return totals.Carbohydrates
+	case "fat":
+		return totals.Fat
+	case "fiber":
+		return totals.Fiber
+	case "sugar":
+		return totals.Sugar
+	case "sodium":
+		return totals.Sodium
+	}
+	return totals.Micronutrients[nutrient]
+}
+
+// nutrientUnit is the unit a nutrient is measured in, for messages
+func nutrientUnit(nutrient string) string {
+	switch nutrient {
+	case "calories":
+		return "kcal"
+	case "sodium":
+		return "mg"
+	case "protein", "carbohydrates", "fat", "fiber", "sugar":
+		return "g"
+	}
+	return nutrient[strings.LastIndex(nutrient, "_")+1:]
+}
+
+func nutrientLabel(nutrient string) string {
+	for _, suffix := range []string{"_mg", "_mcg", "_g"} {
+		nutrient = strings.TrimSuffix(nutrient, suffix)
+	}
+	return strings.ReplaceAll(nutrient, "_", " ")
+}
+
+// MealWarnings checks one meal against per-meal limits and avoided tags
+func MealWarnings(meal models.Meal, rules []models.ConditionRule) []models.NutritionWarning {
+	totals := models.NutritionTotals{Calories: meal.Calories, Nutrition: meal.Nutrition}
+	warnings := []models.NutritionWarning{}
+	for _, rule := range rules {
+		for _, limit := range rule.Limits {
+			actual := nutrientAmount(totals, limit.Nutrient)
+			if limit.MaxPerMeal > 0 && actual > limit.MaxPerMeal {
+				warnings = append(warnings, models.NutritionWarning{
+					Condition: rule.Condition,
+					Nutrient:  limit.Nutrient,
+					Scope:     "meal",
+					Limit:     limit.MaxPerMeal,
+					Actual:    actual,
+					Message: fmt.Sprintf("%s has %.0f%s %s, above the %.0f%s per meal advised for %s",
+						meal.Name, actual, nutrientUnit(limit.Nutrient), nutrientLabel(limit.Nutrient),
+						limit.MaxPerMeal, nutrientUnit(limit.Nutrient), conditionLabel(rule.Condition)),
+				})
+			}
+		}
+		for _, tag := range rule.AvoidTags {
+			if hasAnyTag(meal, []string{tag}) {
+				warnings = append(warnings, models.NutritionWarning{
+					Condition: rule.Condition,
+					Scope:     "meal",
+					Message:   fmt.Sprintf("%s is %s, which is best avoided with %s", meal.Name, tag, conditionLabel(rule.Condition)),
+				})
+			}
+		}
+	}
+	return warnings
+}
+
+// DayWarnings checks one day's totals against daily limits
+func DayWarnings(date string, totals models.NutritionTotals, rules []models.ConditionRule) []models.NutritionWarning {
+	warnings := []models.NutritionWarning{}
+	for _, rule := range rules {
+		for _, limit := range rule.Limits {
+			actual := nutrientAmount(totals, limit.Nutrient)
+			unit, label := nutrientUnit(limit.Nutrient), nutrientLabel(limit.Nutrient)
+			warning := models.NutritionWarning{Condition: rule.Condition, Nutrient: limit.Nutrient, Scope: "day", Date: date, Actual: actual}
+			switch {
+			case limit.MaxPerDay > 0 && actual > limit.MaxPerDay:
+				warning.Limit = limit.MaxPerDay
+				warning.Message = fmt.Sprintf("%s has %.0f%s %s, above the %.0f%s daily limit for %s",
+					date, actual, unit, label, limit.MaxPerDay, unit, conditionLabel(rule.Condition))
+			case limit.MinPerDay > 0 && actual < limit.MinPerDay:
+				warning.Limit = limit.MinPerDay
+				warning.Message = fmt.Sprintf("%s has %.0f%s %s, below the %.0f%s daily target for %s",
+					date, actual, unit, label, limit.MinPerDay, unit, conditionLabel(rule.Condition))
+			default:
+				continue
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// PlanWarnings checks every date of a plan, in date order
+func PlanWarnings(days map[string]models.DailyMeals, mealsByID map[primitive.ObjectID]models.Meal, rules []models.ConditionRule) []models.NutritionWarning {
+	if len(rules) == 0 {
+		return nil
+	}
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	var warnings []models.NutritionWarning
+	for _, date := range dates {
+		warnings = append(warnings, DayWarnings(date, DailyTotals(days[date], mealsByID), rules)...)
+	}
+	return warnings
+}
+
+// FilterMealsForConditions drops meals that break a per-meal limit or carry an
+// avoided tag. Categories the rules would empty keep their meals so every slot
+// can still be filled; those meals then surface as warnings instead.
+func FilterMealsForConditions(meals []models.Meal, rules []models.ConditionRule) []models.Meal {
+	if len(rules) == 0 {
+		return meals
+	}
+
+	kept := make(map[string][]models.Meal)
+	all := make(map[string][]models.Meal)
+	var categories []string
+	for _, meal := range meals {
+		if _, seen := all[meal.Category]; !seen {
+			categories = append(categories, meal.Category)
+		}
+		all[meal.Category] = append(all[meal.Category], meal)
+		if len(MealWarnings(meal, rules)) == 0 {
+			kept[meal.Category] = append(kept[meal.Category], meal)
+		}
+	}
+
+	filtered := make([]models.Meal, 0, len(meals))
+	for _, category := range categories {
+		if len(kept[category]) > 0 {
+			filtered = append(filtered, kept[category]...)
+		} else {
+			filtered = append(filtered, all[category]...)
+		}
+	}
+	return filtered
+}
+
+// ConditionConstraints phrases the daily limits and preferences of rules as
+// planning constraints for the meal plan prompt
+func ConditionConstraints(rules []models.ConditionRule) []string {
+	var constraints []string
+	for _, rule := range rules {
+		var parts []string
+		for _, limit := range rule.Limits {
+			unit, label := nutrientUnit(limit.Nutrient), nutrientLabel(limit.Nutrient)
+			if limit.MaxPerMeal > 0 {
+				parts = append(parts, fmt.Sprintf("at most %.0f%s %s per meal", limit.MaxPerMeal, unit, label))
+			}
+			if limit.MaxPerDay > 0 {
+				parts = append(parts, fmt.Sprintf("at most %.0f%s %s per day", limit.MaxPerDay, unit, label))
+			}
+			if limit.MinPerDay > 0 {
+				parts = append(parts, fmt.Sprintf("at least %.0f%s %s per day", limit.MinPerDay, unit, label))
+			}
+		}
+		if len(rule.PreferTags) > 0 {
+			parts = append(parts, "prefer meals tagged "+strings.Join(rule.PreferTags, " or "))
+		}
+		if len(rule.AvoidTags) > 0 {
+			parts = append(parts, "avoid meals tagged "+strings.Join(rule.AvoidTags, " or "))
+		}
+		if len(parts) > 0 {
+			constraints = append(constraints, fmt.Sprintf("For %s: %s", conditionLabel(rule.Condition), strings.Join(parts, "; ")))
+		}
+	}
+	return constraints
+}
+
+func conditionLabel(condition string) string {
+	return strings.ReplaceAll(condition, "_", " ")
+}
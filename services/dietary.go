@@ -0,0 +1,123 @@
+package services
+
+import (
+	"sort"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DietaryProfile is what a user must never be served: meals containing their
+// allergens, and meals that don't satisfy each of their dietary restrictions
+type DietaryProfile struct {
+	Allergens    []string
+	Restrictions []string
+}
+
+// UserDietaryProfile reads a user's allergens and restrictions. The legacy
+// single nutrition preference counts as a restriction.
+func UserDietaryProfile(user models.User) DietaryProfile {
+	restrictions := append([]string(nil), user.DietaryRestrictions...)
+	if user.NutritionPreference != "" && user.NutritionPreference != "none" {
+		restrictions = append(restrictions, user.NutritionPreference)
+	}
+	return DietaryProfile{
+		Allergens:    uniqueSorted(user.Allergens),
+		Restrictions: uniqueSorted(restrictions),
+	}
+}
+
+// ExcludedAllergens returns the declared allergens plus those implied by restrictions
+func (p DietaryProfile) ExcludedAllergens() []string {
+	excluded := append([]string(nil), p.Allergens...)
+	for _, name := range p.Restrictions {
+		excluded = append(excluded, models.DietaryRestrictions[name].ExcludesAllergens...)
+	}
+	return uniqueSorted(excluded)
+}
+
+// Conditions returns the query conditions a meal must meet for this profile
+func (p DietaryProfile) Conditions() []bson.M {
+	var conditions []bson.M
+	if excluded := p.ExcludedAllergens(); len(excluded) > 0 {
+		conditions = append(conditions, bson.M{"allergens": bson.M{"$nin": excluded}})
+	}
+	for _, name := range p.Restrictions {
+		restriction, ok := models.DietaryRestrictions[name]
+		if !ok {
+			continue
+		}
+		conditions = append(conditions, bson.M{"tags": bson.M{"$in": restriction.SatisfiedBy}})
+	}
+	return conditions
+}
+
+// Apply adds the profile's conditions to a meal filter
+func (p DietaryProfile) Apply(filter bson.M) bson.M {
+	conditions := p.Conditions()
+	if len(conditions) == 0 {
+		return filter
+	}
+	if existing, ok := filter["$and"].([]bson.M); ok {
+		conditions = append(existing, conditions...)
+	}
+	filter["$and"] = conditions
+	return filter
+}
+
+// Allows reports whether a meal is safe for the profile, and why not when it isn't
+func (p DietaryProfile) Allows(meal models.Meal) (bool, string) {
+	for _, allergen := range p.ExcludedAllergens() {
+		for _, contained := range meal.Allergens {
+			if contained == allergen {
+				return false, "contains " + allergen
+			}
+		}
+	}
+	for _, name := range p.Restrictions {
+		restriction, ok := models.DietaryRestrictions[name]
+		if !ok {
+			continue
+		}
+		if !hasAnyTag(meal, restriction.SatisfiedBy) {
+			return false, "not " + name
+		}
+	}
+	return true, ""
+}
+
+// FilterMeals keeps the meals the profile allows
+func (p DietaryProfile) FilterMeals(meals []models.Meal) []models.Meal {
+	allowed := make([]models.Meal, 0, len(meals))
+	for _, meal := range meals {
+		if ok, _ := p.Allows(meal); ok {
+			allowed = append(allowed, meal)
+		}
+	}
+	return allowed
+}
+
+func hasAnyTag(meal models.Meal, tags []string) bool {
+	for _, tag := range meal.Tags {
+		for _, wanted := range tags {
+			if tag == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PlannedFoodStatuses are the statuses that answer for a planned slot
+var PlannedFoodStatuses = []string{models.FoodEaten, models.FoodSkipped, models.FoodReplaced}
+
+// FoodLogStore reads and writes the users' food diaries
+type FoodLogStore struct {
+	collection *mongo.Collection
+}
+
+func NewFoodLogStore(collection *mongo.Collection) *FoodLogStore {
+	return &FoodLogStore{collection: collection}
+}
+
+// EnsureIndexes creates the index diary and adherence lookups use, and the
+// unique one that keeps a planned slot to one entry. The partial filter needs
+// MongoDB 6.0 or later for $in.
+func (s *FoodLogStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: 1}, {Key: "slot", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: 1}, {Key: "slot", Value: 1}},
+			Options: options.Index().
+				SetName("planned_slot_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": bson.M{"$in": PlannedFoodStatuses}}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create food log indexes: %v", err)
+	}
+	return nil
+}
+
+// Between returns the user's entries from start to end inclusive, in the order
+// they were logged
+func (s *FoodLogStore) Between(ctx context.Context, userID primitive.ObjectID, start, end string) ([]models.FoodLogEntry, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"user_id": userID,
+		"date":    bson.M{"$gte": start, "$lte": end},
+	}, options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load food log: %v", err)
+	}
+	entries := []models.FoodLogEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to load food log: %v", err)
+	}
+	return entries, nil
+}
+
+// SlotEntry returns what was logged for a planned slot, or nil if nothing was
+func (s *FoodLogStore) SlotEntry(ctx context.Context, userID primitive.ObjectID, date, slot string) (*models.FoodLogEntry, error) {
+	var entry models.FoodLogEntry
+	err := s.collection.FindOne(ctx, bson.M{
+		"user_id": userID,
+		"date":    date,
+		"slot":    slot,
+		"status":  bson.M{"$in": PlannedFoodStatuses},
+	}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load food log: %v", err)
+	}
+	return &entry, nil
+}
+
+// SetSlot records what happened to a planned slot, replacing whatever was
+// logged for it before. entry is updated to the stored document.
+func (s *FoodLogStore) SetSlot(ctx context.Context, entry *models.FoodLogEntry) error {
+	filter := bson.M{
+		"user_id": entry.UserID,
+		"date":    entry.Date,
+		"slot":    entry.Slot,
+		"status":  bson.M{"$in": PlannedFoodStatuses},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      entry.Status,
+			"planned":     entry.Planned,
+			"meal_id":     entry.MealID,
+			"name":        entry.Name,
+			"portion":     entry.Portion,
+			"calories":    entry.Calories,
+			"nutrition":   entry.Nutrition,
+			"cooked":      entry.Cooked,
+			"pantry_used": entry.PantryUsed,
+			"updated_at":  entry.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{"created_at": entry.UpdatedAt},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(entry)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent log of the slot inserted first; update that entry instead
+		err = s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(entry)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to log slot: %v", err)
+	}
+	return nil
+}
+
+// ClearSlot removes what was logged for a planned slot, reporting whether
+// there was anything to remove
+func (s *FoodLogStore) ClearSlot(ctx context.Context, userID primitive.ObjectID, date, slot string) (bool, error) {
+	result, err := s.collection.DeleteOne(ctx, bson.M{
+		"user_id": userID,
+		"date":    date,
+		"slot":    slot,
+		"status":  bson.M{"$in": PlannedFoodStatuses},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to clear slot: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// Add logs food eaten off plan
+func (s *FoodLogStore) Add(ctx context.Context, entry *models.FoodLogEntry) error {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = entry.UpdatedAt
+	if _, err := s.collection.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to log food: %v", err)
+	}
+	return nil
+}
+
+// Delete removes one of the user's entries, reporting whether it existed
+func (s *FoodLogStore) Delete(ctx context.Context, userID, entryID primitive.ObjectID) (bool, error) {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": entryID, "user_id": userID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete food log entry: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// SetFood fills in what an entry says was eaten: meal scaled by the portion
+// when there is one, otherwise the named food of the request
+func SetFood(entry *models.FoodLogEntry, meal *models.Meal, request models.FoodRequest, now time.Time) {
+	entry.Portion = request.Portion
+	if entry.Portion == 0 {
+		entry.Portion = 1
+	}
+	entry.Nutrition = models.Nutrition{}
+	if meal != nil {
+		entry.MealID = meal.ID
+		entry.Name = meal.Name
+		entry.Calories = int(float64(meal.Calories)*entry.Portion + 0.5)
+		entry.Nutrition.Add(meal.Nutrition, entry.Portion)
+	} else {
+		entry.Name = request.Name
+		entry.Calories = int(float64(request.Calories)*entry.Portion + 0.5)
+		if request.Nutrition != nil {
+			entry.Nutrition.Add(*request.Nutrition, entry.Portion)
+		}
+	}
+	entry.UpdatedAt = now
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // decoder only; animations keep their first frame
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"figorate/models"
+	"figorate/storage"
+)
+
+// DefaultImageMaxBytes caps an upload when IMAGE_MAX_BYTES is not set
+const DefaultImageMaxBytes = 5 << 20
+
+// Decoding is refused above this many pixels, so a small file cannot expand
+// into gigabytes of memory
+const maxImagePixels = 40_000_000
+
+// imageVariant is a standard size every upload is resized to
+type imageVariant struct {
+	name string
+	size int  // longest side, or the side of the square for cropped variants
+	crop bool // centre crop to a square
+}
+
+var imageVariants = []imageVariant{
+	{name: "full", size: 2048},
+	{name: "medium", size: 640},
+	{name: "small", size: 320},
+	{name: "thumbnail", size: 150, crop: true},
+}
+
+// InvalidImageError is returned for uploads that are not a usable image
+type InvalidImageError struct {
+	Reason string
+}
+
+func (e *InvalidImageError) Error() string {
+	return e.Reason
+}
+
+// ImageMaxBytes reads IMAGE_MAX_BYTES, the largest upload accepted
+func ImageMaxBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("IMAGE_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return DefaultImageMaxBytes
+}
+
+// ImageService validates uploaded images, resizes them and stores every variant
+type ImageService struct {
+	store storage.Storage
+}
+
+func NewImageService(store storage.Storage) *ImageService {
+	return &ImageService{store: store}
+}
+
+// Upload stores data as an ImageSet under prefix (e.g. meals/<id>). The
+// content type is sniffed rather than trusted, and every variant is re-encoded,
+// which also strips metadata such as GPS coordinates.
+func (s *ImageService) Upload(ctx context.Context, prefix string, data []byte) (*models.ImageSet, error) {
+	if int64(len(data)) > ImageMaxBytes() {
+		return nil, &InvalidImageError{Reason: fmt.Sprintf("image is larger than %d bytes", ImageMaxBytes())}
+	}
+
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, &InvalidImageError{Reason: fmt.Sprintf("unsupported image type %s, use JPEG, PNG or GIF", contentType)}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &InvalidImageError{Reason: "image could not be read"}
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, &InvalidImageError{Reason: fmt.Sprintf("image dimensions %dx%d are not supported", config.Width, config.Height)}
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &InvalidImageError{Reason: "image could not be decoded"}
+	}
+
+	// Work on premultiplied RGBA so transparent pixels don't bleed colour
+	src := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+
+	// PNG and GIF may be transparent, so they stay PNG; photos become JPEG
+	ext, outputType := "jpg", "image/jpeg"
+	if contentType != "image/jpeg" {
+		ext, outputType = "png", "image/png"
+	}
+
+	sum := sha256.Sum256(data)
+	base := prefix + "/" + hex.EncodeToString(sum[:12])
+
+	set := &models.ImageSet{}
+	for _, variant := range imageVariants {
+		resized := resizeImage(src, variant.size, variant.crop)
+
+		var encoded bytes.Buffer
+		if outputType == "image/png" {
+			err = png.Encode(&encoded, resized)
+		} else {
+			err = jpeg.Encode(&encoded, resized, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s image: %v", variant.name, err)
+		}
+
+		key := base + "/" + variant.name + "." + ext
+		url, err := s.store.Put(ctx, key, outputType, encoded.Bytes())
+		if err != nil {
+			// Don't leave the variants already written behind
+			s.Delete(ctx, &models.ImageSet{Keys: set.Keys})
+			return nil, fmt.Errorf("failed to store image: %v", err)
+		}
+		set.Keys = append(set.Keys, key)
+
+		switch variant.name {
+		case "full":
+			set.Full = url
+			set.Width, set.Height = resized.Bounds().Dx(), resized.Bounds().Dy()
+		case "medium":
+			set.Medium = url
+		case "small":
+			set.Small = url
+		case "thumbnail":
+			set.Thumbnail = url
+		}
+	}
+	return set, nil
+}
+
+// Replace removes the files of a previous image that the new one doesn't reuse
+func (s *ImageService) Replace(ctx context.Context, previous, current *models.ImageSet) {
+	if previous == nil {
+		return
+	}
+	kept := make(map[string]bool)
+	if current != nil {
+		for _, key := range current.Keys {
+			kept[key] = true
+		}
+	}
+	var stale []string
+	for _, key := range previous.Keys {
+		if !kept[key] {
+			stale = append(stale, key)
+		}
+	}
+	s.Delete(ctx, &models.ImageSet{Keys: stale})
+}
+
+// Delete removes an image's files, logging failures since an orphaned file is harmless
+func (s *ImageService) Delete(ctx context.Context, set *models.ImageSet) {
+	if set == nil {
+		return
+	}
+	for _, key := range set.Keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete image %s: %v", key, err)
+		}
+	}
+}
+
+// resizeImage scales src down to fit size (never up), or centre crops it to a
+// size x size square. Each output pixel averages the source pixels it covers,
+// which keeps downscaled photos smooth.
+func resizeImage(src *image.RGBA, size int, crop bool) *image.RGBA {
+	bounds := src.Bounds()
+	if crop {
+		side := min(bounds.Dx(), bounds.Dy())
+		x0 := (bounds.Dx() - side) / 2
+		y0 := (bounds.Dy() - side) / 2
+		bounds = image.Rect(x0, y0, x0+side, y0+side)
+	}
+
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	width, height := srcW, srcH
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, srcH*size/srcW)
+		} else {
+			width, height = max(1, srcW*size/srcH), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy0 := bounds.Min.Y + y*srcH/height
+		sy1 := max(bounds.Min.Y+(y+1)*srcH/height, sy0+1)
+		for x := 0; x < width; x++ {
+			sx0 := bounds.Min.X + x*srcW/width
+			sx1 := max(bounds.Min.X+(x+1)*srcW/width, sx0+1)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			o := dst.Pix[y*dst.Stride+x*4:]
+			o[0], o[1], o[2], o[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MealPlanStore reads and writes meal plans by calendar date. Saving a plan
+// takes its dates over from the user's older plans, so any date belongs to at
+// most one plan. Every write records an immutable MealPlanVersion, so any
+// earlier state of a plan can be compared against or restored.
+type MealPlanStore struct {
+	collection *mongo.Collection
+	versions   *mongo.Collection
+}
+
+// ErrPlanConflict is returned when a plan changed between being read and
+// written, so the write was not applied
+var ErrPlanConflict = errors.New("meal plan was changed by another request")
+
+func NewMealPlanStore(collection, versions *mongo.Collection) *MealPlanStore {
+	return &MealPlanStore{collection: collection, versions: versions}
+}
+
+// EnsureIndexes creates the index range lookups use and the one that keeps
+// version numbers unique per plan
+func (s *MealPlanStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "start_date", Value: 1}, {Key: "end_date", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create meal plan indexes: %v", err)
+	}
+	_, err = s.versions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "plan_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create meal plan version indexes: %v", err)
+	}
+	return nil
+}
+
+// ForDate returns the user's plan that has a day on date, or nil if none does
+func (s *MealPlanStore) ForDate(ctx context.Context, userID primitive.ObjectID, date string) (*models.MealPlan, error) {
+	var plan models.MealPlan
+	err := s.collection.FindOne(ctx, bson.M{
+		"user_id":      userID,
+		"start_date":   bson.M{"$lte": date},
+		"end_date":     bson.M{"$gte": date},
+		"days." + date: bson.M{"$exists": true},
+	}).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meal plan: %v", err)
+	}
+	return &plan, nil
+}
+
+// Between returns the user's plans whose range overlaps start to end
+// inclusive, ordered by start date
+func (s *MealPlanStore) Between(ctx context.Context, userID primitive.ObjectID, start, end string) ([]models.MealPlan, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"user_id":    userID,
+		"start_date": bson.M{"$lte": end},
+		"end_date":   bson.M{"$gte": start},
+	}, options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meal plans: %v", err)
+	}
+	plans := []models.MealPlan{}
+	if err := cursor.All(ctx, &plans); err != nil {
+		return nil, fmt.Errorf("failed to load meal plans: %v", err)
+	}
+	return plans, nil
+}
+
+// Save inserts a new plan as its version 1, then takes its dates over from
+// the user's older plans. Should that fail, the older plans get their dates
+// back and the new plan is removed, so a failed save changes nothing.
+func (s *MealPlanStore) Save(ctx context.Context, plan *models.MealPlan, reason, source string) error {
+	overlapping, err := s.overlapping(ctx, *plan)
+	if err != nil {
+		return err
+	}
+
+	plan.ID = primitive.NewObjectID()
+	plan.Version = 1
+	version := models.NewMealPlanVersion(*plan, reason, source, plan.UpdatedAt)
+	version.ReplacedPlanIDs = planIDs(overlapping)
+	if err := s.recordVersion(ctx, version); err != nil {
+		return err
+	}
+	if _, err := s.collection.InsertOne(ctx, plan); err != nil {
+		s.dropVersion(ctx, plan.ID, plan.Version)
+		return fmt.Errorf("failed to save meal plan: %v", err)
+	}
+
+	if replaced, err := s.takeDates(ctx, *plan, overlapping, source); err != nil {
+		s.restore(ctx, replaced, "Restored after plan "+plan.ID.Hex()+" failed to save", source, plan.UpdatedAt)
+		if _, deleteErr := s.collection.DeleteOne(ctx, bson.M{"_id": plan.ID}); deleteErr != nil {
+			log.Printf("Failed to remove meal plan %s after a failed save: %v", plan.ID.Hex(), deleteErr)
+		}
+		s.dropVersion(ctx, plan.ID, plan.Version)
+		return err
+	}
+	return nil
+}
+
+// Update writes back the days and targets of an existing plan as a new version
+func (s *MealPlanStore) Update(ctx context.Context, plan *models.MealPlan, reason, source string) error {
+	return s.change(ctx, plan, *plan, reason, source)
+}
+
+// SetDay replaces the meals of one date of a plan as a new version
+func (s *MealPlanStore) SetDay(ctx context.Context, plan *models.MealPlan, date string, dailyMeals models.DailyMeals, now time.Time, reason, source string) error {
+	return s.SetDays(ctx, plan, map[string]models.DailyMeals{date: dailyMeals}, now, reason, source)
+}
+
+// SetDays replaces the meals of several dates of a plan as one new version
+func (s *MealPlanStore) SetDays(ctx context.Context, plan *models.MealPlan, days map[string]models.DailyMeals, now time.Time, reason, source string) error {
+	next := *plan
+	next.Days = make(map[string]models.DailyMeals, len(plan.Days)+len(days))
+	for date, dailyMeals := range plan.Days {
+		next.Days[date] = dailyMeals
+	}
+	for date, dailyMeals := range days {
+		next.Days[date] = dailyMeals
+	}
+	next.UpdatedAt = now
+	return s.change(ctx, plan, next, reason, source)
+}
+
+// SetDaysOfPlans replaces dates across several plans, each as one new
+// version, in the order of planIDs. If a plan fails to update, the plans
+// already updated get their previous days back as a further version, so the
+// change lands on every plan or on none.
+func (s *MealPlanStore) SetDaysOfPlans(ctx context.Context, planIDs []primitive.ObjectID, plans map[primitive.ObjectID]*models.MealPlan, days map[primitive.ObjectID]map[string]models.DailyMeals, now time.Time, reason, source string) error {
+	type applied struct {
+		plan     *models.MealPlan
+		previous map[string]models.DailyMeals
+	}
+	var done []applied
+	for _, planID := range planIDs {
+		plan := plans[planID]
+		previous := make(map[string]models.DailyMeals, len(days[planID]))
+		for date := range days[planID] {
+			previous[date] = plan.Days[date]
+		}
+		if err := s.SetDays(ctx, plan, days[planID], now, reason, source); err != nil {
+			for _, change := range done {
+				if revertErr := s.SetDays(ctx, change.plan, change.previous, now, "Reverted: "+reason, source); revertErr != nil {
+					log.Printf("Failed to revert meal plan %s: %v", change.plan.ID.Hex(), revertErr)
+				}
+			}
+			return err
+		}
+		done = append(done, applied{plan: plan, previous: previous})
+	}
+	return nil
+}
+
+// change writes next over plan as its next version. The version is recorded
+// first and the plan only updated if it is still the version it was read at,
+// so a lost race or failed write leaves no version without its plan and no
+// plan without its version. Either way plan is left as stored.
+func (s *MealPlanStore) change(ctx context.Context, plan *models.MealPlan, next models.MealPlan, reason, source string) error {
+	next.Version = plan.Version + 1
+	if err := s.recordVersion(ctx, models.NewMealPlanVersion(next, reason, source, next.UpdatedAt)); err != nil {
+		return err
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": plan.ID, "version": plan.Version}, bson.M{"$set": bson.M{
+		"days":       next.Days,
+		"start_date": next.StartDate,
+		"end_date":   next.EndDate,
+		"targets":    next.Targets,
+		"updated_at": next.UpdatedAt,
+		"version":    next.Version,
+	}})
+	if err != nil {
+		s.dropVersion(ctx, plan.ID, next.Version)
+		return fmt.Errorf("failed to update meal plan: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		s.dropVersion(ctx, plan.ID, next.Version)
+		return ErrPlanConflict
+	}
+	*plan = next
+	return nil
+}
+
+// Versions lists a plan's versions, newest first, without their days
+func (s *MealPlanStore) Versions(ctx context.Context, planID primitive.ObjectID) ([]models.MealPlanVersion, error) {
+	cursor, err := s.versions.Find(ctx, bson.M{"plan_id": planID}, options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetProjection(bson.M{"days": 0}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meal plan versions: %v", err)
+	}
+	versions := []models.MealPlanVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("failed to load meal plan versions: %v", err)
+	}
+	return versions, nil
+}
+
+// Version returns one version of a plan, or nil if there is no such version
+func (s *MealPlanStore) Version(ctx context.Context, planID primitive.ObjectID, number int) (*models.MealPlanVersion, error) {
+	var version models.MealPlanVersion
+	err := s.versions.FindOne(ctx, bson.M{"plan_id": planID, "version": number}).Decode(&version)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meal plan version: %v", err)
+	}
+	return &version, nil
+}
+
+// LatestVersion returns the newest version of a plan, or nil if it has none
+func (s *MealPlanStore) LatestVersion(ctx context.Context, planID primitive.ObjectID) (*models.MealPlanVersion, error) {
+	var version models.MealPlanVersion
+	err := s.versions.FindOne(ctx, bson.M{"plan_id": planID},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&version)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load meal plan version: %v", err)
+	}
+	return &version, nil
+}
+
+// Rollback restores a plan to the days of an earlier version, recorded as a
+// new version. The restored dates are taken back from any newer plans, and a
+// plan that had been replaced entirely comes back.
+func (s *MealPlanStore) Rollback(ctx context.Context, target models.MealPlanVersion, reason string, now time.Time) (*models.MealPlan, error) {
+	latest, err := s.LatestVersion(ctx, target.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("meal plan %s has no versions", target.PlanID.Hex())
+	}
+
+	plan := models.MealPlan{
+		ID:            target.PlanID,
+		UserID:        target.UserID,
+		StartDate:     target.StartDate,
+		EndDate:       target.EndDate,
+		Days:          target.Days,
+		Version:       latest.Version + 1,
+		Model:         target.Model,
+		PromptVersion: target.PromptVersion,
+		Targets:       target.Targets,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	var existing models.MealPlan
+	err = s.collection.FindOne(ctx, bson.M{"_id": plan.ID}).Decode(&existing)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to load meal plan: %v", err)
+	}
+	found := err == nil
+	if found {
+		plan.CreatedAt = existing.CreatedAt
+	}
+
+	var overlapping []models.MealPlan
+	if len(plan.Days) > 0 {
+		if overlapping, err = s.overlapping(ctx, plan); err != nil {
+			return nil, err
+		}
+	}
+	version := models.NewMealPlanVersion(plan, reason, models.PlanSourceManual, now)
+	version.ReplacedPlanIDs = planIDs(overlapping)
+	if err := s.recordVersion(ctx, version); err != nil {
+		return nil, err
+	}
+
+	// Only the version the rollback was based on is replaced; a plan that is
+	// gone is inserted again
+	current := bson.M{"_id": plan.ID, "version": latest.Version}
+	var replaced []models.MealPlan
+	if len(plan.Days) > 0 {
+		replaced, err = s.takeDates(ctx, plan, overlapping, models.PlanSourceManual)
+		if err == nil {
+			_, err = s.collection.ReplaceOne(ctx, current, plan, options.Replace().SetUpsert(true))
+			if mongo.IsDuplicateKeyError(err) {
+				err = ErrPlanConflict
+			}
+		}
+	} else {
+		var result *mongo.DeleteResult
+		result, err = s.collection.DeleteOne(ctx, current)
+		if err == nil && found && result.DeletedCount == 0 {
+			err = ErrPlanConflict
+		}
+	}
+	if err != nil {
+		s.restore(ctx, replaced, "Restored after plan "+plan.ID.Hex()+" failed to roll back", models.PlanSourceManual, now)
+		s.dropVersion(ctx, plan.ID, plan.Version)
+		if err == ErrPlanConflict {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to restore meal plan: %v", err)
+	}
+	return &plan, nil
+}
+
+// overlapping returns the user's other plans that share a date with plan
+func (s *MealPlanStore) overlapping(ctx context.Context, plan models.MealPlan) ([]models.MealPlan, error) {
+	candidates, err := s.Between(ctx, plan.UserID, plan.StartDate, plan.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	var overlapping []models.MealPlan
+	for _, older := range candidates {
+		if older.ID == plan.ID {
+			continue
+		}
+		for date := range older.Days {
+			if _, taken := plan.Days[date]; taken {
+				overlapping = append(overlapping, older)
+				break
+			}
+		}
+	}
+	return overlapping, nil
+}
+
+// takeDates removes plan's dates from the overlapping plans, each as a new
+// version. Plans left without days are deleted after their final, empty
+// version. It returns the plans changed as they were before, which on error
+// are the ones changed so far, for restore.
+func (s *MealPlanStore) takeDates(ctx context.Context, plan models.MealPlan, overlapping []models.MealPlan, source string) ([]models.MealPlan, error) {
+	var replaced []models.MealPlan
+	for _, older := range overlapping {
+		remaining := make(map[string]models.DailyMeals, len(older.Days))
+		for date, dailyMeals := range older.Days {
+			if _, taken := plan.Days[date]; !taken {
+				remaining[date] = dailyMeals
+			}
+		}
+		reason := fmt.Sprintf("%d days taken over by plan %s", len(older.Days)-len(remaining), plan.ID.Hex())
+
+		next := older
+		next.Days = remaining
+		next.UpdatedAt = plan.UpdatedAt
+		if len(remaining) == 0 {
+			next.StartDate, next.EndDate = "", ""
+			next.Version = older.Version + 1
+			if err := s.recordVersion(ctx, models.NewMealPlanVersion(next, reason, source, plan.UpdatedAt)); err != nil {
+				return replaced, err
+			}
+			result, err := s.collection.DeleteOne(ctx, bson.M{"_id": older.ID, "version": older.Version})
+			if err == nil && result.DeletedCount == 0 {
+				err = ErrPlanConflict
+			}
+			if err != nil {
+				s.dropVersion(ctx, older.ID, next.Version)
+				if err == ErrPlanConflict {
+					return replaced, err
+				}
+				return replaced, fmt.Errorf("failed to delete replaced meal plan: %v", err)
+			}
+			replaced = append(replaced, older)
+			continue
+		}
+
+		next.StartDate, next.EndDate = dateBounds(remaining)
+		trimmed := older
+		if err := s.change(ctx, &trimmed, next, reason, source); err != nil {
+			if err == ErrPlanConflict {
+				return replaced, err
+			}
+			return replaced, fmt.Errorf("failed to trim replaced meal plan: %v", err)
+		}
+		replaced = append(replaced, older)
+	}
+	return replaced, nil
+}
+
+// restore puts back plans as takeDates found them, each as a new version.
+// It undoes a failed write, so errors are logged rather than returned.
+func (s *MealPlanStore) restore(ctx context.Context, originals []models.MealPlan, reason, source string, now time.Time) {
+	for _, original := range originals {
+		// takeDates left each plan, or its final version, one version on
+		restored := original
+		restored.Version = original.Version + 2
+		restored.UpdatedAt = now
+		if err := s.recordVersion(ctx, models.NewMealPlanVersion(restored, reason, source, now)); err != nil {
+			log.Printf("Failed to restore meal plan %s: %v", original.ID.Hex(), err)
+			continue
+		}
+		_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": original.ID, "version": original.Version + 1}, restored,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			s.dropVersion(ctx, original.ID, restored.Version)
+			log.Printf("Failed to restore meal plan %s: %v", original.ID.Hex(), err)
+		}
+	}
+}
+
+// recordVersion stores a version snapshot. Versions are never changed once
+// written, so a number already taken means another write got there first.
+func (s *MealPlanStore) recordVersion(ctx context.Context, version models.MealPlanVersion) error {
+	if _, err := s.versions.InsertOne(ctx, version); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrPlanConflict
+		}
+		return fmt.Errorf("failed to record meal plan version: %v", err)
+	}
+	return nil
+}
+
+// dropVersion removes a version recorded ahead of a plan write that then
+// failed, so the number is free for the next write
+func (s *MealPlanStore) dropVersion(ctx context.Context, planID primitive.ObjectID, number int) {
+	if _, err := s.versions.DeleteOne(ctx, bson.M{"plan_id": planID, "version": number}); err != nil {
+		log.Printf("Failed to remove meal plan %s version %d: %v", planID.Hex(), number, err)
+	}
+}
+
+// planIDs lists the IDs of plans
+func planIDs(plans []models.MealPlan) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, plan := range plans {
+		ids = append(ids, plan.ID)
+	}
+	return ids
+}
+
+// dateBounds returns the first and last of a set of dates
+func dateBounds(days map[string]models.DailyMeals) (string, string) {
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates[0], dates[len(dates)-1]
+}
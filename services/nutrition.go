@@ -0,0 +1,59 @@
+package services
+
+import (
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IndexMealsByID maps meal IDs to meals, as plans reference meals by ID
+func IndexMealsByID(meals []models.Meal) map[primitive.ObjectID]models.Meal {
+	mealsByID := make(map[primitive.ObjectID]models.Meal, len(meals))
+	for _, meal := range meals {
+		mealsByID[meal.ID] = meal
+	}
+	return mealsByID
+}
+
+// IndexMealsByName maps categories, then meal names within them, to meals,
+// for resolving the names an AI planner answers with. Names are only unique
+// within a category.
+func IndexMealsByName(meals []models.Meal) map[string]map[string]models.Meal {
+	mealsByName := make(map[string]map[string]models.Meal)
+	for _, meal := range meals {
+		if mealsByName[meal.Category] == nil {
+			mealsByName[meal.Category] = make(map[string]models.Meal)
+		}
+		mealsByName[meal.Category][meal.Name] = meal
+	}
+	return mealsByName
+}
+
+// DailyTotals sums calories and nutrients for the meals of one day. Slots
+// whose meal is not in mealsByID contribute nothing, apart from eating out,
+// which counts its estimated calories.
+func DailyTotals(dailyMeals models.DailyMeals, mealsByID map[primitive.ObjectID]models.Meal) models.NutritionTotals {
+	var totals models.NutritionTotals
+	for _, slot := range dailyMeals.SlotNames(nil) {
+		if dailyMeals[slot].Status == models.SlotEatingOut {
+			totals.Calories += dailyMeals[slot].Calories
+			continue
+		}
+		meal, exists := mealsByID[dailyMeals[slot].MealID]
+		if !exists {
+			continue
+		}
+		totals.Calories += meal.Calories
+		totals.Nutrition.Add(meal.Nutrition, 1)
+	}
+	return totals
+}
+
+// PlanTotals computes DailyTotals for every date of a plan
+func PlanTotals(days map[string]models.DailyMeals, mealsByID map[primitive.ObjectID]models.Meal) map[string]models.NutritionTotals {
+	totals := make(map[string]models.NutritionTotals, len(days))
+	for date, dailyMeals := range days {
+		totals[date] = DailyTotals(dailyMeals, mealsByID)
+	}
+	return totals
+}
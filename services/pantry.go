@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"figorate/helpers"
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExpiringSoonDays is how many days ahead a pantry item counts as expiring
+const ExpiringSoonDays = 3
+
+// PantryStore reads and writes what the users have at home
+type PantryStore struct {
+	collection *mongo.Collection
+}
+
+func NewPantryStore(collection *mongo.Collection) *PantryStore {
+	return &PantryStore{collection: collection}
+}
+
+// EnsureIndexes creates the index pantry lookups use
+func (s *PantryStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "ingredient_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create pantry indexes: %v", err)
+	}
+	return nil
+}
+
+// Items returns everything in the user's pantry, soonest to expire first
+func (s *PantryStore) Items(ctx context.Context, userID primitive.ObjectID) ([]models.PantryItem, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pantry: %v", err)
+	}
+	items := []models.PantryItem{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to load pantry: %v", err)
+	}
+	sortPantryItems(items)
+	return items, nil
+}
+
+// Get returns one of the user's pantry items, or nil if they have no such item
+func (s *PantryStore) Get(ctx context.Context, userID, itemID primitive.ObjectID) (*models.PantryItem, error) {
+	var item models.PantryItem
+	err := s.collection.FindOne(ctx, bson.M{"_id": itemID, "user_id": userID}).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pantry item: %v", err)
+	}
+	return &item, nil
+}
+
+// Add puts an item in the pantry
+func (s *PantryStore) Add(ctx context.Context, item *models.PantryItem) error {
+	item.ID = primitive.NewObjectID()
+	if _, err := s.collection.InsertOne(ctx, item); err != nil {
+		return fmt.Errorf("failed to add pantry item: %v", err)
+	}
+	return nil
+}
+
+// Update saves an item's ingredient, quantity and expiry
+func (s *PantryStore) Update(ctx context.Context, item models.PantryItem) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": item.ID, "user_id": item.UserID}, bson.M{"$set": bson.M{
+		"ingredient_id": item.IngredientID,
+		"name":          item.Name,
+		"quantity":      item.Quantity,
+		"unit":          item.Unit,
+		"expires_on":    item.ExpiresOn,
+		"updated_at":    item.UpdatedAt,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to update pantry item: %v", err)
+	}
+	return nil
+}
+
+// Delete removes one of the user's pantry items, reporting whether it existed
+func (s *PantryStore) Delete(ctx context.Context, userID, itemID primitive.ObjectID) (bool, error) {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": itemID, "user_id": userID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete pantry item: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// pantryEpsilon absorbs rounding in pantry quantities
+const pantryEpsilon = 1e-6
+
+// Cook takes portion servings of a recipe's ingredients out of the user's
+// pantry, using the unexpired items that expire soonest first. Each item is
+// only decremented while it still holds what is taken, so food used
+// concurrently is never taken twice; an item that no longer has enough is
+// left out. Ingredients the pantry lacks, or holds in units that can't be
+// converted, are left alone. Items that run out stay, empty, until
+// RemoveEmpty, so Restore can still put everything back. It returns what was
+// taken.
+func (s *PantryStore) Cook(ctx context.Context, userID primitive.ObjectID, recipe models.Recipe, ingredients map[primitive.ObjectID]models.Ingredient, portion float64, today, now time.Time) ([]models.PantryUse, error) {
+	items, err := s.Items(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	planned, _ := UsePantry(UnexpiredPantry(items, today), recipe, ingredients, portion)
+	var taken []models.PantryUse
+	for _, use := range planned {
+		result, err := s.collection.UpdateOne(ctx,
+			bson.M{"_id": use.ItemID, "user_id": userID, "quantity": bson.M{"$gte": use.Quantity - pantryEpsilon}},
+			bson.M{"$inc": bson.M{"quantity": -use.Quantity}, "$set": bson.M{"updated_at": now}})
+		if err != nil {
+			if restoreErr := s.Restore(ctx, userID, taken, now); restoreErr != nil {
+				log.Printf("Failed to put back pantry items after a failed cook: %v", restoreErr)
+			}
+			return nil, fmt.Errorf("failed to update pantry item: %v", err)
+		}
+		if result.MatchedCount > 0 {
+			taken = append(taken, use)
+		}
+	}
+	return taken, nil
+}
+
+// Restore puts back what Cook took, for cooking that wasn't logged after all
+func (s *PantryStore) Restore(ctx context.Context, userID primitive.ObjectID, uses []models.PantryUse, now time.Time) error {
+	for _, use := range uses {
+		_, err := s.collection.UpdateOne(ctx, bson.M{"_id": use.ItemID, "user_id": userID},
+			bson.M{"$inc": bson.M{"quantity": use.Quantity}, "$set": bson.M{"updated_at": now}})
+		if err != nil {
+			return fmt.Errorf("failed to restore pantry item: %v", err)
+		}
+	}
+	return nil
+}
+
+// RemoveEmpty removes the items Cook used up
+func (s *PantryStore) RemoveEmpty(ctx context.Context, userID primitive.ObjectID, uses []models.PantryUse) error {
+	ids := make([]primitive.ObjectID, 0, len(uses))
+	for _, use := range uses {
+		ids = append(ids, use.ItemID)
+	}
+	_, err := s.collection.DeleteMany(ctx, bson.M{
+		"_id":      bson.M{"$in": ids},
+		"user_id":  userID,
+		"quantity": bson.M{"$lte": pantryEpsilon},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove used up pantry items: %v", err)
+	}
+	return nil
+}
+
+// UsePantry works out what cooking portion servings of a recipe takes from
+// items, which must be sorted soonest to expire first. It returns what each
+// item gave and the items that changed, with their new quantities.
+func UsePantry(items []models.PantryItem, recipe models.Recipe, ingredients map[primitive.ObjectID]models.Ingredient, portion float64) ([]models.PantryUse, []models.PantryItem) {
+	if recipe.Servings <= 0 {
+		return nil, nil
+	}
+	items = append([]models.PantryItem(nil), items...)
+	changed := map[int]bool{}
+	var uses []models.PantryUse
+	for _, ingredientUse := range recipe.Ingredients {
+		wanted := ingredientUse.Quantity * portion / float64(recipe.Servings)
+		for i := range items {
+			item := &items[i]
+			if wanted <= 1e-9 || item.IngredientID != ingredientUse.IngredientID || item.Quantity <= 0 {
+				continue
+			}
+			// How much of the item, in its own unit, the recipe still wants
+			perUnit, ok := unitsPer(ingredientUse.Unit, item.Unit, ingredients[item.IngredientID])
+			if !ok {
+				continue
+			}
+			take := math.Min(item.Quantity, wanted*perUnit)
+			item.Quantity = math.Round((item.Quantity-take)*1000) / 1000
+			wanted -= take / perUnit
+			changed[i] = true
+			uses = append(uses, models.PantryUse{
+				ItemID:       item.ID,
+				IngredientID: item.IngredientID,
+				Name:         item.Name,
+				Quantity:     math.Round(take*1000) / 1000,
+				Unit:         item.Unit,
+			})
+		}
+	}
+
+	var remaining []models.PantryItem
+	for i, item := range items {
+		if changed[i] {
+			remaining = append(remaining, item)
+		}
+	}
+	return uses, remaining
+}
+
+// unitsPer returns how many of unit to make one of from, converting through
+// grams when the two measure different things
+func unitsPer(from, to string, ingredient models.Ingredient) (float64, bool) {
+	if factor, err := helpers.ConvertUnit(1, from, to); err == nil {
+		return factor, true
+	}
+	fromGrams, err := helpers.ToGrams(1, from, ingredient)
+	if err != nil {
+		return 0, false
+	}
+	toGrams, err := helpers.ToGrams(1, to, ingredient)
+	if err != nil || toGrams <= 0 {
+		return 0, false
+	}
+	return fromGrams / toGrams, true
+}
+
+// PantryItemView is a pantry item with how long it has left
+type PantryItemView struct {
+	models.PantryItem
+	DaysLeft *int `json:"days_left,omitempty"` // negative once expired
+	Expiring bool `json:"expiring"`
+	Expired  bool `json:"expired"`
+}
+
+// ViewPantryItem tells how long an item has left on the user's today
+func ViewPantryItem(item models.PantryItem, today time.Time) PantryItemView {
+	view := PantryItemView{PantryItem: item}
+	expires, err := models.ParseDate(item.ExpiresOn)
+	if item.ExpiresOn == "" || err != nil {
+		return view
+	}
+	daysLeft := models.DayCount(today, expires) - 1
+	view.DaysLeft = &daysLeft
+	view.Expired = daysLeft < 0
+	view.Expiring = !view.Expired && daysLeft <= ExpiringSoonDays
+	return view
+}
+
+// ExpiringIngredients returns the ingredients of items expiring soon but not
+// yet expired
+func ExpiringIngredients(items []models.PantryItem, today time.Time) []primitive.ObjectID {
+	seen := map[primitive.ObjectID]bool{}
+	var ids []primitive.ObjectID
+	for _, item := range items {
+		if ViewPantryItem(item, today).Expiring && !seen[item.IngredientID] {
+			seen[item.IngredientID] = true
+			ids = append(ids, item.IngredientID)
+		}
+	}
+	return ids
+}
+
+// UnexpiredPantry returns the items still good to use on today
+func UnexpiredPantry(items []models.PantryItem, today time.Time) []models.PantryItem {
+	var usable []models.PantryItem
+	for _, item := range items {
+		if !ViewPantryItem(item, today).Expired {
+			usable = append(usable, item)
+		}
+	}
+	return usable
+}
+
+// sortPantryItems orders items soonest to expire first, those that keep last
+func sortPantryItems(items []models.PantryItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].ExpiresOn, items[j].ExpiresOn
+		if (a == "") != (b == "") {
+			return b == ""
+		}
+		if a != b {
+			return a < b
+		}
+		return items[i].Name < items[j].Name
+	})
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultMealPlanCacheTTL = 24 * time.Hour
+
+// MealPlanCache reuses AI-generated plans for requests with identical normalized
+// inputs. Entries expire after MEAL_PLAN_CACHE_TTL (a Go duration, default 24h)
+// and are dropped whenever the meal catalogue changes.
+type MealPlanCache struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+}
+
+func NewMealPlanCache(collection *mongo.Collection) *MealPlanCache {
+	ttl := defaultMealPlanCacheTTL
+	if v, err := time.ParseDuration(os.Getenv("MEAL_PLAN_CACHE_TTL")); err == nil && v > 0 {
+		ttl = v
+	}
+	return &MealPlanCache{collection: collection, ttl: ttl}
+}
+
+// EnsureIndexes creates the lookup index and the TTL index that expires entries
+func (c *MealPlanCache) EnsureIndexes(ctx context.Context) error {
+	_, err := c.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create meal plan cache indexes: %v", err)
+	}
+	return nil
+}
+
+// CatalogueVersion fingerprints a set of meals so any addition, removal or edit changes it
+func CatalogueVersion(meals []models.Meal) string {
+	entries := make([]string, 0, len(meals))
+	for _, meal := range meals {
+		entries = append(entries, fmt.Sprintf("%s:%d:%d", meal.ID.Hex(), meal.CreatedAt.UnixNano(), meal.UpdatedAt.UnixNano()))
+	}
+	sort.Strings(entries)
+
+	sum := sha256.Sum256([]byte(strings.Join(entries, "|")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// MealPlanCacheKey hashes the normalized request together with the prompt the
+// plan is rendered from and the model
+func MealPlanCacheKey(request MealPlanRequest, prompt *models.PromptTemplate, model string) string {
+	normalized := struct {
+		Preference          string   `json:"preference"`
+		HealthGoals         []string `json:"health_goals"`
+		MedicalConditions   []string `json:"medical_conditions"`
+		Allergens           []string `json:"allergens"`
+		DietaryRestrictions []string `json:"dietary_restrictions"`
+		Constraints         []string `json:"constraints"`
+		Targets             string   `json:"targets"`
+		Slots               string   `json:"slots"`
+		Catalogue           string   `json:"catalogue"`
+		UseUpMeals          []string `json:"use_up_meals"`
+		Days                int      `json:"days"`
+		Prompt              string   `json:"prompt"`
+		Model               string   `json:"model"`
+	}{
+		Preference:          strings.ToLower(strings.TrimSpace(request.UserPreference)),
+		HealthGoals:         normalizeList(request.HealthGoals),
+		MedicalConditions:   normalizeList(request.MedicalConditions),
+		Allergens:           normalizeList(request.Allergens),
+		DietaryRestrictions: normalizeList(request.DietaryRestrictions),
+		Constraints:         normalizeList(request.Constraints),
+		Targets:             targetsKey(request.Targets, request.Tolerance),
+		Slots:               slotsKey(request.Slots),
+		Catalogue:           CatalogueVersion(request.AvailableMeals),
+		UseUpMeals:          normalizeList(request.UseUpMeals),
+		Days:                request.DaysToGenerate,
+		Prompt:              PromptFingerprint(prompt),
+		Model:               model,
+	}
+
+	body, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// targetsKey pins the parts of the targets that change the plan, leaving out when they were computed
+func targetsKey(targets *models.NutritionTargets, tolerance float64) string {
+	if targets == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%.0f/%.0f/%.0f/%.2f", targets.Calories, targets.Protein, targets.Carbohydrates, targets.Fat, tolerance)
+}
+
+// slotsKey pins the slots a plan is laid out in, in order
+func slotsKey(slots []models.MealSlot) string {
+	slots = models.MealSlotsOrDefault(slots)
+	keys := make([]string, len(slots))
+	for i, slot := range slots {
+		keys[i] = fmt.Sprintf("%s:%s:%s:%.2f", slot.Name, slot.Category, slot.Time, slot.CalorieShare)
+	}
+	return strings.Join(keys, ",")
+}
+
+func normalizeList(values []string) []string {
+	normalized := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" && value != "none" {
+			normalized = append(normalized, value)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// Get returns a live cache entry for key, or nil on a miss
+func (c *MealPlanCache) Get(ctx context.Context, key string) (*models.MealPlanCacheEntry, error) {
+	var entry models.MealPlanCacheEntry
+	err := c.collection.FindOneAndUpdate(ctx,
+		bson.M{"key": key, "expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"$inc": bson.M{"hits": 1}},
+	).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meal plan cache: %v", err)
+	}
+	return &entry, nil
+}
+
+// Put stores a freshly generated plan under key
+func (c *MealPlanCache) Put(ctx context.Context, key string, request MealPlanRequest, result *MealPlanResult) error {
+	now := time.Now()
+	entry := models.MealPlanCacheEntry{
+		Key:              key,
+		Days:             result.Days,
+		Preference:       request.UserPreference,
+		CatalogueVersion: CatalogueVersion(request.AvailableMeals),
+		Model:            result.Model,
+		PromptVersion:    result.PromptVersion,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(c.ttl),
+	}
+
+	_, err := c.collection.ReplaceOne(ctx, bson.M{"key": key}, entry, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to write meal plan cache: %v", err)
+	}
+	return nil
+}
+
+// Invalidate drops every cached plan, used when the meal catalogue changes
+func (c *MealPlanCache) Invalidate(ctx context.Context) error {
+	_, err := c.collection.DeleteMany(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to invalidate meal plan cache: %v", err)
+	}
+	return nil
+}
+
+// ShuffleEnabled reports whether cached plans should be reordered per user.
+// Controlled by MEAL_PLAN_CACHE_SHUFFLE, enabled unless set to "false".
+func ShuffleEnabled() bool {
+	return os.Getenv("MEAL_PLAN_CACHE_SHUFFLE") != "false"
+}
+
+// ShuffleDays reassigns the days of a plan in an order derived from the user's
+// ID, so users served the same cached plan don't see identical calendars
+func ShuffleDays(days map[int]models.DailyMeals, userID primitive.ObjectID) map[int]models.DailyMeals {
+	keys := make([]int, 0, len(days))
+	for day := range days {
+		keys = append(keys, day)
+	}
+	sort.Ints(keys)
+
+	seed := int64(binary.BigEndian.Uint64(userID[4:]))
+	order := rand.New(rand.NewSource(seed)).Perm(len(keys))
+
+	shuffled := make(map[int]models.DailyMeals, len(days))
+	for i, day := range keys {
+		shuffled[day] = days[keys[order[i]]]
+	}
+	return shuffled
+}
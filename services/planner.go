@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MealPlanner generates a plan for a request. AIService and DeterministicPlanner both implement it.
+type MealPlanner interface {
+	GenerateMealPlan(ctx context.Context, request MealPlanRequest) (*MealPlanResult, error)
+}
+
+// DeterministicPlanner builds plans without an LLM. For a given seed and
+// request it always produces the same plan, cycling through a shuffled
+// copy of each category so meals don't repeat until the category runs out.
+type DeterministicPlanner struct {
+	rng *rand.Rand
+}
+
+func NewDeterministicPlanner(seed int64) *DeterministicPlanner {
+	return &DeterministicPlanner{rng: rand.New(rand.NewSource(seed))}
+}
+
+// GroupMealsByCategory indexes meals by their category, sorted by name for stable ordering
+func GroupMealsByCategory(meals []models.Meal) map[string][]models.Meal {
+	mealsByCategory := make(map[string][]models.Meal)
+	for _, meal := range meals {
+		mealsByCategory[meal.Category] = append(mealsByCategory[meal.Category], meal)
+	}
+	for _, categoryMeals := range mealsByCategory {
+		sort.Slice(categoryMeals, func(i, j int) bool { return categoryMeals[i].Name < categoryMeals[j].Name })
+	}
+	return mealsByCategory
+}
+
+func (p *DeterministicPlanner) GenerateMealPlan(ctx context.Context, request MealPlanRequest) (*MealPlanResult, error) {
+	mealsByCategory := GroupMealsByCategory(request.AvailableMeals)
+	slots := models.MealSlotsOrDefault(request.Slots)
+
+	// Slots sharing a category, like two snacks, draw from one rotation so
+	// they serve different meals
+	rotations := make(map[string][]models.Meal, len(slots))
+	for _, slot := range slots {
+		if _, exists := rotations[slot.Category]; exists {
+			continue
+		}
+		categoryMeals := append([]models.Meal(nil), mealsByCategory[slot.Category]...)
+		p.rng.Shuffle(len(categoryMeals), func(i, j int) {
+			categoryMeals[i], categoryMeals[j] = categoryMeals[j], categoryMeals[i]
+		})
+		rotations[slot.Category] = preferMeals(categoryMeals, request.UseUpMeals)
+	}
+
+	served := make(map[string]int, len(rotations))
+	days := make(map[int]models.DailyMeals, request.DaysToGenerate)
+	for day := 1; day <= request.DaysToGenerate; day++ {
+		dailyMeals := make(models.DailyMeals, len(slots))
+		for _, slot := range slots {
+			// A category with no meals leaves its slot empty
+			var planned models.PlannedMeal
+			if rotation := rotations[slot.Category]; len(rotation) > 0 {
+				planned = models.NewPlannedMeal(rotation[served[slot.Category]%len(rotation)])
+				served[slot.Category]++
+			}
+			dailyMeals.Set(slot.Name, planned)
+		}
+		days[day] = dailyMeals
+	}
+
+	if request.Targets != nil {
+		mealsByID := IndexMealsByID(request.AvailableMeals)
+		for day, dailyMeals := range days {
+			days[day], _ = fitDay(dailyMeals, slots, mealsByID, mealsByCategory, *request.Targets, request.Tolerance)
+		}
+	}
+
+	return &MealPlanResult{Days: days, Model: "deterministic"}, nil
+}
+
+// preferMeals moves the named meals to the front of meals, keeping the order
+// within both groups
+func preferMeals(meals []models.Meal, names []string) []models.Meal {
+	if len(names) == 0 {
+		return meals
+	}
+	preferred := make(map[string]bool, len(names))
+	for _, name := range names {
+		preferred[name] = true
+	}
+	sort.SliceStable(meals, func(i, j int) bool {
+		return preferred[meals[i].Name] && !preferred[meals[j].Name]
+	})
+	return meals
+}
+
+// DailyMeals picks a random meal for every slot of one day
+func (p *DeterministicPlanner) DailyMeals(slots []models.MealSlot, mealsByCategory map[string][]models.Meal) models.DailyMeals {
+	dailyMeals := make(models.DailyMeals, len(slots))
+	for _, slot := range slots {
+		dailyMeals.Set(slot.Name, p.randomMeal(mealsByCategory[slot.Category]))
+	}
+	return dailyMeals
+}
+
+// PlanFromNames turns a plan that names its meals, as AI planners answer,
+// into one that references them. Names resolve within the category of their
+// slot; a name missing from it keeps only its name, so RestrictToCatalogue
+// replaces it. Slots not in slots are dropped.
+func PlanFromNames(names map[int]map[string]string, meals []models.Meal, slots []models.MealSlot) map[int]models.DailyMeals {
+	mealsByName := IndexMealsByName(meals)
+	days := make(map[int]models.DailyMeals, len(names))
+	for day, slotNames := range names {
+		dailyMeals := make(models.DailyMeals, len(slots))
+		for slot, name := range slotNames {
+			slot = strings.ToLower(strings.TrimSpace(slot))
+			name = strings.TrimSpace(name)
+			if _, configured := models.FindSlot(slots, slot); !configured || name == "" {
+				continue
+			}
+			planned := models.PlannedMeal{Name: name}
+			if meal, exists := mealsByName[models.SlotCategory(slots, slot)][name]; exists {
+				planned = models.NewPlannedMeal(meal)
+			}
+			dailyMeals.Set(slot, planned)
+		}
+		days[day] = dailyMeals
+	}
+	return days
+}
+
+// randomMeal picks a meal for a slot, leaving it empty when there is none to pick
+func (p *DeterministicPlanner) randomMeal(meals []models.Meal) models.PlannedMeal {
+	if len(meals) == 0 {
+		return models.PlannedMeal{}
+	}
+	return models.NewPlannedMeal(meals[p.rng.Intn(len(meals))])
+}
+
+// DatedDays assigns the numbered days a planner returns to calendar dates,
+// day 1 falling on start
+func DatedDays(days map[int]models.DailyMeals, start time.Time) map[string]models.DailyMeals {
+	dated := make(map[string]models.DailyMeals, len(days))
+	for day, dailyMeals := range days {
+		dated[models.FormatDate(start.AddDate(0, 0, day-1))] = dailyMeals
+	}
+	return dated
+}
+
+// RestrictToCatalogue replaces every meal from fromDate onwards that is not in
+// allowed with a random allowed meal of its slot's category, so a plan can
+// never serve something outside the user's filtered catalogue. Slots the user
+// locked are theirs to keep, once UnlockDisallowed has freed those the dietary
+// profile rules out. It returns the number of slots replaced.
+func (p *DeterministicPlanner) RestrictToCatalogue(days map[string]models.DailyMeals, allowed []models.Meal, slots []models.MealSlot, fromDate string) int {
+	allowedIDs := make(map[primitive.ObjectID]bool, len(allowed))
+	for _, meal := range allowed {
+		allowedIDs[meal.ID] = true
+	}
+	mealsByCategory := GroupMealsByCategory(allowed)
+
+	replaced := 0
+	for date, dailyMeals := range days {
+		if date < fromDate {
+			continue
+		}
+		for _, slot := range dailyMeals.SlotNames(slots) {
+			planned, _ := dailyMeals.Get(slot)
+			if planned.IsEmpty() || planned.Locked || allowedIDs[planned.MealID] {
+				continue
+			}
+			dailyMeals.Set(slot, p.randomMeal(mealsByCategory[models.SlotCategory(slots, slot)]))
+			replaced++
+		}
+		days[date] = dailyMeals
+	}
+	return replaced
+}
+
+// UnlockDisallowed unlocks the slots from fromDate onwards locked to a meal
+// the profile rules out, so RestrictToCatalogue or a recalibration replaces
+// them: a lock keeps the user's choice, not a meal their allergens or
+// restrictions now forbid. mealsByID holds the planned meals. It returns the
+// slots unlocked, by date.
+func UnlockDisallowed(days map[string]models.DailyMeals, mealsByID map[primitive.ObjectID]models.Meal, profile DietaryProfile, slots []models.MealSlot, fromDate string) []models.UnlockedSlot {
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		if date >= fromDate {
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+
+	unlocked := []models.UnlockedSlot{}
+	for _, date := range dates {
+		dailyMeals := days[date]
+		for _, slot := range dailyMeals.SlotNames(slots) {
+			planned, _ := dailyMeals.Get(slot)
+			meal, found := mealsByID[planned.MealID]
+			if !planned.Locked || !found {
+				continue
+			}
+			if allowed, reason := profile.Allows(meal); !allowed {
+				planned.Locked = false
+				dailyMeals.Set(slot, planned)
+				unlocked = append(unlocked, models.UnlockedSlot{Date: date, Slot: slot, Meal: meal.Name, Reason: reason})
+			}
+		}
+		days[date] = dailyMeals
+	}
+	return unlocked
+}
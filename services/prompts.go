@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Prompt template names
+const (
+	PromptMealPlan      = "meal_plan"
+	PromptChatAssistant = "chat_assistant"
+)
+
+// RenderedPrompt is a template executed against its inputs
+type RenderedPrompt struct {
+	Name    string
+	Version string
+	System  string
+	User    string
+}
+
+// PromptStore resolves prompt templates from PROMPTS_DIR/<name>/<version>.tmpl,
+// letting an active document in the prompt_templates collection take precedence.
+// The file version defaults to the highest one on disk and can be pinned with
+// PROMPT_VERSION_<NAME>.
+type PromptStore struct {
+	dir        string
+	collection *mongo.Collection
+}
+
+func NewPromptStore(dir string, collection *mongo.Collection) *PromptStore {
+	if dir == "" {
+		dir = "prompts"
+	}
+	return &PromptStore{dir: dir, collection: collection}
+}
+
+var promptFuncs = template.FuncMap{
+	"join":        strings.Join,
+	"formatMeals": formatMealsForPrompt,
+	"add":         func(a, b int) int { return a + b },
+	"percent":     func(f float64) int { return int(math.Round(f * 100)) },
+}
+
+// ParsePromptTemplate checks that a template body parses and defines a system block.
+// The user block is optional.
+func ParsePromptTemplate(name, body string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(promptFuncs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %v", err)
+	}
+	if tmpl.Lookup("system") == nil {
+		return nil, fmt.Errorf("prompt template %s does not define \"system\"", name)
+	}
+	return tmpl, nil
+}
+
+// Active returns the template currently in use for name
+func (s *PromptStore) Active(ctx context.Context, name string) (*models.PromptTemplate, error) {
+	if s.collection != nil {
+		var override models.PromptTemplate
+		err := s.collection.FindOne(ctx,
+			bson.M{"name": name, "active": true},
+			options.FindOne().SetSort(bson.M{"updated_at": -1}),
+		).Decode(&override)
+		if err == nil {
+			override.Source = "database"
+			return &override, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("failed to load prompt override: %v", err)
+		}
+	}
+
+	version := os.Getenv("PROMPT_VERSION_" + strings.ToUpper(name))
+	if version == "" {
+		versions, err := s.FileVersions(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("no prompt template found for %s", name)
+		}
+		version = versions[len(versions)-1]
+	}
+	return s.File(name, version)
+}
+
+// File loads a specific version of a template from disk
+func (s *PromptStore) File(name, version string) (*models.PromptTemplate, error) {
+	path := filepath.Join(s.dir, name, version+".tmpl")
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template %s: %v", path, err)
+	}
+
+	info, _ := os.Stat(path)
+	var modified time.Time
+	if info != nil {
+		modified = info.ModTime()
+	}
+
+	return &models.PromptTemplate{
+		Name:      name,
+		Version:   version,
+		Body:      string(body),
+		Active:    true,
+		Source:    "file",
+		CreatedAt: modified,
+		UpdatedAt: modified,
+	}, nil
+}
+
+// FileVersions lists the versions of a template available on disk in ascending order
+func (s *PromptStore) FileVersions(name string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, name, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt templates: %v", err)
+	}
+
+	versions := make([]string, 0, len(matches))
+	for _, match := range matches {
+		versions = append(versions, strings.TrimSuffix(filepath.Base(match), ".tmpl"))
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versionNumber(versions[i]) < versionNumber(versions[j])
+	})
+	return versions, nil
+}
+
+// CheckOverrideVersion rejects names for database versions that would be
+// confused with file versions in the PromptVersion recorded on plans and usage:
+// any version on disk and any name numbered like one (v1, v2, ...)
+func (s *PromptStore) CheckOverrideVersion(name, version string) error {
+	if versionNumber(version) >= 0 {
+		return fmt.Errorf("version %q is reserved for template files; name database versions like db-1", version)
+	}
+	versions, err := s.FileVersions(name)
+	if err != nil {
+		return err
+	}
+	for _, fileVersion := range versions {
+		if fileVersion == version {
+			return fmt.Errorf("version %q of %s already exists on disk", version, name)
+		}
+	}
+	return nil
+}
+
+// versionNumber orders "v2" before "v10"; unnumbered versions sort first
+func versionNumber(version string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Render executes the active template for name against data
+func (s *PromptStore) Render(ctx context.Context, name string, data interface{}) (*RenderedPrompt, error) {
+	active, err := s.Active(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return RenderPrompt(active, data)
+}
+
+// PromptFingerprint identifies exactly what a template renders: where it came
+// from and a hash of its body, which a version name alone doesn't pin down
+func PromptFingerprint(prompt *models.PromptTemplate) string {
+	sum := sha256.Sum256([]byte(prompt.Body))
+	return prompt.Source + ":" + hex.EncodeToString(sum[:8])
+}
+
+// RenderPrompt executes a template resolved earlier against data
+func RenderPrompt(active *models.PromptTemplate, data interface{}) (*RenderedPrompt, error) {
+	name := active.Name
+	tmpl, err := ParsePromptTemplate(name, active.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var system, user bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&system, "system", data); err != nil {
+		return nil, fmt.Errorf("failed to render system prompt: %v", err)
+	}
+	if tmpl.Lookup("user") != nil {
+		if err := tmpl.ExecuteTemplate(&user, "user", data); err != nil {
+			return nil, fmt.Errorf("failed to render user prompt: %v", err)
+		}
+	}
+
+	return &RenderedPrompt{
+		Name:    name,
+		Version: active.Version,
+		System:  strings.TrimSpace(system.String()),
+		User:    strings.TrimSpace(user.String()),
+	}, nil
+}
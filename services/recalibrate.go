@@ -0,0 +1,245 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecalibrationConstraints narrow what a recalibration may plan on the dates it
+// recalibrates
+type RecalibrationConstraints struct {
+	ExcludeMeals map[primitive.ObjectID]bool
+	MaxPrepTime  int // minutes; 0 for no limit
+	// MinCalories and MaxCalories bound each day's calories in place of the
+	// calorie target. Both are set or neither is.
+	MinCalories int
+	MaxCalories int
+	// UseUp are meals whose recipes use ingredients the user wants used up
+	UseUp map[primitive.ObjectID]bool
+	// Avoid are meals the user's food diary shows they keep skipping or
+	// replacing; they are planned only when nothing else fits
+	Avoid     map[primitive.ObjectID]bool
+	Skip      []models.SlotRef
+	EatingOut []models.EatingOutSlot
+}
+
+// RecalibrationChange is a slot recalibration changed, and why
+type RecalibrationChange struct {
+	Date   string             `json:"date"`
+	Slot   string             `json:"slot"`
+	From   models.PlannedMeal `json:"from"`
+	To     models.PlannedMeal `json:"to"`
+	Reason string             `json:"reason"`
+}
+
+// RecalibrationSummary reports what a recalibration did to the plan
+type RecalibrationSummary struct {
+	Dates   []string              `json:"dates"`
+	Changed int                   `json:"changed"`
+	Kept    int                   `json:"kept"`
+	Changes []RecalibrationChange `json:"changes"`
+	// TargetMisses are recalibrated dates still outside the calorie range or
+	// the user's targets
+	TargetMisses []string `json:"target_misses,omitempty"`
+}
+
+// AddChange records a slot changed outside Recalibrate, such as a meal
+// RestrictToCatalogue replaced on a day that was not recalibrated
+func (s *RecalibrationSummary) AddChange(change RecalibrationChange) {
+	s.Changes = append(s.Changes, change)
+	s.Changed++
+}
+
+// Allows reports whether a meal meets the exclusions and the prep time limit
+func (c RecalibrationConstraints) Allows(meal models.Meal) bool {
+	if c.ExcludeMeals[meal.ID] {
+		return false
+	}
+	return c.MaxPrepTime <= 0 || meal.Preptime <= c.MaxPrepTime
+}
+
+// calorieTargets returns the targets and tolerance days are fitted to: the
+// calorie range when there is one, else the user's targets, if any
+func (c RecalibrationConstraints) calorieTargets(targets *models.NutritionTargets, tolerance float64) (*models.NutritionTargets, float64) {
+	if c.MaxCalories > 0 {
+		mid := float64(c.MinCalories+c.MaxCalories) / 2
+		return &models.NutritionTargets{Calories: int(math.Round(mid))}, (float64(c.MaxCalories) - mid) / mid
+	}
+	return targets, tolerance
+}
+
+// Recalibrate replans the given dates of days under the constraints. Skipped
+// and eating out slots are marked as such and locked, locked slots are kept
+// and every other slot gets an allowed meal of its category, preferring meals
+// that use up ingredients and then those least planned across the plan, so
+// the untouched days keep their variety. Each day is then fitted to the
+// calorie range or, without one, to targets when the user has them.
+func (p *DeterministicPlanner) Recalibrate(days map[string]models.DailyMeals, dates []string, meals []models.Meal, slots []models.MealSlot, constraints RecalibrationConstraints, targets *models.NutritionTargets, tolerance float64) RecalibrationSummary {
+	dates = append([]string(nil), dates...)
+	sort.Strings(dates)
+	summary := RecalibrationSummary{Dates: dates, Changes: []RecalibrationChange{}}
+
+	var allowed []models.Meal
+	for _, meal := range meals {
+		if constraints.Allows(meal) {
+			allowed = append(allowed, meal)
+		}
+	}
+	mealsByID := IndexMealsByID(meals)
+	allowedByCategory := GroupMealsByCategory(allowed)
+	fitTargets, fitTolerance := constraints.calorieTargets(targets, tolerance)
+
+	// Meals on the days left alone count against picking them again
+	recalibrated := make(map[string]bool, len(dates))
+	for _, date := range dates {
+		recalibrated[date] = true
+	}
+	planned := map[primitive.ObjectID]int{}
+	for date, dailyMeals := range days {
+		if recalibrated[date] {
+			continue
+		}
+		for _, id := range dailyMeals.MealIDs() {
+			planned[id]++
+		}
+	}
+
+	for _, date := range dates {
+		previous := days[date]
+		dailyMeals := models.DailyMeals{}
+		reasons := map[string]string{}
+
+		for _, ref := range constraints.Skip {
+			if ref.Date == date {
+				dailyMeals.Set(ref.Slot, models.PlannedMeal{Status: models.SlotSkipped, Locked: true})
+				reasons[ref.Slot] = "you are skipping this meal"
+			}
+		}
+		for _, out := range constraints.EatingOut {
+			if out.Date != date {
+				continue
+			}
+			calories := out.Calories
+			if calories == 0 && fitTargets != nil {
+				if slot, ok := models.FindSlot(slots, out.Slot); ok {
+					calories = int(math.Round(slot.CalorieShare * float64(fitTargets.Calories)))
+				}
+			}
+			dailyMeals.Set(out.Slot, models.PlannedMeal{Status: models.SlotEatingOut, Locked: true, Calories: calories})
+			reasons[out.Slot] = fmt.Sprintf("you are eating out, counted as %d kcal", calories)
+		}
+		for slot, meal := range previous {
+			if _, set := dailyMeals[slot]; !set && meal.Locked {
+				dailyMeals.Set(slot, meal)
+			}
+		}
+
+		for _, slot := range slots {
+			if _, set := dailyMeals[slot.Name]; set {
+				continue
+			}
+			meal, ok := p.leastPlannedMeal(allowedByCategory[slot.Category], constraints.UseUp, constraints.Avoid, planned, dailyMeals)
+			if !ok {
+				dailyMeals.Set(slot.Name, models.PlannedMeal{})
+				reasons[slot.Name] = fmt.Sprintf("no %s meal meets your constraints", slot.Category)
+				continue
+			}
+			dailyMeals.Set(slot.Name, models.NewPlannedMeal(meal))
+			planned[meal.ID]++
+			reasons[slot.Name] = replacementReason(previous[slot.Name], meal, mealsByID, constraints)
+		}
+
+		if fitTargets != nil {
+			fitted, changed := fitDay(dailyMeals, slots, mealsByID, allowedByCategory, *fitTargets, fitTolerance)
+			if changed {
+				for slot, meal := range fitted {
+					if meal.MealID != dailyMeals[slot].MealID {
+						planned[dailyMeals[slot].MealID]--
+						planned[meal.MealID]++
+						reasons[slot] = fitReason(constraints)
+					}
+				}
+				dailyMeals = fitted
+			}
+			if !WithinTargets(DailyTotals(dailyMeals, mealsByID), *fitTargets, fitTolerance) {
+				summary.TargetMisses = append(summary.TargetMisses, date)
+			}
+		}
+
+		for _, slot := range dailyMeals.SlotNames(slots) {
+			if models.SamePlannedMeal(previous[slot], dailyMeals[slot]) {
+				summary.Kept++
+				continue
+			}
+			summary.AddChange(RecalibrationChange{Date: date, Slot: slot, From: previous[slot], To: dailyMeals[slot], Reason: reasons[slot]})
+		}
+		days[date] = dailyMeals
+	}
+	return summary
+}
+
+// leastPlannedMeal picks the candidate to plan next: one that uses up
+// ingredients if any does, then the one least planned elsewhere, not yet on
+// the day and not one the user keeps missing, ties broken at random
+func (p *DeterministicPlanner) leastPlannedMeal(candidates []models.Meal, useUp, avoid map[primitive.ObjectID]bool, planned map[primitive.ObjectID]int, day models.DailyMeals) (models.Meal, bool) {
+	if len(candidates) == 0 {
+		return models.Meal{}, false
+	}
+	onDay := make(map[primitive.ObjectID]bool, len(day))
+	for _, id := range day.MealIDs() {
+		onDay[id] = true
+	}
+
+	shuffled := append([]models.Meal(nil), candidates...)
+	p.rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	rank := func(meal models.Meal) int {
+		uses := planned[meal.ID]
+		if onDay[meal.ID] {
+			uses += 1000
+		}
+		if !useUp[meal.ID] {
+			uses += 100
+		}
+		if avoid[meal.ID] {
+			uses += 500
+		}
+		return uses
+	}
+	sort.SliceStable(shuffled, func(i, j int) bool { return rank(shuffled[i]) < rank(shuffled[j]) })
+	return shuffled[0], true
+}
+
+// replacementReason explains why a slot now holds meal instead of previous
+func replacementReason(previous models.PlannedMeal, meal models.Meal, mealsByID map[primitive.ObjectID]models.Meal, constraints RecalibrationConstraints) string {
+	reason := "picked for variety across your plan"
+	if old, exists := mealsByID[previous.MealID]; previous.Status == "" && !previous.IsEmpty() {
+		switch {
+		case previous.MealID == meal.ID:
+			return "kept"
+		case !exists:
+			reason = previous.Name + " is no longer allowed by your dietary profile or conditions"
+		case constraints.ExcludeMeals[old.ID]:
+			reason = "you excluded " + old.Name
+		case constraints.MaxPrepTime > 0 && old.Preptime > constraints.MaxPrepTime:
+			reason = fmt.Sprintf("%s takes %d minutes, over your %d minute limit", old.Name, old.Preptime, constraints.MaxPrepTime)
+		case constraints.Avoid[old.ID]:
+			reason = "your food diary shows you often skip or replace " + old.Name
+		}
+	}
+	if constraints.UseUp[meal.ID] {
+		reason += "; uses up ingredients you have"
+	}
+	return reason
+}
+
+func fitReason(constraints RecalibrationConstraints) string {
+	if constraints.MaxCalories > 0 {
+		return fmt.Sprintf("swapped to keep the day within %d-%d kcal", constraints.MinCalories, constraints.MaxCalories)
+	}
+	return "swapped to meet your nutrition targets"
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"figorate/helpers"
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RecipeService keeps meal calories and nutrition in step with their recipes
+type RecipeService struct {
+	recipeCollection     *mongo.Collection
+	ingredientCollection *mongo.Collection
+	mealCollection       *mongo.Collection
+}
+
+func NewRecipeService(recipes, ingredients, meals *mongo.Collection) *RecipeService {
+	return &RecipeService{
+		recipeCollection:     recipes,
+		ingredientCollection: ingredients,
+		mealCollection:       meals,
+	}
+}
+
+// RecipeNutrition computes per-serving calories and nutrition from ingredient quantities
+func RecipeNutrition(recipe models.Recipe, ingredients map[primitive.ObjectID]models.Ingredient) (int, models.Nutrition, error) {
+	if recipe.Servings <= 0 {
+		return 0, models.Nutrition{}, fmt.Errorf("recipe must have at least one serving")
+	}
+
+	var calories float64
+	var nutrition models.Nutrition
+	for _, item := range recipe.Ingredients {
+		ingredient, exists := ingredients[item.IngredientID]
+		if !exists {
+			return 0, models.Nutrition{}, fmt.Errorf("unknown ingredient %s", item.IngredientID.Hex())
+		}
+
+		grams, err := helpers.ToGrams(item.Quantity, item.Unit, ingredient)
+		if err != nil {
+			return 0, models.Nutrition{}, err
+		}
+
+		factor := grams / 100 / float64(recipe.Servings)
+		calories += ingredient.CaloriesPer100g * factor
+		nutrition.Add(ingredient.NutritionPer100g, factor)
+	}
+
+	return int(math.Round(calories)), roundNutrition(nutrition), nil
+}
+
+func roundNutrition(n models.Nutrition) models.Nutrition {
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	n.Protein = round(n.Protein)
+	n.Carbohydrates = round(n.Carbohydrates)
+	n.Fat = round(n.Fat)
+	n.Fiber = round(n.Fiber)
+	n.Sugar = round(n.Sugar)
+	n.Sodium = round(n.Sodium)
+	for name, amount := range n.Micronutrients {
+		n.Micronutrients[name] = round(amount)
+	}
+	return n
+}
+
+// LoadIngredients fetches the ingredients a recipe refers to
+func (s *RecipeService) LoadIngredients(ctx context.Context, recipe models.Recipe) (map[primitive.ObjectID]models.Ingredient, error) {
+	ids := make([]primitive.ObjectID, 0, len(recipe.Ingredients))
+	for _, item := range recipe.Ingredients {
+		ids = append(ids, item.IngredientID)
+	}
+	return s.IngredientsByID(ctx, ids)
+}
+
+// IngredientsByID fetches ingredients, indexed by their ID
+func (s *RecipeService) IngredientsByID(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Ingredient, error) {
+	cursor, err := s.ingredientCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ingredients: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var ingredients []models.Ingredient
+	if err := cursor.All(ctx, &ingredients); err != nil {
+		return nil, fmt.Errorf("failed to decode ingredients: %v", err)
+	}
+
+	byID := make(map[primitive.ObjectID]models.Ingredient, len(ingredients))
+	for _, ingredient := range ingredients {
+		byID[ingredient.ID] = ingredient
+	}
+	return byID, nil
+}
+
+// ApplyToMeal recomputes a meal's calories and nutrition from its recipe and
+// saves them, returning the meal before and after the update
+func (s *RecipeService) ApplyToMeal(ctx context.Context, recipe models.Recipe, userID primitive.ObjectID) (*models.Meal, *models.Meal, error) {
+	ingredients, err := s.LoadIngredients(ctx, recipe)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	calories, nutrition, err := RecipeNutrition(recipe, ingredients)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var before models.Meal
+	if err := s.mealCollection.FindOne(ctx, bson.M{"_id": recipe.MealID}).Decode(&before); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch meal: %v", err)
+	}
+
+	// A meal contains every allergen its ingredients now contain, on top of
+	// any it declares itself
+	var allergens []string
+	for _, ingredient := range ingredients {
+		allergens = append(allergens, ingredient.Allergens...)
+	}
+
+	after := before
+	after.Calories = calories
+	after.Nutrition = nutrition
+	after.SetAllergens(before.DeclaredAllergens, allergens)
+	after.UpdatedAt = time.Now()
+	if !userID.IsZero() {
+		after.UpdatedBy = userID
+	}
+
+	_, err = s.mealCollection.UpdateOne(ctx, bson.M{"_id": recipe.MealID}, bson.M{"$set": bson.M{
+		"calories":             after.Calories,
+		"nutrition":            after.Nutrition,
+		"allergens":            after.Allergens,
+		"declared_allergens":   after.DeclaredAllergens,
+		"ingredient_allergens": after.IngredientAllergens,
+		"updated_at":           after.UpdatedAt,
+		"updated_by":           after.UpdatedBy,
+	}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update meal nutrition: %v", err)
+	}
+
+	return &before, &after, nil
+}
+
+// RecipeError is a recipe whose nutrition can't be computed
+type RecipeError struct {
+	Recipe models.Recipe
+	Err    error
+}
+
+func (e *RecipeError) Error() string {
+	return fmt.Sprintf("recipe for meal %s: %v", e.Recipe.MealID.Hex(), e.Err)
+}
+
+// CheckIngredientUpdate computes the nutrition of every recipe using an
+// ingredient as if it were already replaced by updated, without saving
+// anything. It returns the recipes, or a *RecipeError for the first that the
+// update would break, such as by removing a density a recipe's unit needs.
+func (s *RecipeService) CheckIngredientUpdate(ctx context.Context, updated models.Ingredient) ([]models.Recipe, error) {
+	recipes, err := s.RecipesUsing(ctx, updated.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, recipe := range recipes {
+		ingredients, err := s.LoadIngredients(ctx, recipe)
+		if err != nil {
+			return nil, err
+		}
+		ingredients[updated.ID] = updated
+		if _, _, err := RecipeNutrition(recipe, ingredients); err != nil {
+			return nil, &RecipeError{Recipe: recipe, Err: err}
+		}
+	}
+	return recipes, nil
+}
+
+// RecipesUsing returns every recipe that contains an ingredient
+func (s *RecipeService) RecipesUsing(ctx context.Context, ingredientID primitive.ObjectID) ([]models.Recipe, error) {
+	cursor, err := s.recipeCollection.Find(ctx, bson.M{"ingredients.ingredient_id": ingredientID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recipes: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var recipes []models.Recipe
+	if err := cursor.All(ctx, &recipes); err != nil {
+		return nil, fmt.Errorf("failed to decode recipes: %v", err)
+	}
+	return recipes, nil
+}
+
+// MealsUsing returns the IDs of meals whose recipes contain any of the ingredients
+func (s *RecipeService) MealsUsing(ctx context.Context, ingredientIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	mealIDs := map[primitive.ObjectID]bool{}
+	if len(ingredientIDs) == 0 {
+		return mealIDs, nil
+	}
+	cursor, err := s.recipeCollection.Find(ctx, bson.M{"ingredients.ingredient_id": bson.M{"$in": ingredientIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recipes: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var recipes []models.Recipe
+	if err := cursor.All(ctx, &recipes); err != nil {
+		return nil, fmt.Errorf("failed to decode recipes: %v", err)
+	}
+	for _, recipe := range recipes {
+		mealIDs[recipe.MealID] = true
+	}
+	return mealIDs, nil
+}
+
+// RecipesForMeals fetches the recipes of meals, indexed by meal ID. Meals
+// without a recipe are left out.
+func (s *RecipeService) RecipesForMeals(ctx context.Context, mealIDs []primitive.ObjectID) (map[primitive.ObjectID]models.Recipe, error) {
+	cursor, err := s.recipeCollection.Find(ctx, bson.M{"meal_id": bson.M{"$in": mealIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recipes: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var recipes []models.Recipe
+	if err := cursor.All(ctx, &recipes); err != nil {
+		return nil, fmt.Errorf("failed to decode recipes: %v", err)
+	}
+
+	byMeal := make(map[primitive.ObjectID]models.Recipe, len(recipes))
+	for _, recipe := range recipes {
+		byMeal[recipe.MealID] = recipe
+	}
+	return byMeal, nil
+}
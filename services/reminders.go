@@ -0,0 +1,47 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"figorate/models"
+)
+
+// MaxReminderWindow caps how far ahead reminders are listed
+const MaxReminderWindow = 7 * 24 * time.Hour
+
+// MealReminders lists the reminders due from now until now+within, at the
+// time of each slot on the user's own clock. Days are the user's planned days
+// by date; slots without a time, and slots the user skips, get none.
+func MealReminders(user models.User, days map[string]models.DailyMeals, now time.Time, within time.Duration) []models.MealReminder {
+	loc := user.Location()
+	end := now.Add(within)
+
+	reminders := []models.MealReminder{}
+	for date := user.Today(now); !date.After(models.LocalDate(end, loc)); date = date.AddDate(0, 0, 1) {
+		key := models.FormatDate(date)
+		for _, slot := range user.Slots() {
+			if slot.Time == "" {
+				continue
+			}
+			at, err := models.LocalTime(date, slot.Time, loc)
+			if err != nil || at.Before(now) || at.After(end) {
+				continue
+			}
+
+			reminder := models.MealReminder{Date: key, Slot: slot.Name, Time: slot.Time, At: at.UTC()}
+			if planned, ok := days[key].Get(slot.Name); ok {
+				if planned.Status == models.SlotSkipped {
+					continue
+				}
+				reminder.Meal = &planned
+			}
+			reminders = append(reminders, reminder)
+		}
+	}
+
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].At.Before(reminders[j].At)
+	})
+	return reminders
+}
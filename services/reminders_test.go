@@ -0,0 +1,102 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMealReminders(t *testing.T) {
+	slots := []models.MealSlot{
+		{Name: "breakfast", Category: "breakfast", Time: "08:00", CalorieShare: 0.3},
+		{Name: "snack", Category: "snack", CalorieShare: 0.1},
+		{Name: "early", Category: "snack", Time: "02:30", CalorieShare: 0.1},
+		{Name: "dinner", Category: "dinner", Time: "19:00", CalorieShare: 0.5},
+	}
+	oats := models.PlannedMeal{MealID: primitive.NewObjectID(), Name: "Oats"}
+
+	tests := []struct {
+		name   string
+		zone   string
+		now    string
+		within time.Duration
+		days   map[string]models.DailyMeals
+		want   []string // date slot at, in order
+	}{
+		{
+			name:   "New York across spring forward",
+			zone:   "America/New_York",
+			now:    "2026-03-07T20:00:00Z", // 15:00 EST on March 7
+			within: 24 * time.Hour,
+			want: []string{
+				"2026-03-07 dinner 2026-03-08T00:00:00Z",
+				"2026-03-08 early 2026-03-08T07:30:00Z", // 02:30 is skipped, so 03:30 EDT
+				"2026-03-08 breakfast 2026-03-08T12:00:00Z",
+			},
+		},
+		{
+			name:   "Berlin across fall back",
+			zone:   "Europe/Berlin",
+			now:    "2026-10-24T18:00:00Z", // 20:00 CEST on October 24
+			within: 36 * time.Hour,
+			days: map[string]models.DailyMeals{
+				"2026-10-25": {"breakfast": oats, "dinner": {Status: models.SlotSkipped}},
+			},
+			want: []string{
+				"2026-10-25 early 2026-10-25T00:30:00Z", // the first 02:30
+				"2026-10-25 breakfast 2026-10-25T07:00:00Z",
+				"2026-10-26 early 2026-10-26T01:30:00Z", // CET again
+			},
+		},
+		{
+			name:   "user's date ahead of UTC",
+			zone:   "Pacific/Auckland",
+			now:    "2026-10-19T19:00:00Z", // 08:00 NZDT on October 20
+			within: 12 * time.Hour,
+			want: []string{
+				"2026-10-20 breakfast 2026-10-19T19:00:00Z",
+				"2026-10-20 dinner 2026-10-20T06:00:00Z",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user := models.User{Timezone: tt.zone, MealSlots: slots}
+			reminders := MealReminders(user, tt.days, now, tt.within)
+
+			var got []string
+			for _, reminder := range reminders {
+				got = append(got, reminder.Date+" "+reminder.Slot+" "+reminder.At.Format(time.RFC3339))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("reminders = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("reminder %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMealRemindersCarryPlannedMeal(t *testing.T) {
+	oats := models.PlannedMeal{MealID: primitive.NewObjectID(), Name: "Oats"}
+	user := models.User{Timezone: "Europe/Berlin"}
+	now := time.Date(2026, 10, 19, 5, 0, 0, 0, time.UTC)
+
+	reminders := MealReminders(user, map[string]models.DailyMeals{"2026-10-19": {"breakfast": oats}}, now, 2*time.Hour)
+	if len(reminders) != 1 || reminders[0].Slot != "breakfast" {
+		t.Fatalf("reminders = %+v, want breakfast only", reminders)
+	}
+	if reminders[0].Meal == nil || reminders[0].Meal.Name != "Oats" || reminders[0].Time != "08:00" {
+		t.Errorf("reminder = %+v, want Oats at 08:00", reminders[0])
+	}
+}
@@ -13,65 +13,154 @@ import (
 
 
 type AIService struct {
-	apiKey string
-	apiURL string
+	apiKey  string
+	apiURL  string
+	model   string
+	prompts *PromptStore
+	client  *http.Client
 }
 
-func NewAIService(apiKey string) *AIService{
+func NewAIService(apiKey string, prompts *PromptStore) *AIService{
+	return NewAIServiceWithClient(apiKey, prompts, &http.Client{})
+}
+
+// NewAIServiceWithClient lets callers swap the HTTP transport, e.g. to replay recorded responses
+func NewAIServiceWithClient(apiKey string, prompts *PromptStore, client *http.Client) *AIService {
 	return &AIService{
-		apiKey: apiKey,
-		apiURL: "https://api.openai.com/v1/chat/completions",
+		apiKey:  apiKey,
+		apiURL:  "https://api.openai.com/v1/chat/completions",
+		model:   "gpt-4-turbo-preview",
+		prompts: prompts,
+		client:  client,
 	}
 }
 
+// WithModel returns a copy of the service that asks for model instead
+func (s *AIService) WithModel(model string) *AIService {
+	copied := *s
+	copied.model = model
+	return &copied
+}
+
+// Model returns the configured model requests ask for. Usage is billed
+// against the model the provider answers with.
+func (s *AIService) Model() string {
+	return s.model
+}
+
+// MealPlanRequest holds the structured inputs rendered into the meal plan prompt
 type MealPlanRequest struct {
-	UserPreference string `json:"user_preference"`
-	AvailableMeals []models.Meal `json:"available_meals"`
-	DaysToGenerate int `json:"days_to_generate"`
+	UserPreference      string        `json:"user_preference"`
+	HealthGoals         []string      `json:"health_goals"`
+	MedicalConditions   []string      `json:"medical_conditions"`
+	Allergens           []string      `json:"allergens"`
+	DietaryRestrictions []string      `json:"dietary_restrictions"`
+	AvailableMeals      []models.Meal `json:"available_meals"`
+	DaysToGenerate      int           `json:"days_to_generate"`
+	Constraints         []string      `json:"constraints"`
+	// Targets are the user's daily calorie and macro targets, to be met within Tolerance
+	Targets   *models.NutritionTargets `json:"targets,omitempty"`
+	Tolerance float64                  `json:"tolerance,omitempty"`
+	// Slots are the meals of the user's day, DefaultMealSlots when empty
+	Slots []models.MealSlot `json:"slots,omitempty"`
+	// UseUpMeals name available meals that use pantry items about to expire
+	UseUpMeals []string `json:"use_up_meals,omitempty"`
 }
 
 type AIResponse struct {
+	Model   string `json:"model"`
 	Choices []struct {
 	Message struct {
-		Content string `json:"content"`
+		Content   string     `json:"content"`
+		ToolCalls []ToolCall `json:"tool_calls"`
 	} `json:"message"`
 	} `json:"choices"`
+	Usage models.TokenUsage `json:"usage"`
 }
 
-func (s *AIService) GenerateMealPlan(ctx context.Context, request MealPlanRequest) (map[int]models.DailyMeals, error){
-	// Prepare the prompt for GPT
-	prompt := fmt.Sprintf(`Given the following meals and user preference (%s), generate a balanced meal plan for %d days.
-	Available meals: %v
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
 
-	Rules:
-	1. Only use meals from the provided list
-	2. Ensure variety across days
-	3. Match user's nutrition preference
-	4. Balance caloric intake across meals
-	5. Consider prep time distribution
+// MealPlanResult is a generated plan together with what it cost to produce
+type MealPlanResult struct {
+	Days          map[int]models.DailyMeals
+	Model         string
+	PromptVersion string
+	Usage         models.TokenUsage
+}
 
-	Return the meal plan as a JSON object with days as keys and meal names as values, following this structure:
-	{
-		"1": {"breakfast": "meal_name", "lunch": "meal_name", "dinner": "meal_name", "dessert": "meal_name"},
-		...
-	}`, request.UserPreference, request.DaysToGenerate, formatMealsForPrompt(request.AvailableMeals))
+func (s *AIService) GenerateMealPlan(ctx context.Context, request MealPlanRequest) (*MealPlanResult, error){
+	active, err := s.prompts.Active(ctx, PromptMealPlan)
+	if err != nil {
+		return nil, err
+	}
+	return s.GenerateMealPlanFromPrompt(ctx, active, request)
+}
+
+// GenerateMealPlanFromPrompt generates a plan with a meal plan template the
+// caller resolved, so the plan is made from the same template it is cached by
+func (s *AIService) GenerateMealPlanFromPrompt(ctx context.Context, active *models.PromptTemplate, request MealPlanRequest) (*MealPlanResult, error){
+	request.Slots = models.MealSlotsOrDefault(request.Slots)
+
+	// Render the versioned prompt for this request
+	prompt, err := RenderPrompt(active, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render prompt: %v", err)
+	}
 
 	// Prepare the API request
 	reqBody := map[string]interface{}{
-		"model": "gpt-4-turbo-preview",
+		"model": s.model,
 		"messages": []map[string]string{
 			{
 				"role":    "system",
-				"content": "You are a nutritionist and meal planning expert. Generate meal plans that are balanced and follow user preferences.",
+				"content": prompt.System,
 			},
 			{
 				"role":    "user",
-				"content": prompt,
+				"content": prompt.User,
 			},
 		},
 		"temperature": 0.7,
 	}
 
+	aiResp, err := s.complete(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the meal plan from the AI response, which names the meals
+	var mealNames map[int]map[string]string
+	if err := json.Unmarshal([]byte(aiResp.Choices[0].Message.Content), &mealNames); err != nil {
+		return nil, fmt.Errorf("failed to parse meal plan: %v", err)
+	}
+
+	return &MealPlanResult{
+		Days:          PlanFromNames(mealNames, request.AvailableMeals, request.Slots),
+		Model:         s.respondedModel(aiResp),
+		PromptVersion: prompt.Version,
+		Usage:         aiResp.Usage,
+	}, nil
+}
+
+// respondedModel is the model the provider says answered, often a dated
+// version of the configured alias, falling back to the configured model
+func (s *AIService) respondedModel(aiResp *AIResponse) string {
+	if aiResp.Model != "" {
+		return aiResp.Model
+	}
+	return s.model
+}
+
+// complete sends a chat completion request and returns the decoded response
+func (s *AIService) complete(ctx context.Context, reqBody map[string]interface{}) (*AIResponse, error) {
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
@@ -87,33 +176,34 @@ func (s *AIService) GenerateMealPlan(ctx context.Context, request MealPlanReques
 	req.Header.Set("Authorization", "Bearer "+s.apiKey)
 
 	// Make the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
 	// Parse response
 	var aiResp AIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&aiResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
-
-	// Parse the meal plan from the AI response
-	var mealPlan map[int]models.DailyMeals
-	if err := json.Unmarshal([]byte(aiResp.Choices[0].Message.Content), &mealPlan); err != nil {
-		return nil, fmt.Errorf("failed to parse meal plan: %v", err)
+	if len(aiResp.Choices) == 0 {
+		return nil, fmt.Errorf("response contained no choices")
 	}
 
-	return mealPlan, nil
+	return &aiResp, nil
 }
 
 func formatMealsForPrompt(meals []models.Meal) string{
 	var result string
 	for _,meal := range meals {
-		result += fmt.Sprintf("-%s (Category: %s, Calories: %d, Tags: %v)\n",
-		meal.Name, meal.Category,meal.Calories,meal.Tags)
+		n := meal.Nutrition
+		result += fmt.Sprintf("-%s (Category: %s, Calories: %d, Protein: %.0fg, Carbs: %.0fg, Fat: %.0fg, Fiber: %.0fg, Sugar: %.0fg, Sodium: %.0fmg, Prep: %d min, Tags: %v)\n",
+		meal.Name, meal.Category,meal.Calories, n.Protein, n.Carbohydrates, n.Fat, n.Fiber, n.Sugar, n.Sodium, meal.Preptime, meal.Tags)
 	}
 	return result
 }
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"figorate/helpers"
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BuildShoppingList totals the ingredients of every meal planned in days, one
+// serving per planned meal, and takes off what the pantry holds. Quantities
+// are summed in grams, millilitres or pieces; an ingredient measured in more
+// than one of those is summed in grams when its density and piece weight
+// allow. Ingredients that can't be totalled are reported in UnconvertedItems.
+// The list comes back with its items sorted by aisle and name.
+func BuildShoppingList(days map[string]models.DailyMeals, recipes map[primitive.ObjectID]models.Recipe, ingredients map[primitive.ObjectID]models.Ingredient, pantry []models.PantryItem) models.ShoppingList {
+	needed := map[primitive.ObjectID]map[string]float64{}
+	mealsUsing := map[primitive.ObjectID]map[string]map[string]bool{} // by ingredient and base unit
+	missing := map[string]bool{}
+	unconverted := map[string]bool{}
+	for _, dailyMeals := range days {
+		for _, planned := range dailyMeals {
+			if planned.IsEmpty() || planned.Status != "" {
+				continue
+			}
+			recipe, exists := recipes[planned.MealID]
+			if !exists || recipe.Servings <= 0 {
+				missing[planned.Name] = true
+				continue
+			}
+			for _, item := range recipe.Ingredients {
+				ingredient, known := ingredients[item.IngredientID]
+				if !known {
+					unconverted[fmt.Sprintf("an ingredient no longer in the catalogue (%s)", planned.Name)] = true
+					continue
+				}
+				quantity, unit, err := helpers.ToBaseUnit(item.Quantity/float64(recipe.Servings), item.Unit)
+				if err != nil {
+					unconverted[fmt.Sprintf("%s, %s (%s)", ingredient.Name, formatQuantity(item.Quantity, item.Unit), planned.Name)] = true
+					continue
+				}
+				if needed[item.IngredientID] == nil {
+					needed[item.IngredientID] = map[string]float64{}
+					mealsUsing[item.IngredientID] = map[string]map[string]bool{}
+				}
+				if mealsUsing[item.IngredientID][unit] == nil {
+					mealsUsing[item.IngredientID][unit] = map[string]bool{}
+				}
+				needed[item.IngredientID][unit] += quantity
+				mealsUsing[item.IngredientID][unit][planned.Name] = true
+			}
+		}
+	}
+
+	for id, amounts := range needed {
+		if len(amounts) > 1 {
+			if grams, ok := totalGrams(amounts, ingredients[id]); ok {
+				needed[id] = map[string]float64{"g": grams}
+				names := map[string]bool{}
+				for _, meals := range mealsUsing[id] {
+					for name := range meals {
+						names[name] = true
+					}
+				}
+				mealsUsing[id] = map[string]map[string]bool{"g": names}
+			}
+		}
+	}
+
+	inPantry := map[primitive.ObjectID]map[string]float64{}
+	for _, item := range pantry {
+		amounts, exists := needed[item.IngredientID]
+		if !exists {
+			continue
+		}
+		quantity, unit, err := helpers.ToBaseUnit(item.Quantity, item.Unit)
+		if err != nil {
+			continue
+		}
+		if _, sameUnit := amounts[unit]; !sameUnit {
+			grams, err := helpers.ToGrams(item.Quantity, item.Unit, ingredients[item.IngredientID])
+			if _, inGrams := amounts["g"]; err != nil || !inGrams {
+				continue
+			}
+			quantity, unit = grams, "g"
+		}
+		if inPantry[item.IngredientID] == nil {
+			inPantry[item.IngredientID] = map[string]float64{}
+		}
+		inPantry[item.IngredientID][unit] += quantity
+	}
+
+	list := models.ShoppingList{Items: []models.ShoppingListItem{}}
+	for id, amounts := range needed {
+		ingredient := ingredients[id]
+		for baseUnit, amount := range amounts {
+			have := inPantry[id][baseUnit]
+			if amount-have <= 1e-9 {
+				list.FromPantry = append(list.FromPantry, ingredient.Name)
+				continue
+			}
+
+			unit, factor := shoppingUnit(baseUnit, amount)
+			item := models.ShoppingListItem{
+				Key:          id.Hex() + ":" + baseUnit,
+				IngredientID: id,
+				Name:         ingredient.Name,
+				Aisle:        aisle(ingredient.Category),
+				Quantity:     roundUpQuantity((amount-have)/factor, unit),
+				Unit:         unit,
+				Needed:       roundUpQuantity(amount/factor, unit),
+				InPantry:     math.Round(have/factor*100) / 100,
+				Meals:        make([]string, 0, len(mealsUsing[id][baseUnit])),
+			}
+			for name := range mealsUsing[id][baseUnit] {
+				item.Meals = append(item.Meals, name)
+			}
+			sort.Strings(item.Meals)
+			list.Items = append(list.Items, item)
+		}
+	}
+	sortShoppingItems(list.Items)
+
+	for name := range missing {
+		list.MissingRecipes = append(list.MissingRecipes, name)
+	}
+	sort.Strings(list.MissingRecipes)
+	for description := range unconverted {
+		list.UnconvertedItems = append(list.UnconvertedItems, description)
+	}
+	sort.Strings(list.UnconvertedItems)
+	sort.Strings(list.FromPantry)
+	return list
+}
+
+// totalGrams sums amounts in base units as grams, if every one converts
+func totalGrams(amounts map[string]float64, ingredient models.Ingredient) (float64, bool) {
+	total := 0.0
+	for unit, amount := range amounts {
+		grams, err := helpers.ToGrams(amount, unit, ingredient)
+		if err != nil {
+			return 0, false
+		}
+		total += grams
+	}
+	return total, true
+}
+
+// shoppingUnit picks the unit an amount in a base unit is bought in, and how
+// many base units make one of it
+func shoppingUnit(baseUnit string, amount float64) (string, float64) {
+	switch {
+	case baseUnit == "g" && amount >= 1000:
+		return "kg", 1000
+	case baseUnit == "ml" && amount >= 1000:
+		return "l", 1000
+	}
+	return baseUnit, 1
+}
+
+// roundUpQuantity rounds a quantity to buy up to whole grams, millilitres and
+// pieces, or to hundredths of kilograms and litres
+func roundUpQuantity(quantity float64, unit string) float64 {
+	if unit == "kg" || unit == "l" {
+		return math.Ceil(quantity*100-1e-6) / 100
+	}
+	return math.Ceil(quantity - 1e-6)
+}
+
+// aisle returns the aisle an ingredient category is shelved in
+func aisle(category string) string {
+	for _, known := range models.Aisles {
+		if known == category {
+			return category
+		}
+	}
+	return "other"
+}
+
+func sortShoppingItems(items []models.ShoppingListItem) {
+	order := make(map[string]int, len(models.Aisles))
+	for i, name := range models.Aisles {
+		order[name] = i
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Aisle != items[j].Aisle {
+			return order[items[i].Aisle] < order[items[j].Aisle]
+		}
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].Key < items[j].Key
+	})
+}
+
+// notIncludedAisle heads the CSV rows for what the list leaves out
+const notIncludedAisle = "not included"
+
+// ShoppingAisle is the part of a shopping list found in one aisle
+type ShoppingAisle struct {
+	Aisle string                    `json:"aisle"`
+	Items []models.ShoppingListItem `json:"items"`
+}
+
+// ShoppingAisles groups a list's items by aisle, keeping their order
+func ShoppingAisles(list models.ShoppingList) []ShoppingAisle {
+	aisles := []ShoppingAisle{}
+	for _, item := range list.Items {
+		if len(aisles) == 0 || aisles[len(aisles)-1].Aisle != item.Aisle {
+			aisles = append(aisles, ShoppingAisle{Aisle: item.Aisle})
+		}
+		aisles[len(aisles)-1].Items = append(aisles[len(aisles)-1].Items, item)
+	}
+	return aisles
+}
+
+// formatQuantity writes a quantity and its unit, e.g. "1.25 kg" or "3 pieces"
+func formatQuantity(quantity float64, unit string) string {
+	if unit == "piece" && quantity != 1 {
+		unit = "pieces"
+	}
+	return strconv.FormatFloat(quantity, 'f', -1, 64) + " " + unit
+}
+
+// WriteShoppingListText writes the list as plain text, aisle by aisle, with a
+// checkbox per item
+func WriteShoppingListText(w io.Writer, list models.ShoppingList) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Shopping list for %s to %s\n", list.StartDate, list.EndDate)
+	for _, aisle := range ShoppingAisles(list) {
+		fmt.Fprintf(&b, "\n%s\n", strings.ToUpper(aisle.Aisle[:1])+aisle.Aisle[1:])
+		for _, item := range aisle.Items {
+			box := "[ ]"
+			if item.Checked {
+				box = "[x]"
+			}
+			fmt.Fprintf(&b, "%s %s - %s\n", box, item.Name, formatQuantity(item.Quantity, item.Unit))
+		}
+	}
+	if len(list.FromPantry) > 0 {
+		fmt.Fprintf(&b, "\nAlready in your pantry: %s\n", strings.Join(list.FromPantry, ", "))
+	}
+	if len(list.MissingRecipes) > 0 {
+		fmt.Fprintf(&b, "\nNo recipe yet, so not included: %s\n", strings.Join(list.MissingRecipes, ", "))
+	}
+	if len(list.UnconvertedItems) > 0 {
+		fmt.Fprintf(&b, "\nCouldn't be totalled, so not included: %s\n", strings.Join(list.UnconvertedItems, "; "))
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write shopping list: %v", err)
+	}
+	return nil
+}
+
+// WriteShoppingListCSV writes one row per item, then a row per meal without a
+// recipe and per ingredient that couldn't be totalled, in the "not included"
+// aisle
+func WriteShoppingListCSV(w io.Writer, list models.ShoppingList) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"aisle", "name", "quantity", "unit", "checked", "meals"})
+	for _, item := range list.Items {
+		writer.Write([]string{
+			item.Aisle,
+			item.Name,
+			strconv.FormatFloat(item.Quantity, 'f', -1, 64),
+			item.Unit,
+			strconv.FormatBool(item.Checked),
+			strings.Join(item.Meals, "; "),
+		})
+	}
+	for _, name := range list.MissingRecipes {
+		writer.Write([]string{notIncludedAisle, "no recipe: " + name, "", "", "", name})
+	}
+	for _, description := range list.UnconvertedItems {
+		writer.Write([]string{notIncludedAisle, "couldn't be totalled: " + description, "", "", "", ""})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write shopping list: %v", err)
+	}
+	return nil
+}
+
+// ShoppingListStore reads and writes the users' shopping lists
+type ShoppingListStore struct {
+	collection *mongo.Collection
+}
+
+func NewShoppingListStore(collection *mongo.Collection) *ShoppingListStore {
+	return &ShoppingListStore{collection: collection}
+}
+
+// EnsureIndexes creates the index that keeps one list per user and date range
+func (s *ShoppingListStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "start_date", Value: 1}, {Key: "end_date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create shopping list indexes: %v", err)
+	}
+	return nil
+}
+
+// Save stores a freshly built list, replacing the user's list for the same
+// dates. Items that were checked off on it stay checked. list is updated to
+// the stored document.
+func (s *ShoppingListStore) Save(ctx context.Context, list *models.ShoppingList, now time.Time) error {
+	filter := bson.M{"user_id": list.UserID, "start_date": list.StartDate, "end_date": list.EndDate}
+
+	var existing models.ShoppingList
+	err := s.collection.FindOne(ctx, filter).Decode(&existing)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to load shopping list: %v", err)
+	}
+	checked := map[string]bool{}
+	for _, item := range existing.Items {
+		checked[item.Key] = item.Checked
+	}
+	for i := range list.Items {
+		list.Items[i].Checked = checked[list.Items[i].Key]
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"items":             list.Items,
+			"missing_recipes":   list.MissingRecipes,
+			"unconverted_items": list.UnconvertedItems,
+			"from_pantry":       list.FromPantry,
+			"updated_at":        now,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	err = s.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(list)
+	if err != nil {
+		return fmt.Errorf("failed to save shopping list: %v", err)
+	}
+	return nil
+}
+
+// List returns the user's lists, most recently generated first
+func (s *ShoppingListStore) List(ctx context.Context, userID primitive.ObjectID) ([]models.ShoppingList, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shopping lists: %v", err)
+	}
+	lists := []models.ShoppingList{}
+	if err := cursor.All(ctx, &lists); err != nil {
+		return nil, fmt.Errorf("failed to load shopping lists: %v", err)
+	}
+	return lists, nil
+}
+
+// Get returns one of the user's lists, or nil if they have no such list
+func (s *ShoppingListStore) Get(ctx context.Context, userID, listID primitive.ObjectID) (*models.ShoppingList, error) {
+	var list models.ShoppingList
+	err := s.collection.FindOne(ctx, bson.M{"_id": listID, "user_id": userID}).Decode(&list)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shopping list: %v", err)
+	}
+	return &list, nil
+}
+
+// SetChecked checks an item off a list or back on, reporting whether the
+// list holds the item
+func (s *ShoppingListStore) SetChecked(ctx context.Context, userID, listID primitive.ObjectID, key string, checked bool, now time.Time) (bool, error) {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": listID, "user_id": userID, "items.key": key},
+		bson.M{"$set": bson.M{"items.$.checked": checked, "updated_at": now}})
+	if err != nil {
+		return false, fmt.Errorf("failed to update shopping list: %v", err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// Delete removes one of the user's lists, reporting whether it existed
+func (s *ShoppingListStore) Delete(ctx context.Context, userID, listID primitive.ObjectID) (bool, error) {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": listID, "user_id": userID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete shopping list: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// goalTags are the meal tags that serve each health goal
+var goalTags = map[string][]string{
+	"weight_loss":       {"low_fat", "high_fiber"},
+	"muscle_gain":       {"high_protein"},
+	"improve_nutrition": {"high_fiber"},
+}
+
+// SlotSuggestion is a meal proposed for a slot, ranked by Score
+type SlotSuggestion struct {
+	Meal     models.Meal               `json:"meal"`
+	Score    float64                   `json:"score"` // 0 to 1, higher is better
+	Reasons  []string                  `json:"reasons"`
+	Warnings []models.NutritionWarning `json:"warnings,omitempty"`
+}
+
+// SuggestionRequest describes the slot alternatives are wanted for
+type SuggestionRequest struct {
+	Slot models.MealSlot
+	// Budget is the calories the day has left for the slot, and SlotCalories
+	// the slot's share of the daily target. Both are 0 without targets.
+	Budget       int
+	SlotCalories int
+	// Recent are meals planned on nearby days, ranked down for variety
+	Recent      map[primitive.ObjectID]bool
+	HealthGoals []string
+	Rules       []models.ConditionRule
+}
+
+// SuggestMeals ranks candidates for a slot, best first, keeping at most
+// limit. Candidates must already be the meals the user may eat; the ranking
+// favours meals that fit the day's remaining calories, serve the user's health
+// goals, weren't planned recently and trip no condition rule.
+func SuggestMeals(candidates []models.Meal, request SuggestionRequest, limit int) []SlotSuggestion {
+	wanted := map[string]bool{}
+	for _, goal := range request.HealthGoals {
+		for _, tag := range goalTags[goal] {
+			wanted[tag] = true
+		}
+	}
+
+	suggestions := make([]SlotSuggestion, 0, len(candidates))
+	for _, meal := range candidates {
+		suggestion := SlotSuggestion{Meal: meal, Reasons: []string{}}
+
+		// Without targets every meal fits equally
+		fit := 0.5
+		if scale := math.Max(float64(request.Budget), float64(request.SlotCalories)); scale > 0 {
+			fit = 1 - math.Min(1, math.Abs(float64(meal.Calories-request.Budget))/scale)
+			suggestion.Reasons = append(suggestion.Reasons,
+				fmt.Sprintf("%d kcal with %d kcal left in the day", meal.Calories, max(request.Budget, 0)))
+		}
+
+		goal := 0.0
+		for _, tag := range meal.Tags {
+			if wanted[tag] {
+				goal = 1
+				suggestion.Reasons = append(suggestion.Reasons, "tagged "+tag+" for your health goals")
+				break
+			}
+		}
+
+		novelty := 1.0
+		if request.Recent[meal.ID] {
+			novelty = 0
+			suggestion.Reasons = append(suggestion.Reasons, "already planned on a nearby day")
+		}
+
+		suggestion.Warnings = MealWarnings(meal, request.Rules)
+		penalty := 0.25 * float64(len(suggestion.Warnings))
+
+		suggestion.Score = math.Round(math.Max(0, 0.6*fit+0.2*goal+0.2*novelty-penalty)*1000) / 1000
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Meal.Name < suggestions[j].Meal.Name
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
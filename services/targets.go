@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultTargetTolerance is how far a day's calories may stray from the
+// target, as a fraction. Macros get twice the room, since a handful of
+// catalogue meals rarely lands every macro at once.
+const DefaultTargetTolerance = 0.10
+
+// TargetTolerance reads NUTRITION_TARGET_TOLERANCE (e.g. 0.1 for ±10%)
+func TargetTolerance() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("NUTRITION_TARGET_TOLERANCE"), 64); err == nil && v > 0 && v < 1 {
+		return v
+	}
+	return DefaultTargetTolerance
+}
+
+// Minimum daily calories a weight loss deficit may go down to
+const (
+	minCaloriesFemale = 1200
+	minCaloriesMale   = 1500
+)
+
+// ComputeTargets derives daily targets from a user's body metrics with the
+// Mifflin-St Jeor equation, scaled by activity level and adjusted for health
+// goals; weight loss and muscle gain together keep maintenance calories. Age
+// is counted on the user's own date.
+func ComputeTargets(user models.User, now time.Time) (*models.NutritionTargets, error) {
+	if user.HeightCm <= 0 || user.WeightKg <= 0 {
+		return nil, fmt.Errorf("height and weight are required")
+	}
+	factor, ok := models.ActivityFactors[user.ActivityLevel]
+	if !ok {
+		return nil, fmt.Errorf("activity level is required")
+	}
+	birthdate, err := time.Parse("2006-01-02", user.Birthdate)
+	if err != nil {
+		return nil, fmt.Errorf("birthdate is required")
+	}
+
+	// A year older from the birthday on, and from March 1 for those born on
+	// February 29 when the year has none
+	today := user.Today(now)
+	age := today.Year() - birthdate.Year()
+	if today.Month() < birthdate.Month() || (today.Month() == birthdate.Month() && today.Day() < birthdate.Day()) {
+		age--
+	}
+
+	bmr := 10*user.WeightKg + 6.25*user.HeightCm - 5*float64(age)
+	minCalories := float64(minCaloriesFemale)
+	switch user.Gender {
+	case "male":
+		bmr += 5
+		minCalories = minCaloriesMale
+	case "female":
+		bmr -= 161
+	default:
+		// Midpoint of the male and female constants
+		bmr -= 78
+	}
+	tdee := bmr * factor
+
+	calories := tdee
+	proteinPerKg := 1.2
+	var warnings []string
+	weightLoss, muscleGain := false, false
+	for _, goal := range user.HealthGoals {
+		switch goal {
+		case "weight_loss":
+			weightLoss = true
+		case "muscle_gain":
+			muscleGain = true
+		}
+	}
+	switch {
+	case weightLoss && muscleGain:
+		// A deficit and a surplus cancel out: eat at maintenance with the
+		// higher protein of the two, whatever order the goals were given in
+		proteinPerKg = 1.8
+		warnings = append(warnings, "Weight loss and muscle gain pull calories in opposite directions, so the target stays at maintenance with extra protein")
+	case weightLoss:
+		// A 20% deficit, but never below the minimum nor above maintenance
+		calories = math.Max(tdee*0.8, minCalories)
+		if calories >= tdee {
+			calories = tdee
+			warnings = append(warnings, fmt.Sprintf("Maintenance calories are below the %d kcal minimum for a weight loss deficit, so the target stays at maintenance", int(minCalories)))
+		} else if calories > tdee*0.8 {
+			warnings = append(warnings, fmt.Sprintf("The weight loss target is raised to the %d kcal minimum", int(minCalories)))
+		}
+		proteinPerKg = 1.6
+	case muscleGain:
+		calories = tdee * 1.1
+		proteinPerKg = 1.8
+	}
+
+	// Protein by body weight, 30% of energy from fat and the rest from carbohydrates
+	protein := proteinPerKg * user.WeightKg
+	fat := calories * 0.30 / 9
+	carbohydrates := math.Max(calories-protein*4-fat*9, 0) / 4
+
+	return &models.NutritionTargets{
+		BMR:           int(math.Round(bmr)),
+		TDEE:          int(math.Round(tdee)),
+		Calories:      int(math.Round(calories)),
+		Protein:       math.Round(protein),
+		Carbohydrates: math.Round(carbohydrates),
+		Fat:           math.Round(fat),
+		Warnings:      warnings,
+		ComputedAt:    now,
+	}, nil
+}
+
+// targetDeviation returns the relative miss on calories and the largest relative miss on macros
+func targetDeviation(totals models.NutritionTotals, targets models.NutritionTargets) (float64, float64) {
+	relative := func(actual, target float64) float64 {
+		if target <= 0 {
+			return 0
+		}
+		return math.Abs(actual-target) / target
+	}
+	calories := relative(float64(totals.Calories), float64(targets.Calories))
+	if totals.Protein+totals.Carbohydrates+totals.Fat == 0 {
+		// Meals without macro data can only be judged on calories
+		return calories, 0
+	}
+	macros := math.Max(relative(totals.Protein, targets.Protein),
+		math.Max(relative(totals.Carbohydrates, targets.Carbohydrates), relative(totals.Fat, targets.Fat)))
+	return calories, macros
+}
+
+// WithinTargets reports whether a day's totals meet the targets within tolerance
+func WithinTargets(totals models.NutritionTotals, targets models.NutritionTargets, tolerance float64) bool {
+	calories, macros := targetDeviation(totals, targets)
+	return calories <= tolerance && macros <= 2*tolerance
+}
+
+// targetError scores how far a day is from its targets; lower is better
+func targetError(totals models.NutritionTotals, targets models.NutritionTargets) float64 {
+	calories, macros := targetDeviation(totals, targets)
+	return calories + 0.5*macros
+}
+
+// FitToTargets swaps meals on each date from fromDate onwards that misses
+// the targets, one slot at a time, keeping the swap that brings the day
+// closest until it is within tolerance or no swap helps. It returns how many
+// days changed and the dates still outside tolerance.
+func (p *DeterministicPlanner) FitToTargets(days map[string]models.DailyMeals, meals []models.Meal, slots []models.MealSlot, targets models.NutritionTargets, tolerance float64, fromDate string) (int, []string) {
+	mealsByID := IndexMealsByID(meals)
+	mealsByCategory := GroupMealsByCategory(meals)
+
+	adjusted := 0
+	var missed []string
+	for date, dailyMeals := range days {
+		if date < fromDate {
+			continue
+		}
+		fitted, changed := fitDay(dailyMeals, slots, mealsByID, mealsByCategory, targets, tolerance)
+		if changed {
+			days[date] = fitted
+			adjusted++
+		}
+		if !WithinTargets(DailyTotals(fitted, mealsByID), targets, tolerance) {
+			missed = append(missed, date)
+		}
+	}
+
+	sort.Strings(missed)
+	return adjusted, missed
+}
+
+// shareWeight is how much slots straying from their calorie share count
+// against a day, next to missing the day's targets
+const shareWeight = 0.1
+
+// slotShareError averages how far each slot's calories are from its share of
+// the calorie target
+func slotShareError(dailyMeals models.DailyMeals, slots []models.MealSlot, mealsByID map[primitive.ObjectID]models.Meal, targets models.NutritionTargets) float64 {
+	if targets.Calories <= 0 || len(slots) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, slot := range slots {
+		meal, exists := mealsByID[dailyMeals[slot.Name].MealID]
+		if !exists {
+			continue
+		}
+		total += math.Abs(float64(meal.Calories)/float64(targets.Calories) - slot.CalorieShare)
+	}
+	return total / float64(len(slots))
+}
+
+// fitDay greedily swaps meals of one day towards the targets, reporting
+// whether anything changed. Among swaps that help, it prefers those that
+// keep each slot near its calorie share. Locked slots are never swapped.
+func fitDay(dailyMeals models.DailyMeals, slots []models.MealSlot, mealsByID map[primitive.ObjectID]models.Meal, mealsByCategory map[string][]models.Meal, targets models.NutritionTargets, tolerance float64) (models.DailyMeals, bool) {
+	totals := DailyTotals(dailyMeals, mealsByID)
+	if WithinTargets(totals, targets, tolerance) {
+		return dailyMeals, false
+	}
+
+	dayError := func(day models.DailyMeals) float64 {
+		return targetError(DailyTotals(day, mealsByID), targets) + shareWeight*slotShareError(day, slots, mealsByID, targets)
+	}
+
+	dailyMeals = dailyMeals.Clone()
+	best := dayError(dailyMeals)
+	changed := false
+	for attempt := 0; attempt < 2*len(slots); attempt++ {
+		var bestSlot string
+		var bestMeal models.Meal
+		for _, slot := range slots {
+			current, _ := dailyMeals.Get(slot.Name)
+			if current.Locked {
+				continue
+			}
+			for _, candidate := range mealsByCategory[slot.Category] {
+				if candidate.ID == current.MealID {
+					continue
+				}
+				trial := dailyMeals.Clone()
+				trial.Set(slot.Name, models.NewPlannedMeal(candidate))
+				if err := dayError(trial); err < best-1e-9 {
+					best, bestSlot, bestMeal = err, slot.Name, candidate
+				}
+			}
+		}
+		if bestSlot == "" {
+			break
+		}
+		dailyMeals.Set(bestSlot, models.NewPlannedMeal(bestMeal))
+		changed = true
+		if WithinTargets(DailyTotals(dailyMeals, mealsByID), targets, tolerance) {
+			break
+		}
+	}
+	return dailyMeals, changed
+}
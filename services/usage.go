@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"figorate/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AI features recorded against a user's usage
+const (
+	FeatureMealPlan = "meal_plan"
+	FeatureChat     = "chat"
+)
+
+// Quota is a daily allowance of AI calls. Zero means unlimited.
+type Quota struct {
+	Requests int
+	Tokens   int
+}
+
+// Default daily quotas per tier, overridable with AI_QUOTA_<TIER>_REQUESTS
+// and AI_QUOTA_<TIER>_TOKENS environment variables
+var defaultQuotas = map[string]Quota{
+	"free":    {Requests: 5, Tokens: 50000},
+	"premium": {Requests: 50, Tokens: 500000},
+	"admin":   {Requests: 0, Tokens: 0},
+}
+
+// ModelPrice is the provider price in USD per 1K tokens
+type ModelPrice struct {
+	InputPer1K  float64
+	OutputPer1K float64
+}
+
+var modelPricing = map[string]ModelPrice{
+	"gpt-4-turbo-preview": {InputPer1K: 0.01, OutputPer1K: 0.03},
+	"gpt-4-turbo":         {InputPer1K: 0.01, OutputPer1K: 0.03},
+	"gpt-4o":              {InputPer1K: 0.005, OutputPer1K: 0.015},
+	"gpt-4o-mini":         {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+	"gpt-3.5-turbo":       {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+}
+
+// modelPrice looks up a model's price. Providers answer with dated versions
+// like gpt-4o-2024-08-06, priced as the longest alias they start with.
+func modelPrice(model string) (ModelPrice, bool) {
+	if price, ok := modelPricing[model]; ok {
+		return price, true
+	}
+	alias := ""
+	for name := range modelPricing {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(alias) {
+			alias = name
+		}
+	}
+	price, ok := modelPricing[alias]
+	return price, ok
+}
+
+// EstimateCost returns the estimated USD cost of a call, or 0 for unknown models
+func EstimateCost(model string, usage models.TokenUsage) float64 {
+	price, ok := modelPrice(model)
+	if !ok {
+		return 0
+	}
+	return float64(usage.PromptTokens)/1000*price.InputPer1K +
+		float64(usage.CompletionTokens)/1000*price.OutputPer1K
+}
+
+// UserTier resolves which quota tier applies to a user
+func UserTier(user models.User) string {
+	if user.Role == "admin" {
+		return "admin"
+	}
+	if user.PlanTier == "" {
+		return "free"
+	}
+	return user.PlanTier
+}
+
+// QuotaForTier returns the configured quota for a tier
+func QuotaForTier(tier string) Quota {
+	quota, ok := defaultQuotas[tier]
+	if !ok {
+		quota = defaultQuotas["free"]
+	}
+
+	prefix := "AI_QUOTA_" + strings.ToUpper(tier) + "_"
+	if v, err := strconv.Atoi(os.Getenv(prefix + "REQUESTS")); err == nil {
+		quota.Requests = v
+	}
+	if v, err := strconv.Atoi(os.Getenv(prefix + "TOKENS")); err == nil {
+		quota.Tokens = v
+	}
+	return quota
+}
+
+// UsageService records AI usage per user, day, model and feature in
+// collection, and keeps each user's running daily totals in quotas so calls
+// can be reserved against the quota before they are made
+type UsageService struct {
+	collection *mongo.Collection
+	quotas     *mongo.Collection
+}
+
+func NewUsageService(collection, quotas *mongo.Collection) *UsageService {
+	return &UsageService{collection: collection, quotas: quotas}
+}
+
+// EnsureIndexes creates the unique index quota reservations rely on
+func (s *UsageService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.quotas.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create AI quota indexes: %v", err)
+	}
+	return nil
+}
+
+func usageDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// quotaStatus describes the user's usage of their tier quota on now's date
+func quotaStatus(user models.User, now time.Time) models.AIQuotaStatus {
+	now = now.UTC()
+	tier := UserTier(user)
+	quota := QuotaForTier(tier)
+	return models.AIQuotaStatus{
+		Tier:          tier,
+		Date:          usageDate(now),
+		RequestsLimit: quota.Requests,
+		TokensLimit:   quota.Tokens,
+		ResetsAt:      time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// quotaCounter is a user's running usage for one day
+type quotaCounter struct {
+	Requests int `bson:"requests"`
+	Tokens   int `bson:"tokens"`
+}
+
+// CheckQuota compares the user's usage for today with their tier quota
+func (s *UsageService) CheckQuota(ctx context.Context, user models.User) (models.AIQuotaStatus, error) {
+	status := quotaStatus(user, time.Now())
+
+	var counter quotaCounter
+	err := s.quotas.FindOne(ctx, bson.M{"user_id": user.ID, "date": status.Date}).Decode(&counter)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return status, fmt.Errorf("failed to load usage: %v", err)
+	}
+	status.RequestsUsed = counter.Requests
+	status.TokensUsed = counter.Tokens
+	return status, nil
+}
+
+// Reserve claims one of the user's requests for today before an AI call is
+// made, so concurrent calls can't together overshoot the quota. It reports
+// false, with the user's usage, when the quota is already used up. A call that
+// then fails hands its request back with Release.
+func (s *UsageService) Reserve(ctx context.Context, user models.User) (models.AIQuotaStatus, bool, error) {
+	status := quotaStatus(user, time.Now())
+
+	filter := bson.M{"user_id": user.ID, "date": status.Date}
+	if status.RequestsLimit > 0 {
+		filter["requests"] = bson.M{"$lt": status.RequestsLimit}
+	}
+	if status.TokensLimit > 0 {
+		filter["tokens"] = bson.M{"$lt": status.TokensLimit}
+	}
+	update := bson.M{
+		"$inc":         bson.M{"requests": 1},
+		"$setOnInsert": bson.M{"tokens": 0},
+	}
+
+	// When the filter misses because the quota is used up, the upsert runs
+	// into the existing day's counter
+	var counter quotaCounter
+	err := s.quotas.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		status, err := s.CheckQuota(ctx, user)
+		return status, false, err
+	}
+	if err != nil {
+		return status, false, fmt.Errorf("failed to reserve AI quota: %v", err)
+	}
+	status.RequestsUsed = counter.Requests
+	status.TokensUsed = counter.Tokens
+	return status, true, nil
+}
+
+// Release hands back a request reserved on date for a call that failed
+func (s *UsageService) Release(ctx context.Context, userID primitive.ObjectID, date string) error {
+	_, err := s.quotas.UpdateOne(ctx, bson.M{"user_id": userID, "date": date}, bson.M{"$inc": bson.M{"requests": -1}})
+	if err != nil {
+		return fmt.Errorf("failed to release AI quota: %v", err)
+	}
+	return nil
+}
+
+// Record adds one AI call, reserved beforehand, to the user's daily usage for
+// the model and feature, and its tokens to their quota
+func (s *UsageService) Record(ctx context.Context, userID primitive.ObjectID, feature, model string, usage models.TokenUsage) error {
+	now := time.Now()
+	filter := bson.M{
+		"user_id": userID,
+		"date":    usageDate(now),
+		"model":   model,
+		"feature": feature,
+	}
+	update := bson.M{
+		"$inc": bson.M{
+			"requests":          1,
+			"prompt_tokens":     usage.PromptTokens,
+			"completion_tokens": usage.CompletionTokens,
+			"total_tokens":      usage.TotalTokens,
+			"estimated_cost":    EstimateCost(model, usage),
+		},
+		"$set":         bson.M{"updated_at": now},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %v", err)
+	}
+
+	_, err = s.quotas.UpdateOne(ctx, bson.M{"user_id": userID, "date": usageDate(now)},
+		bson.M{"$inc": bson.M{"tokens": usage.TotalTokens}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %v", err)
+	}
+	return nil
+}
+
+// Report aggregates usage and estimated cost per model between two dates (inclusive, YYYY-MM-DD)
+func (s *UsageService) Report(ctx context.Context, from, to string) ([]models.AIUsageReportRow, error) {
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"date": bson.M{"$gte": from, "$lte": to}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":               "$model",
+			"user_ids":          bson.M{"$addToSet": "$user_id"},
+			"requests":          bson.M{"$sum": "$requests"},
+			"prompt_tokens":     bson.M{"$sum": "$prompt_tokens"},
+			"completion_tokens": bson.M{"$sum": "$completion_tokens"},
+			"total_tokens":      bson.M{"$sum": "$total_tokens"},
+			"estimated_cost":    bson.M{"$sum": "$estimated_cost"},
+		}}},
+		{{Key: "$addFields", Value: bson.M{"users": bson.M{"$size": "$user_ids"}}}},
+		{{Key: "$sort", Value: bson.M{"estimated_cost": -1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage report: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	rows := []models.AIUsageReportRow{}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode usage report: %v", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocalStorage(dir, "")
+	ctx := context.Background()
+
+	url, err := s.Put(ctx, "meals/abc/full.jpg", "image/jpeg", []byte("first"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url != LocalPath+"/meals/abc/full.jpg" {
+		t.Errorf("URL = %q", url)
+	}
+
+	// A second Put replaces the object
+	if _, err := s.Put(ctx, "meals/abc/full.jpg", "image/jpeg", []byte("second")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	path := filepath.Join(dir, "meals", "abc", "full.jpg")
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "second" {
+		t.Errorf("stored %q, want %q", got, "second")
+	}
+
+	// No temporary files are left next to the object
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("upload directory holds %d entries, want 1", len(entries))
+	}
+
+	if err := s.Delete(ctx, "meals/abc/full.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("object still exists after Delete: %v", err)
+	}
+	// Deleting a missing object is not an error
+	if err := s.Delete(ctx, "meals/abc/full.jpg"); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+}
+
+func TestLocalStorageBaseURL(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), "https://cdn.example.com/uploads/")
+	if got := s.URL("users/1/small.png"); got != "https://cdn.example.com/uploads/users/1/small.png" {
+		t.Errorf("URL = %q", got)
+	}
+}
+
+func TestLocalStorageRejectsBadKeys(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocalStorage(filepath.Join(dir, "root"), "")
+
+	for _, key := range []string{"", "../escape", "a/../../escape", "/absolute", "a//b", `a\b`} {
+		if _, err := s.Put(context.Background(), key, "text/plain", []byte("x")); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape")); !os.IsNotExist(err) {
+		t.Error("a key escaped the storage directory")
+	}
+}
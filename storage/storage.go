@@ -0,0 +1,63 @@
+// Package storage keeps uploaded files such as meal images and profile
+// pictures, either in a local directory served by the API or in an
+// S3-compatible bucket (AWS S3, MinIO and the like).
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Storage writes objects under slash-separated keys and resolves them to URLs
+type Storage interface {
+	// Put stores body under key, replacing any existing object, and returns its URL
+	Put(ctx context.Context, key, contentType string, body []byte) (string, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Storage backends selectable with STORAGE_BACKEND
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// FromEnv builds the backend named by STORAGE_BACKEND, defaulting to local
+func FromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", BackendLocal:
+		return NewLocalStorage(LocalDir(), os.Getenv("STORAGE_PUBLIC_URL")), nil
+	case BackendS3:
+		return NewS3Storage(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+			PathStyle:       os.Getenv("S3_VIRTUAL_HOSTED") != "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
+}
+
+// LocalDir is where the local backend writes files, STORAGE_LOCAL_DIR or ./uploads
+func LocalDir() string {
+	if dir := os.Getenv("STORAGE_LOCAL_DIR"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+// cleanKey rejects keys that could escape the storage root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key || strings.Contains(key, `\`) {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return cleaned, nil
+}